@@ -0,0 +1,42 @@
+// cmd/schema/main.go
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/panedioic/bilibili-favlist-syncer/internal/config"
+)
+
+// 生成配置文件的 JSON Schema，配置项说明取自配置文件中的注释
+// run: go run ./cmd/schema -o configs/config.schema.json
+
+func main() {
+	configPath := flag.String("config", "configs/config.yaml", "配置文件路径，用于提取配置项说明")
+	output := flag.String("o", "", "输出文件路径，默认输出到标准输出")
+	flag.Parse()
+
+	data, err := os.ReadFile(*configPath)
+	if err != nil {
+		log.Fatalf("读取配置文件失败: %v", err)
+	}
+	descriptions, err := config.Descriptions(data)
+	if err != nil {
+		log.Fatalf("解析配置文件失败: %v", err)
+	}
+
+	out, err := json.MarshalIndent(config.Schema(descriptions), "", "  ")
+	if err != nil {
+		log.Fatalf("编码 JSON Schema 失败: %v", err)
+	}
+	out = append(out, '\n')
+	if *output == "" {
+		os.Stdout.Write(out)
+		return
+	}
+	if err := os.WriteFile(*output, out, 0o644); err != nil {
+		log.Fatalf("写入 JSON Schema 失败: %v", err)
+	}
+}
@@ -7,14 +7,21 @@ import (
 	"net/http"
 	"os/signal"
 	"strconv"
+	"sync"
 	"syscall"
 	"time"
 
-	"github.com/CuteReimu/bilibili/v2"
 	"github.com/panedioic/bilibili-favlist-syncer/internal/api"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/apicache"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/asset"
 	"github.com/panedioic/bilibili-favlist-syncer/internal/config"
 	"github.com/panedioic/bilibili-favlist-syncer/internal/db"
 	"github.com/panedioic/bilibili-favlist-syncer/internal/downloader"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/library"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/retention"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/settings"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/storage"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/transport"
 	"github.com/panedioic/bilibili-favlist-syncer/internal/watcher" // 新增
 	"github.com/panedioic/bilibili-favlist-syncer/utils"
 	"go.uber.org/zap"
@@ -25,8 +32,10 @@ import (
 // build: go build -o bfs.exe cmd/server/main.go
 // Check status: curl -f http://localhost:8080/healthz
 
+const configPath = "configs/config.yaml"
+
 func main() {
-	cfg, err := config.Load("configs/config.yaml")
+	cfg, err := config.Load(configPath)
 	if err != nil {
 		log.Fatalf("初始化配置失败: %v", err)
 	}
@@ -41,11 +50,32 @@ func main() {
 		return
 	}
 
-	// 初始化bilibili客户端
-	biliClient := bilibili.New()
+	// 所有对外请求共享的传输层，按 proxy 配置走代理
+	tf, err := transport.New(cfg, logger)
+	if err != nil {
+		logger.Error("初始化代理失败", zap.Error(err))
+		return
+	}
+
+	// 初始化bilibili客户端，只读接口的响应按 advanced.cache_ttl 缓存
+	apiCache := apicache.New(cfg.Advanced, db, logger)
+	biliClient := apicache.NewClient(tf.NewBilibiliClient(cfg), apiCache)
 
-	// 初始化downloader
-	downloader := downloader.NewDownloader(cfg, logger, biliClient, db)
+	// 完成的文件写入的存储后端
+	st, err := storage.New(cfg, tf.Client(cfg.Storage.Timeout))
+	if err != nil {
+		logger.Error("初始化存储失败", zap.Error(err))
+		return
+	}
+
+	// 初始化downloader，恢复上次关闭时未完成的任务
+	downloader := downloader.NewDownloader(cfg, logger, biliClient, db, st, tf.Client(0))
+	if _, err := downloader.RestoreQueue(); err != nil {
+		logger.Warn("恢复下载队列失败", zap.Error(err))
+	}
+
+	// 封面、头像等图片资源
+	assets := asset.NewManager(cfg, logger, db, st, tf.Client(30*time.Second))
 
 	// 新增：启动每个收藏夹的 watcher
 	favlists, err := db.ListFavlists()
@@ -56,14 +86,67 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	watchers := watcher.NewManager(downloader, biliClient, cfg.Schedule.SyncInterval, logger, db, assets)
 	for _, fav := range favlists {
-		favlistID := fav.ID
-		w := watcher.NewWatcher(downloader, biliClient, int(favlistID), cfg.Schedule.SyncInterval, logger, db)
-		go w.Start(ctx)
+		watchers.Add(fav.ID)
 	}
 
+	// 配置文件变更后重新校验，可以运行时生效的配置项通知到各模块，需要重启的变更被拒绝
+	settings := settings.NewManager(configPath, cfg, logger)
+	// 只应用变更的部分，避免覆盖通过接口临时修改的运行时状态（例如下载限速）
+	settings.Subscribe(func(cfg *config.Config, changed []string) {
+		if config.Changed(changed, "log.level") {
+			logger.SetLevel(cfg.Log.Level)
+		}
+		if config.Changed(changed, "download.concurrent") {
+			downloader.Resize(cfg.Download.Concurrent)
+		}
+		if config.Changed(changed, "download.rate_limit") {
+			if err := downloader.Limiter().Update(cfg.Download.RateLimit); err != nil {
+				logger.Error("更新下载限速失败", zap.Error(err))
+			}
+		}
+		if config.Changed(changed, "schedule.sync_interval") {
+			watchers.SetInterval(cfg.Schedule.SyncInterval)
+		}
+		if config.Changed(changed, "advanced.rate_limit", "advanced.api_retry", "advanced.risk_pause", "advanced.max_risk_pause") {
+			tf.Throttle().Update(cfg.Advanced)
+		}
+		if config.Changed(changed, "advanced.cache_ttl", "advanced.cache") {
+			apiCache.Update(cfg.Advanced)
+		}
+	})
+	if err := settings.Watch(); err != nil {
+		logger.Warn("监听配置文件失败，配置变更需要重启后生效", zap.Error(err))
+	}
+
+	// 后台任务随 ctx 停止，关闭数据库前等待它们退出
+	var background sync.WaitGroup
+	runBackground := func(run func(context.Context)) {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			run(ctx)
+		}()
+	}
+
+	// 定期检查代理是否可用
+	runBackground(tf.Run)
+
+	// 定期补齐下载失败或缺失的图片
+	runBackground(assets.Run)
+	// 定期重新上传之前上传失败的视频
+	runBackground(downloader.RunUploadRetry)
+
 	// 创建HTTP服务器
-	router := api.NewRouter(cfg, logger, db, downloader)
+	lib := library.New(cfg, logger, db, st)
+	runBackground(lib.Run)
+	// 按 schedule.cleanup 规则定期清理
+	rm := retention.NewManager(cfg, logger, db, st)
+	runBackground(rm.Run)
+
+	drain := api.NewDrain()
+	router := api.NewRouter(cfg, logger, db, biliClient, tf, st, downloader, watchers, drain, assets, lib, rm, settings)
 	srv := &http.Server{
 		Addr:    ":" + strconv.Itoa(cfg.App.Port),
 		Handler: router,
@@ -77,11 +160,39 @@ func main() {
 	}()
 
 	<-ctx.Done()
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	// 恢复默认的信号处理，关闭过程中再次收到信号时立即退出
+	stop()
+	logger.Info("收到退出信号，开始关闭")
+
+	// 按顺序关闭：拒绝写请求 -> 停止监视器 -> 等待下载 -> 关闭 HTTP 服务 -> 关闭数据库，
+	// 所有步骤共用 app.shutdown_timeout
+	timeout := cfg.App.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
+	drain.Close()
+	// 中断风控暂停中等待的B站请求，否则没有截止时间的请求会一直等到暂停结束
+	tf.Throttle().Stop()
+	watchers.Stop(shutdownCtx)
+	// 超时后 Shutdown 仍会短暂等待被中断的任务退出，之后才能关闭数据库
+	report := downloader.Shutdown(shutdownCtx)
+
 	if err := srv.Shutdown(shutdownCtx); err != nil {
 		logger.Error("Server error", zap.Error(err))
+		srv.Close()
 	}
 	logger.Info("Server stopped")
+
+	background.Wait()
+	if err := db.Close(); err != nil {
+		logger.Error("关闭数据库失败", zap.Error(err))
+	}
+	logger.Info("已退出",
+		zap.Int("interrupted", len(report.Interrupted)),
+		zap.Int("queued", len(report.Queued)),
+		zap.Int("persisted", report.Persisted),
+	)
 }
@@ -0,0 +1,67 @@
+// cmd/verify/main.go
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/panedioic/bilibili-favlist-syncer/internal/config"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/db"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/library"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/storage"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/transport"
+	"github.com/panedioic/bilibili-favlist-syncer/utils"
+)
+
+// 校验本地视频库，标记缺失或损坏的文件
+// run: go run ./cmd/verify -rehash
+// 存在问题文件时以状态码 1 退出
+
+func main() {
+	configPath := flag.String("config", "configs/config.yaml", "配置文件路径")
+	dbPath := flag.String("db", "favlist.db", "数据库路径")
+	rehash := flag.Bool("rehash", false, "重新计算所有文件的哈希并与记录比较")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("初始化配置失败: %v", err)
+	}
+	logger := utils.NewLogger(cfg.Log.Level)
+	defer logger.Sync()
+
+	database, err := db.NewDB(*dbPath)
+	if err != nil {
+		log.Fatalf("初始化数据库失败: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	tf, err := transport.New(cfg, logger)
+	if err != nil {
+		log.Fatalf("初始化代理失败: %v", err)
+	}
+	st, err := storage.New(cfg, tf.Client(cfg.Storage.Timeout))
+	if err != nil {
+		log.Fatalf("初始化存储失败: %v", err)
+	}
+
+	report, err := library.New(cfg, logger, database, st).VerifyAll(ctx, library.VerifyOptions{Rehash: *rehash})
+	if err != nil {
+		log.Fatalf("校验失败: %v", err)
+	}
+
+	fmt.Printf("共检查 %d 个文件：正常 %d，损坏 %d，缺失 %d\n", report.Checked, report.OK, report.Corrupt, report.Missing)
+	for _, p := range report.Problems {
+		fmt.Printf("[%s] %s %s: %s\n", p.Status, p.BVID, p.Path, p.Error)
+	}
+	if len(report.Problems) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/asset"
+	"go.uber.org/zap"
+)
+
+// 缩略图内容随资源更新而变化，缓存到期后通过 ETag 重新校验
+const thumbnailMaxAge = 24 * 60 * 60
+
+// 获取封面、头像等资源的缩略图，w 为宽度，默认使用最小的一档
+func (h *Handler) handleGetThumbnail(c *gin.Context) {
+	kind := c.Param("kind")
+	if kind != asset.KindCover && kind != asset.KindFace && kind != asset.KindFavlistCover {
+		c.JSON(400, ErrorResponse("不支持的资源类型"))
+		return
+	}
+
+	widths := h.cfg.Asset.Thumbnail.Widths
+	if len(widths) == 0 {
+		c.JSON(404, ErrorResponse("未启用缩略图"))
+		return
+	}
+	width := widths[0]
+	if raw := c.Query("w"); raw != "" {
+		w, err := strconv.Atoi(raw)
+		if err != nil {
+			c.JSON(400, ErrorResponse("w 参数无效"))
+			return
+		}
+		width = w
+	}
+
+	path, etag, err := h.assets.Thumbnail(kind, c.Param("key"), width)
+	if err != nil {
+		switch {
+		case errors.Is(err, asset.ErrInvalidWidth):
+			c.JSON(400, ErrorResponse(err.Error()))
+		case errors.Is(err, asset.ErrNotFound):
+			c.JSON(404, ErrorResponse(err.Error()))
+		default:
+			h.logger.Error("生成缩略图失败", zap.String("kind", kind), zap.String("key", c.Param("key")), zap.Error(err))
+			c.JSON(500, ErrorResponse("生成缩略图失败"))
+		}
+		return
+	}
+
+	// ServeFile 会根据 ETag 处理 If-None-Match，命中时返回 304
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "public, max-age="+strconv.Itoa(thumbnailMaxAge))
+	c.File(path)
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// B 站接口缓存的命中统计，按接口分组
+func (h *Handler) cacheStatus() gin.H {
+	if h.bili == nil {
+		return gin.H{}
+	}
+	cache := h.bili.Cache()
+	var hits, misses int64
+	endpoints := gin.H{}
+	for name, s := range cache.Stats() {
+		hits += s.Hits
+		misses += s.Misses
+		endpoints[name] = gin.H{
+			"ttl_seconds":    int64(cache.TTL(name).Seconds()),
+			"entries":        s.Entries,
+			"hits":           s.Hits,
+			"persisted_hits": s.PersistedHits,
+			"misses":         s.Misses,
+			"evictions":      s.Evictions,
+			"invalidations":  s.Invalidations,
+		}
+	}
+	status := gin.H{
+		"persist":   h.cfg.Advanced.Cache.Persist,
+		"hits":      hits,
+		"misses":    misses,
+		"endpoints": endpoints,
+	}
+	if total := hits + misses; total > 0 {
+		status["hit_rate"] = float64(hits) / float64(total)
+	}
+	return status
+}
+
+func (h *Handler) handleGetCache(c *gin.Context) {
+	c.JSON(200, h.cacheStatus())
+}
+
+// 清空 B 站接口缓存，之后的请求全部重新获取
+func (h *Handler) handleClearCache(c *gin.Context) {
+	if err := h.bili.Cache().Clear(); err != nil {
+		h.logger.Error("清空接口缓存失败", zap.Error(err))
+		c.JSON(500, ErrorResponse("清空接口缓存失败"))
+		return
+	}
+	h.logger.Info("已清空接口缓存")
+	c.JSON(200, gin.H{"message": "接口缓存已清空"})
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/db"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/retention"
+	"go.uber.org/zap"
+)
+
+// 预览当前清理规则会删除的视频
+func (h *Handler) handlePreviewCleanup(c *gin.Context) {
+	plan, err := h.retention.Preview()
+	if err != nil {
+		h.logger.Error("生成清理预览失败", zap.Error(err))
+		c.JSON(500, ErrorResponse("生成清理预览失败"))
+		return
+	}
+	c.JSON(200, gin.H{
+		"enabled":    h.cfg.Schedule.Cleanup.Enabled,
+		"candidates": plan.Candidates,
+		"count":      len(plan.Candidates),
+		"total_size": plan.TotalSize,
+	})
+}
+
+// 立即按当前规则执行一次清理
+func (h *Handler) handleRunCleanup(c *gin.Context) {
+	plan, err := h.retention.Execute(c.Request.Context())
+	if err != nil {
+		if errors.Is(err, retention.ErrRunning) || errors.Is(err, retention.ErrDisabled) {
+			c.JSON(409, ErrorResponse(err.Error()))
+			return
+		}
+		h.logger.Error("执行清理失败", zap.Error(err))
+		c.JSON(500, ErrorResponse("执行清理失败"))
+		return
+	}
+	c.JSON(200, gin.H{
+		"success":    true,
+		"deleted":    plan.Candidates,
+		"count":      len(plan.Candidates),
+		"total_size": plan.TotalSize,
+	})
+}
+
+// 查看清理记录
+func (h *Handler) handleListCleanupLog(c *gin.Context) {
+	page, err := queryInt(c, "page", 1)
+	if err != nil {
+		c.JSON(400, ErrorResponse(err.Error()))
+		return
+	}
+	pageSize, err := queryInt(c, "page_size", 100)
+	if err != nil {
+		c.JSON(400, ErrorResponse(err.Error()))
+		return
+	}
+	logs, total, err := h.db.ListCleanupLog(page, pageSize)
+	if err != nil {
+		if errors.Is(err, db.ErrInvalidPageSize) {
+			c.JSON(400, ErrorResponse(err.Error()))
+			return
+		}
+		c.JSON(500, ErrorResponse("查询清理记录失败"))
+		return
+	}
+	c.JSON(200, gin.H{
+		"logs":      logs,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
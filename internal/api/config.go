@@ -0,0 +1,61 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/config"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/settings"
+	"go.uber.org/zap"
+)
+
+// 查看当前生效的配置，Cookie、密钥与代理密码已隐藏
+func (h *Handler) handleGetConfig(c *gin.Context) {
+	c.JSON(200, h.settings.Current().Redacted().Map())
+}
+
+// 配置文件的 JSON Schema，供编辑器补全与生成设置页面
+func (h *Handler) handleGetConfigSchema(c *gin.Context) {
+	c.JSON(200, h.settings.Schema())
+}
+
+// 部分更新配置：只需提交要修改的配置项，键名与配置文件一致。
+// 校验通过后写回配置文件并通知各模块，需要重启的配置项不能通过接口修改
+func (h *Handler) handleUpdateConfig(c *gin.Context) {
+	var patch map[string]any
+	if err := c.ShouldBindJSON(&patch); err != nil {
+		c.JSON(400, ErrorResponse("配置格式错误"))
+		return
+	}
+
+	changed, err := h.settings.Update(patch)
+	var restart *settings.RestartRequiredError
+	switch {
+	case errors.As(err, &restart):
+		resp := ErrorResponse(err.Error())
+		resp["restart_required"] = restart.Paths
+		c.JSON(409, resp)
+		return
+	case errors.Is(err, settings.ErrInvalid):
+		resp := ErrorResponse(err.Error())
+		var invalid *config.ValidationError
+		if errors.As(err, &invalid) {
+			resp["errors"] = invalid.Errors
+		}
+		c.JSON(400, resp)
+		return
+	case err != nil:
+		h.logger.Error("保存配置失败", zap.Error(err))
+		c.JSON(500, ErrorResponse("保存配置失败"))
+		return
+	}
+
+	if changed == nil {
+		changed = []string{}
+	}
+	c.JSON(200, gin.H{
+		"success": true,
+		"changed": changed,
+		"config":  h.settings.Current().Redacted().Map(),
+	})
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Drain 在关闭过程中拒绝会修改数据的请求，只读请求照常处理，便于查看关闭进度
+type Drain struct {
+	closed atomic.Bool
+}
+
+func NewDrain() *Drain {
+	return &Drain{}
+}
+
+// Close 开始拒绝写请求
+func (d *Drain) Close() {
+	d.closed.Store(true)
+}
+
+func (d *Drain) Closed() bool {
+	return d.closed.Load()
+}
+
+func (d *Drain) middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if d.Closed() {
+				c.AbortWithStatusJSON(503, ErrorResponse("服务正在关闭，暂不接受修改"))
+				return
+			}
+		}
+		c.Next()
+	}
+}
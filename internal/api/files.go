@@ -0,0 +1,45 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"path"
+
+	"github.com/gin-gonic/gin"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/storage"
+	"go.uber.org/zap"
+)
+
+// 读取 /downloads 下的视频、封面等文件。优先使用下载目录中的本地副本，
+// 不存在时再从存储后端读取，Range 请求按需转发给后端
+func (h *Handler) handleDownloadFile(c *gin.Context) {
+	key, err := storage.CleanKey(c.Param("path"))
+	if err != nil {
+		c.JSON(404, ErrorResponse("文件不存在"))
+		return
+	}
+
+	ctx := c.Request.Context()
+	st := storage.Storage(h.local)
+	info, err := h.local.Stat(ctx, key)
+	if errors.Is(err, storage.ErrNotExist) && h.storage != nil && h.storage.Type() != storage.TypeLocal {
+		st = h.storage
+		info, err = h.storage.Stat(ctx, key)
+	}
+	if err != nil {
+		if errors.Is(err, storage.ErrNotExist) {
+			c.JSON(404, ErrorResponse("文件不存在"))
+			return
+		}
+		h.logger.Error("读取存储失败", zap.String("key", key), zap.Error(err))
+		c.JSON(502, ErrorResponse("读取存储失败"))
+		return
+	}
+
+	if info.ETag != "" {
+		c.Header("ETag", `"`+info.ETag+`"`)
+	}
+	content := storage.NewReadSeeker(ctx, st, key, info.Size)
+	defer content.Close()
+	http.ServeContent(c.Writer, c.Request, path.Base(key), info.ModTime, content)
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/library"
+	"go.uber.org/zap"
+)
+
+// 在后台启动全库校验，rehash=true 时重新计算所有文件的哈希
+func (h *Handler) handleStartVerify(c *gin.Context) {
+	rehash, err := queryBool(c, "rehash")
+	if err != nil {
+		c.JSON(400, ErrorResponse(err.Error()))
+		return
+	}
+	opts := library.VerifyOptions{Rehash: rehash != nil && *rehash}
+
+	if err := h.library.StartVerify(opts); err != nil {
+		status := 409
+		if errors.Is(err, library.ErrClosed) {
+			status = 503
+		}
+		c.JSON(status, ErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(202, gin.H{"success": true})
+}
+
+// 查看校验进度与上一次的校验结果
+func (h *Handler) handleGetVerify(c *gin.Context) {
+	c.JSON(200, gin.H{
+		"running": h.library.RunningJob() == library.JobVerify,
+		"report":  h.library.LastVerify(),
+	})
+}
+
+// 比对下载目录与数据库并返回结果，dry_run=true 时只预览不修改
+func (h *Handler) handleReconcile(c *gin.Context) {
+	dryRun, err := queryBool(c, "dry_run")
+	if err != nil {
+		c.JSON(400, ErrorResponse(err.Error()))
+		return
+	}
+	report, err := h.library.Reconcile(c.Request.Context(), library.ReconcileOptions{DryRun: dryRun != nil && *dryRun})
+	if err != nil {
+		if errors.Is(err, library.ErrBusy) {
+			c.JSON(409, ErrorResponse(err.Error()))
+			return
+		}
+		h.logger.Error("整理视频库失败", zap.Error(err))
+		c.JSON(500, ErrorResponse("整理视频库失败: "+err.Error()))
+		return
+	}
+	c.JSON(200, gin.H{
+		"success": true,
+		"report":  report,
+	})
+}
+
+// 查看上一次的整理结果
+func (h *Handler) handleGetReconcile(c *gin.Context) {
+	c.JSON(200, gin.H{
+		"running": h.library.RunningJob() == library.JobReconcile,
+		"report":  h.library.LastReconcile(),
+	})
+}
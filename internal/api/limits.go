@@ -0,0 +1,95 @@
+package api
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/config"
+	"go.uber.org/zap"
+)
+
+type rateSchedule struct {
+	Start   string `json:"start"`
+	End     string `json:"end"`
+	Global  int    `json:"global"`
+	PerTask int    `json:"per_task"`
+}
+
+// 查看下载限速配置与当前生效的限速，单位 KB/s
+func (h *Handler) handleGetRateLimit(c *gin.Context) {
+	c.JSON(200, h.rateLimitResponse())
+}
+
+// 修改下载限速，未提供的字段保持不变，修改立即生效但不写回配置文件
+func (h *Handler) handleUpdateRateLimit(c *gin.Context) {
+	var req struct {
+		Global       *int            `json:"global"`
+		PerTask      *int            `json:"per_task"`
+		TaskInterval *string         `json:"task_interval"`
+		Schedules    *[]rateSchedule `json:"schedules"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, ErrorResponse("请求格式错误"))
+		return
+	}
+
+	limiter := h.downloader.Limiter()
+	cfg := limiter.Config()
+	if req.Global != nil {
+		cfg.Global = *req.Global
+	}
+	if req.PerTask != nil {
+		cfg.PerTask = *req.PerTask
+	}
+	if req.TaskInterval != nil {
+		interval, err := time.ParseDuration(*req.TaskInterval)
+		if err != nil {
+			c.JSON(400, ErrorResponse("task_interval 格式错误"))
+			return
+		}
+		cfg.TaskInterval = interval
+	}
+	if req.Schedules != nil {
+		cfg.Schedules = make([]config.RateSchedule, 0, len(*req.Schedules))
+		for _, s := range *req.Schedules {
+			cfg.Schedules = append(cfg.Schedules, config.RateSchedule{Start: s.Start, End: s.End, Global: s.Global, PerTask: s.PerTask})
+		}
+	}
+
+	if err := limiter.Update(cfg); err != nil {
+		c.JSON(400, ErrorResponse(err.Error()))
+		return
+	}
+	h.logger.Info("下载限速已更新",
+		zap.Int("global", cfg.Global),
+		zap.Int("per_task", cfg.PerTask),
+		zap.Int("schedules", len(cfg.Schedules)),
+	)
+	c.JSON(200, h.rateLimitResponse())
+}
+
+func (h *Handler) rateLimitResponse() gin.H {
+	limiter := h.downloader.Limiter()
+	cfg := limiter.Config()
+	schedules := make([]rateSchedule, 0, len(cfg.Schedules))
+	for _, s := range cfg.Schedules {
+		schedules = append(schedules, rateSchedule{Start: s.Start, End: s.End, Global: s.Global, PerTask: s.PerTask})
+	}
+
+	limits, active := limiter.Current()
+	current := gin.H{
+		"global":   limits.Global,
+		"per_task": limits.PerTask,
+		"schedule": nil,
+	}
+	if active != nil {
+		current["schedule"] = rateSchedule{Start: active.Start, End: active.End, Global: active.Global, PerTask: active.PerTask}
+	}
+	return gin.H{
+		"global":        cfg.Global,
+		"per_task":      cfg.PerTask,
+		"task_interval": cfg.TaskInterval.String(),
+		"schedules":     schedules,
+		"current":       current,
+	}
+}
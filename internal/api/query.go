@@ -0,0 +1,148 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/db"
+)
+
+// 从查询参数构造视频筛选条件，参数格式错误时返回可直接展示给用户的错误
+func parseVideoFilter(c *gin.Context) (db.VideoFilter, error) {
+	f := db.VideoFilter{
+		SortBy:   "created_at",
+		Desc:     true,
+		Page:     1,
+		PageSize: 100,
+		Cursor:   c.Query("cursor"),
+	}
+
+	var err error
+	if f.Page, err = queryInt(c, "page", f.Page); err != nil {
+		return f, err
+	}
+	if f.PageSize, err = queryInt(c, "page_size", f.PageSize); err != nil {
+		return f, err
+	}
+	if f.PageSize <= 0 || f.PageSize > db.MaxPageSize {
+		return f, fmt.Errorf("page_size 必须在 1 到 %d 之间", db.MaxPageSize)
+	}
+
+	if f.FavlistID, err = queryInt64(c, "favlist_id"); err != nil {
+		return f, err
+	}
+	if f.UploaderUID, err = queryInt64(c, "uploader_uid"); err != nil {
+		return f, err
+	}
+	if f.IsDownloaded, err = queryBool(c, "downloaded"); err != nil {
+		return f, err
+	}
+	if f.IsInvalid, err = queryBool(c, "invalid"); err != nil {
+		return f, err
+	}
+	if f.IsRemoved, err = queryBool(c, "removed"); err != nil {
+		return f, err
+	}
+	if f.MinDuration, err = queryInt(c, "min_duration", 0); err != nil {
+		return f, err
+	}
+	if f.MaxDuration, err = queryInt(c, "max_duration", 0); err != nil {
+		return f, err
+	}
+	if f.PubdateFrom, err = queryTime(c, "pubdate_from", false); err != nil {
+		return f, err
+	}
+	if f.PubdateTo, err = queryTime(c, "pubdate_to", true); err != nil {
+		return f, err
+	}
+	if f.FavTimeFrom, err = queryTime(c, "fav_from", false); err != nil {
+		return f, err
+	}
+	if f.FavTimeTo, err = queryTime(c, "fav_to", true); err != nil {
+		return f, err
+	}
+
+	f.Tag = c.Query("tag")
+	if f.Tid, err = queryInt(c, "tid", 0); err != nil {
+		return f, err
+	}
+	if f.Copyright, err = queryInt(c, "copyright", 0); err != nil {
+		return f, err
+	}
+	f.VerifyStatus = c.Query("verify_status")
+
+	if s := c.Query("sort"); s != "" {
+		f.SortBy = s
+	}
+	switch strings.ToLower(c.Query("order")) {
+	case "":
+	case "asc":
+		f.Desc = false
+	case "desc":
+		f.Desc = true
+	default:
+		return f, fmt.Errorf("order 只能为 asc 或 desc")
+	}
+	return f, nil
+}
+
+func queryInt(c *gin.Context, key string, def int) (int, error) {
+	s := c.Query(key)
+	if s == "" {
+		return def, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%s 必须为整数", key)
+	}
+	return v, nil
+}
+
+func queryInt64(c *gin.Context, key string) (int64, error) {
+	s := c.Query(key)
+	if s == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s 必须为整数", key)
+	}
+	return v, nil
+}
+
+func queryBool(c *gin.Context, key string) (*bool, error) {
+	s := c.Query(key)
+	if s == "" {
+		return nil, nil
+	}
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return nil, fmt.Errorf("%s 必须为 true 或 false", key)
+	}
+	return &v, nil
+}
+
+// 支持 RFC3339、日期（2006-01-02）和秒级时间戳。
+// 作为区间上限时，仅有日期的参数包含当天全天
+func queryTime(c *gin.Context, key string, upper bool) (time.Time, error) {
+	s := c.Query(key)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if ts, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(ts, 0), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		if upper {
+			t = t.Add(24*time.Hour - time.Nanosecond)
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%s 时间格式错误，支持 RFC3339、2006-01-02 或时间戳", key)
+}
@@ -2,15 +2,26 @@
 package api
 
 import (
-	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
-	"github.com/CuteReimu/bilibili/v2"
 	"github.com/gin-gonic/gin"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/apicache"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/asset"
 	"github.com/panedioic/bilibili-favlist-syncer/internal/config"
 	"github.com/panedioic/bilibili-favlist-syncer/internal/db"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/disk"
 	"github.com/panedioic/bilibili-favlist-syncer/internal/downloader"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/library"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/retention"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/settings"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/storage"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/transport"
 	"github.com/panedioic/bilibili-favlist-syncer/internal/watcher"
 	"github.com/panedioic/bilibili-favlist-syncer/utils"
 	"go.uber.org/zap"
@@ -20,21 +31,41 @@ type Handler struct {
 	cfg        *config.Config
 	logger     utils.Logger
 	db         *db.DB
+	bili       *apicache.Client
+	transport  *transport.Factory
+	storage    storage.Storage
+	local      *storage.Local         // 下载目录，远程存储中没有的文件从这里读取
 	downloader *downloader.Downloader // 新增
+	watchers   *watcher.Manager
+	drain      *Drain
+	assets     *asset.Manager
+	library    *library.Library
+	retention  *retention.Manager
+	settings   *settings.Manager
 	// 添加其他服务依赖...
 }
 
-func NewHandler(cfg *config.Config, logger utils.Logger, database *db.DB, dl *downloader.Downloader) *Handler {
+func NewHandler(cfg *config.Config, logger utils.Logger, database *db.DB, bili *apicache.Client, tf *transport.Factory, st storage.Storage, dl *downloader.Downloader, wm *watcher.Manager, drain *Drain, assets *asset.Manager, lib *library.Library, rm *retention.Manager, sm *settings.Manager) *Handler {
 	return &Handler{
 		cfg:        cfg,
 		logger:     logger,
 		db:         database,
+		bili:       bili,
+		transport:  tf,
+		storage:    st,
+		local:      storage.NewLocal(storage.BaseDir(cfg)),
 		downloader: dl,
+		watchers:   wm,
+		drain:      drain,
+		assets:     assets,
+		library:    lib,
+		retention:  rm,
+		settings:   sm,
 	}
 }
 
-func NewRouter(cfg *config.Config, logger utils.Logger, database *db.DB, dl *downloader.Downloader) *gin.Engine {
-	h := NewHandler(cfg, logger, database, dl)
+func NewRouter(cfg *config.Config, logger utils.Logger, database *db.DB, bili *apicache.Client, tf *transport.Factory, st storage.Storage, dl *downloader.Downloader, wm *watcher.Manager, drain *Drain, assets *asset.Manager, lib *library.Library, rm *retention.Manager, sm *settings.Manager) *gin.Engine {
+	h := NewHandler(cfg, logger, database, bili, tf, st, dl, wm, drain, assets, lib, rm, sm)
 
 	router := gin.New()
 	if cfg.App.Env == "production" {
@@ -45,11 +76,13 @@ func NewRouter(cfg *config.Config, logger utils.Logger, database *db.DB, dl *dow
 	router.Use(
 		gin.Recovery(),
 		h.loggingMiddleware(),
+		drain.middleware(),
 		h.authMiddleware(),
 	)
 
-	// 静态资源访问：/downloads/ 映射到本地 downloads 目录
-	router.Static("/downloads", "./downloads")
+	// 静态资源访问：/downloads/ 下的文件从存储后端读取，支持 Range
+	router.GET("/downloads/*path", h.handleDownloadFile)
+	router.HEAD("/downloads/*path", h.handleDownloadFile)
 
 	// 新增：访问 web/index.html，路径为 /debug
 	router.GET("/debug", func(c *gin.Context) {
@@ -61,12 +94,33 @@ func NewRouter(cfg *config.Config, logger utils.Logger, database *db.DB, dl *dow
 	{
 		v1.GET("/status", h.handleStatus)
 		v1.GET("/video/:bvid", h.handleGetVideoByBVID)
+		v1.GET("/video/:bvid/revisions", h.handleListVideoRevisions)
+		v1.GET("/video/:bvid/meta", h.handleGetVideoMeta)
+		v1.GET("/video/:bvid/stats", h.handleListVideoStats)
+		v1.GET("/video/:bvid/subtitles", h.handleListVideoSubtitles)
 		v1.GET("/videos", h.handleListVideos) // 新增：查看所有视频的信息
 		v1.POST("/favlist", h.handleAddFavlist)
+		v1.GET("/uploaders", h.handleListUploaders)
+		v1.GET("/uploaders/:uid", h.handleGetUploader)
+		v1.GET("/uploaders/:uid/videos", h.handleListUploaderVideos)
+		v1.GET("/thumbs/:kind/:key", h.handleGetThumbnail)
+		v1.GET("/library/verify", h.handleGetVerify)
+		v1.POST("/library/verify", h.handleStartVerify)
+		v1.GET("/library/reconcile", h.handleGetReconcile)
+		v1.POST("/library/reconcile", h.handleReconcile)
+		v1.GET("/cleanup/preview", h.handlePreviewCleanup)
+		v1.POST("/cleanup/run", h.handleRunCleanup)
+		v1.GET("/cleanup/log", h.handleListCleanupLog)
 		v1.GET("/config", h.handleGetConfig)
+		v1.GET("/config/schema", h.handleGetConfigSchema)
 		v1.POST("/config", h.handleUpdateConfig)
+		v1.PATCH("/config", h.handleUpdateConfig)
 		v1.GET("/downloading", h.handleListActiveDownloads)
 		v1.GET("/downloading/:bvid", h.handleGetActiveDownloadByBVID)
+		v1.GET("/download/rate_limit", h.handleGetRateLimit)
+		v1.PUT("/download/rate_limit", h.handleUpdateRateLimit)
+		v1.GET("/cache", h.handleGetCache)
+		v1.DELETE("/cache", h.handleClearCache)
 		// 新增：获取所有日志
 		v1.GET("/logs", h.handleGetLogs)
 	}
@@ -81,16 +135,89 @@ func NewRouter(cfg *config.Config, logger utils.Logger, database *db.DB, dl *dow
 
 // 示例请求处理函数
 func (h *Handler) handleStatus(c *gin.Context) {
+	status := "running"
+	if h.drain.Closed() {
+		status = "shutting_down"
+	}
 	c.JSON(200, gin.H{
-		"status":  "running",
+		"status":  status,
 		"version": "1.0.0",
 		"stats": gin.H{
 			"download_dir": h.cfg.Download.BaseDir,
-			"concurrent":   h.cfg.Download.Concurrent,
+			"concurrent":   h.downloader.Workers(),
 		},
+		"disk":         h.diskStatus(),
+		"proxy":        h.proxyStatus(),
+		"bilibili_api": h.throttleStatus(),
+		"cache":        h.cacheStatus(),
 	})
 }
 
+// 下载目录所在磁盘的空间与视频库占用
+func (h *Handler) diskStatus() gin.H {
+	status := gin.H{
+		"low_watermark": int64(h.cfg.Download.Disk.LowWatermark) << 20,
+		"quota":         int64(h.cfg.Download.Quota.MaxSize) << 20,
+	}
+	if h.downloader != nil {
+		status["paused"] = h.downloader.SpacePaused()
+	}
+	if usage, err := disk.GetUsage(h.cfg.Download.BaseDir); err == nil {
+		status["total"] = usage.Total
+		status["free"] = usage.Free
+		status["used"] = usage.Used
+		status["used_percent"] = usage.UsedPercent()
+	} else {
+		h.logger.Warn("获取磁盘空间失败", zap.Error(err))
+	}
+	if used, err := h.db.DownloadedBytes(0); err == nil {
+		status["library_bytes"] = used
+	}
+	return status
+}
+
+// 代理配置与最近一次连通性检查的结果
+func (h *Handler) proxyStatus() gin.H {
+	if h.transport == nil {
+		return gin.H{"enabled": false}
+	}
+	health := h.transport.Health()
+	status := gin.H{"enabled": health.Enabled}
+	if !health.Enabled {
+		return status
+	}
+	status["http"] = health.HTTP
+	status["https"] = health.HTTPS
+	if !health.CheckedAt.IsZero() {
+		status["ok"] = health.OK
+		status["latency_ms"] = health.Latency.Milliseconds()
+		status["error"] = health.Error
+		status["checked_at"] = health.CheckedAt
+	}
+	return status
+}
+
+// B 站接口的限流设置与风控暂停状态
+func (h *Handler) throttleStatus() gin.H {
+	if h.transport == nil {
+		return gin.H{}
+	}
+	st := h.transport.Throttle().Status()
+	status := gin.H{
+		"rate_limit": st.RateLimit,
+		"paused":     st.Paused,
+		"strikes":    st.Strikes,
+		"risk_count": st.RiskCount,
+	}
+	if st.Paused {
+		status["paused_until"] = st.PausedUntil
+	}
+	if !st.LastRisk.IsZero() {
+		status["last_risk_at"] = st.LastRisk
+	}
+	return status
+}
+
 // 新增：根据bvid查询视频信息
 func (h *Handler) handleGetVideoByBVID(c *gin.Context) {
 	bvid := c.Param("bvid")
@@ -102,6 +229,108 @@ func (h *Handler) handleGetVideoByBVID(c *gin.Context) {
 	c.JSON(200, video)
 }
 
+// 查看视频元数据的变更历史
+func (h *Handler) handleListVideoRevisions(c *gin.Context) {
+	bvid := c.Param("bvid")
+	if _, err := h.db.GetVideoByBVID(bvid); err != nil {
+		c.JSON(404, ErrorResponse("视频未找到"))
+		return
+	}
+	revisions, err := h.db.ListVideoRevisions(bvid)
+	if err != nil {
+		c.JSON(500, ErrorResponse("查询变更历史失败"))
+		return
+	}
+	c.JSON(200, gin.H{
+		"bvid":      bvid,
+		"revisions": revisions,
+	})
+}
+
+// 查看视频的归档元数据：TAG、分区、分P、最新数据快照及接口原始数据
+func (h *Handler) handleGetVideoMeta(c *gin.Context) {
+	bvid := c.Param("bvid")
+	archive, err := h.db.GetVideoArchive(bvid)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(404, ErrorResponse("尚未归档该视频的元数据"))
+			return
+		}
+		c.JSON(500, ErrorResponse("查询视频元数据失败"))
+		return
+	}
+	meta := *archive.Meta
+	var raw json.RawMessage
+	if meta.Raw != "" {
+		raw = json.RawMessage(meta.Raw)
+	}
+	meta.Raw = ""
+	c.JSON(200, gin.H{
+		"meta":  meta,
+		"tags":  archive.Tags,
+		"pages": archive.Pages,
+		"stat":  archive.Stat,
+		"raw":   raw,
+	})
+}
+
+// 查看视频的历史数据快照
+func (h *Handler) handleListVideoStats(c *gin.Context) {
+	limit, err := queryInt(c, "limit", 0)
+	if err != nil {
+		c.JSON(400, ErrorResponse(err.Error()))
+		return
+	}
+	stats, err := h.db.ListVideoStats(c.Param("bvid"), limit)
+	if err != nil {
+		c.JSON(500, ErrorResponse("查询数据快照失败"))
+		return
+	}
+	c.JSON(200, gin.H{
+		"bvid":  c.Param("bvid"),
+		"stats": stats,
+	})
+}
+
+// 查看视频已下载的字幕轨道及各格式的访问地址
+func (h *Handler) handleListVideoSubtitles(c *gin.Context) {
+	subtitles, err := h.db.ListVideoSubtitles(c.Param("bvid"))
+	if err != nil {
+		c.JSON(500, ErrorResponse("查询字幕失败"))
+		return
+	}
+	list := make([]gin.H, 0, len(subtitles))
+	for _, s := range subtitles {
+		urls := gin.H{}
+		for _, format := range s.Formats {
+			if u := h.downloadURL(s.Path + "." + format); u != "" {
+				urls[format] = u
+			}
+		}
+		list = append(list, gin.H{
+			"page":    s.Page,
+			"cid":     s.CID,
+			"lan":     s.Lan,
+			"lan_doc": s.LanDoc,
+			"is_ai":   s.IsAI,
+			"urls":    urls,
+		})
+	}
+	c.JSON(200, gin.H{
+		"bvid":      c.Param("bvid"),
+		"subtitles": list,
+	})
+}
+
+// 将下载目录中的文件路径转换为 /downloads 下的访问地址，目录外的文件返回空字符串
+func (h *Handler) downloadURL(path string) string {
+	rel, err := filepath.Rel(h.cfg.Download.BaseDir, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return ""
+	}
+	return "/downloads/" + filepath.ToSlash(rel)
+}
+
 // 新增：添加一个收藏夹
 func (h *Handler) handleAddFavlist(c *gin.Context) {
 	var req struct {
@@ -124,18 +353,8 @@ func (h *Handler) handleAddFavlist(c *gin.Context) {
 		return
 	}
 
-	// 新建 watcher
-	go func() {
-		w := watcher.NewWatcher(
-			h.downloader,
-			bilibili.New(),
-			int(fav.ID),
-			h.cfg.Schedule.SyncInterval,
-			h.logger,
-			h.db,
-		)
-		w.Start(context.Background())
-	}()
+	// 新建 watcher，已在监视的收藏夹不重复启动
+	h.watchers.Add(fav.ID)
 
 	c.JSON(200, gin.H{
 		"success": true,
@@ -143,26 +362,6 @@ func (h *Handler) handleAddFavlist(c *gin.Context) {
 	})
 }
 
-// 新增：查看配置
-func (h *Handler) handleGetConfig(c *gin.Context) {
-	c.JSON(200, h.cfg)
-}
-
-// 新增：修改配置
-func (h *Handler) handleUpdateConfig(c *gin.Context) {
-	var newCfg config.Config
-	if err := c.ShouldBindJSON(&newCfg); err != nil {
-		c.JSON(400, ErrorResponse("配置格式错误"))
-		return
-	}
-	// 这里直接替换内存中的配置
-	*h.cfg = newCfg
-	c.JSON(200, gin.H{
-		"success": true,
-		"config":  h.cfg,
-	})
-}
-
 // 新增：查看所有正在下载中的视频
 func (h *Handler) handleListActiveDownloads(c *gin.Context) {
 	// 假设 Downloader 有 ListActiveTasks() 方法，返回 []*downloader.Task
@@ -183,29 +382,32 @@ func (h *Handler) handleGetActiveDownloadByBVID(c *gin.Context) {
 	c.JSON(200, task)
 }
 
-// 新增：查看所有视频的信息（支持分页）
+// 查看视频列表，支持筛选、排序、页码分页和游标分页
 func (h *Handler) handleListVideos(c *gin.Context) {
-	page := 1
-	pageSize := 100
-	if p := c.Query("page"); p != "" {
-		if v, err := strconv.Atoi(p); err == nil && v > 0 {
-			page = v
-		}
-	}
-	if ps := c.Query("page_size"); ps != "" {
-		if v, err := strconv.Atoi(ps); err == nil && v > 0 && v <= 100 {
-			pageSize = v
-		}
+	filter, err := parseVideoFilter(c)
+	if err != nil {
+		c.JSON(400, ErrorResponse(err.Error()))
+		return
 	}
-	videos, err := h.db.ListVideos(page, pageSize)
+	h.respondVideoList(c, filter)
+}
+
+func (h *Handler) respondVideoList(c *gin.Context, filter db.VideoFilter) {
+	list, err := h.db.ListVideos(filter)
 	if err != nil {
+		if errors.Is(err, db.ErrInvalidCursor) || errors.Is(err, db.ErrInvalidSort) || errors.Is(err, db.ErrInvalidPageSize) {
+			c.JSON(400, ErrorResponse(err.Error()))
+			return
+		}
 		c.JSON(500, ErrorResponse("查询视频列表失败"))
 		return
 	}
 	c.JSON(200, gin.H{
-		"videos":    videos,
-		"page":      page,
-		"page_size": pageSize,
+		"videos":      list.Videos,
+		"total":       list.Total,
+		"page":        filter.Page,
+		"page_size":   filter.PageSize,
+		"next_cursor": list.NextCursor,
 	})
 }
 
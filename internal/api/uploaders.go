@@ -0,0 +1,85 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/db"
+)
+
+// 查看UP主列表，附带视频数量与已下载大小
+func (h *Handler) handleListUploaders(c *gin.Context) {
+	page, err := queryInt(c, "page", 1)
+	if err != nil {
+		c.JSON(400, ErrorResponse(err.Error()))
+		return
+	}
+	pageSize, err := queryInt(c, "page_size", 100)
+	if err != nil {
+		c.JSON(400, ErrorResponse(err.Error()))
+		return
+	}
+	desc := strings.ToLower(c.Query("order")) != "asc"
+
+	uploaders, total, err := h.db.ListUploaders(page, pageSize, c.Query("sort"), desc)
+	if err != nil {
+		if errors.Is(err, db.ErrInvalidSort) || errors.Is(err, db.ErrInvalidPageSize) {
+			c.JSON(400, ErrorResponse(err.Error()))
+			return
+		}
+		c.JSON(500, ErrorResponse("查询UP主列表失败"))
+		return
+	}
+	c.JSON(200, gin.H{
+		"uploaders": uploaders,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// 查看单个UP主的信息与昵称历史
+func (h *Handler) handleGetUploader(c *gin.Context) {
+	uid, err := strconv.ParseInt(c.Param("uid"), 10, 64)
+	if err != nil {
+		c.JSON(400, ErrorResponse("UID格式错误"))
+		return
+	}
+	stats, err := h.db.GetUploaderStats(uid)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(404, ErrorResponse("UP主未找到"))
+			return
+		}
+		c.JSON(500, ErrorResponse("查询UP主失败"))
+		return
+	}
+	names, err := h.db.ListUploaderNames(uid)
+	if err != nil {
+		c.JSON(500, ErrorResponse("查询UP主昵称历史失败"))
+		return
+	}
+	c.JSON(200, gin.H{
+		"uploader":     stats,
+		"name_history": names,
+	})
+}
+
+// 查看UP主在所有收藏夹中的视频，支持与视频列表相同的筛选参数
+func (h *Handler) handleListUploaderVideos(c *gin.Context) {
+	uid, err := strconv.ParseInt(c.Param("uid"), 10, 64)
+	if err != nil {
+		c.JSON(400, ErrorResponse("UID格式错误"))
+		return
+	}
+	filter, err := parseVideoFilter(c)
+	if err != nil {
+		c.JSON(400, ErrorResponse(err.Error()))
+		return
+	}
+	filter.UploaderUID = uid
+	h.respondVideoList(c, filter)
+}
@@ -0,0 +1,267 @@
+// Package apicache 缓存 B 站只读接口的响应。视频详情、分P列表、标签与 UP 主名片在任务重试
+// 或重新入队时会被反复请求，缓存后在 advanced.cache_ttl 内直接返回，可选写入数据库
+package apicache
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/panedioic/bilibili-favlist-syncer/internal/config"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/db"
+	"github.com/panedioic/bilibili-favlist-syncer/utils"
+	"go.uber.org/zap"
+)
+
+// 缓存的接口
+const (
+	EndpointVideoInfo  = "video_info"
+	EndpointVideoPages = "video_pages"
+	EndpointVideoTags  = "video_tags"
+	EndpointUserCard   = "user_card"
+)
+
+var endpoints = []string{EndpointVideoInfo, EndpointVideoPages, EndpointVideoTags, EndpointUserCard}
+
+type entry struct {
+	value     []byte // JSON 编码的响应，每次读取都解码出新的对象
+	expiresAt time.Time
+}
+
+// Stats 为单个接口的缓存统计
+type Stats struct {
+	Hits          int64
+	PersistedHits int64 // 内存未命中、从数据库读到的次数，也计入 Hits
+	Misses        int64
+	Evictions     int64
+	Invalidations int64
+	Entries       int
+}
+
+type Cache struct {
+	logger utils.Logger
+	store  *db.DB // 为 nil 时只缓存在内存中
+	now    func() time.Time
+
+	mu         sync.Mutex
+	defaultTTL time.Duration
+	ttls       map[string]time.Duration
+	maxEntries int
+	entries    map[string]entry
+	stats      map[string]*Stats
+}
+
+// New 创建缓存，cfg.Cache.Persist 为 true 时同时写入 database
+func New(cfg config.AdvancedConfig, database *db.DB, logger utils.Logger) *Cache {
+	c := &Cache{
+		logger:  logger,
+		now:     time.Now,
+		entries: make(map[string]entry),
+		stats:   make(map[string]*Stats, len(endpoints)),
+	}
+	for _, e := range endpoints {
+		c.stats[e] = &Stats{}
+	}
+	if cfg.Cache.Persist && database != nil {
+		c.store = database
+		if n, err := database.DeleteExpiredCache(c.now()); err != nil {
+			logger.Warn("清理过期缓存失败", zap.Error(err))
+		} else if n > 0 {
+			logger.Info("已清理过期缓存", zap.Int64("count", n))
+		}
+	}
+	c.Update(cfg)
+	return c
+}
+
+// Update 应用新的缓存时间与条目上限，已缓存的条目保留原来的过期时间
+func (c *Cache) Update(cfg config.AdvancedConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.defaultTTL = cfg.CacheTTL
+	c.ttls = make(map[string]time.Duration, len(cfg.Cache.TTLs))
+	for name, ttl := range cfg.Cache.TTLs {
+		c.ttls[name] = ttl
+	}
+	c.maxEntries = cfg.Cache.MaxEntries
+	c.evictLocked()
+}
+
+// TTL 返回接口的缓存时间，0 表示不缓存
+func (c *Cache) TTL(endpoint string) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ttlLocked(endpoint)
+}
+
+func (c *Cache) ttlLocked(endpoint string) time.Duration {
+	if ttl, ok := c.ttls[endpoint]; ok {
+		return ttl
+	}
+	return c.defaultTTL
+}
+
+func cacheKey(endpoint, key string) string {
+	return endpoint + ":" + key
+}
+
+// 读取缓存并解码到 out，未命中时返回 false
+func (c *Cache) get(endpoint, key string, out any) bool {
+	k := cacheKey(endpoint, key)
+	now := c.now()
+
+	c.mu.Lock()
+	stats := c.statsLocked(endpoint)
+	e, ok := c.entries[k]
+	if ok && !e.expiresAt.After(now) {
+		delete(c.entries, k)
+		ok = false
+	}
+	c.mu.Unlock()
+
+	persisted := false
+	if !ok && c.store != nil {
+		value, expiresAt, err := c.store.GetCacheEntry(k, now)
+		if err != nil {
+			c.logger.Warn("读取缓存失败", zap.String("key", k), zap.Error(err))
+		} else if value != nil {
+			e, ok, persisted = entry{value: value, expiresAt: expiresAt}, true, true
+		}
+	}
+	if ok && json.Unmarshal(e.value, out) != nil {
+		ok = false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !ok {
+		stats.Misses++
+		return false
+	}
+	stats.Hits++
+	if persisted {
+		stats.PersistedHits++
+		c.entries[k] = e
+		c.evictLocked()
+	}
+	return true
+}
+
+func (c *Cache) set(endpoint, key string, value any) {
+	ttl := c.TTL(endpoint)
+	if ttl <= 0 {
+		return
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+	k := cacheKey(endpoint, key)
+	e := entry{value: data, expiresAt: c.now().Add(ttl)}
+
+	c.mu.Lock()
+	c.entries[k] = e
+	c.evictLocked()
+	c.mu.Unlock()
+
+	if c.store != nil {
+		if err := c.store.SetCacheEntry(k, endpoint, data, e.expiresAt); err != nil {
+			c.logger.Warn("写入缓存失败", zap.String("key", k), zap.Error(err))
+		}
+	}
+}
+
+// Invalidate 删除一个接口的缓存
+func (c *Cache) Invalidate(endpoint, key string) {
+	k := cacheKey(endpoint, key)
+	c.mu.Lock()
+	if _, ok := c.entries[k]; ok {
+		c.statsLocked(endpoint).Invalidations++
+	}
+	delete(c.entries, k)
+	c.mu.Unlock()
+
+	if c.store != nil {
+		if err := c.store.DeleteCacheEntry(k); err != nil {
+			c.logger.Warn("删除缓存失败", zap.String("key", k), zap.Error(err))
+		}
+	}
+}
+
+// InvalidateVideo 在同步发现视频信息变化时调用，删除该视频的详情、分P与标签缓存
+func (c *Cache) InvalidateVideo(bvid string) {
+	for _, e := range []string{EndpointVideoInfo, EndpointVideoPages, EndpointVideoTags} {
+		c.Invalidate(e, bvid)
+	}
+}
+
+// InvalidateUploader 在同步发现 UP 主昵称或头像变化时调用
+func (c *Cache) InvalidateUploader(mid int64) {
+	c.Invalidate(EndpointUserCard, midKey(mid))
+}
+
+// Clear 清空所有缓存，统计数据保留
+func (c *Cache) Clear() error {
+	c.mu.Lock()
+	c.entries = make(map[string]entry)
+	c.mu.Unlock()
+	if c.store != nil {
+		return c.store.ClearCache()
+	}
+	return nil
+}
+
+// Stats 返回各接口的缓存统计
+func (c *Cache) Stats() map[string]Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counts := make(map[string]int, len(c.stats))
+	for k := range c.entries {
+		if name, _, ok := strings.Cut(k, ":"); ok {
+			counts[name]++
+		}
+	}
+	result := make(map[string]Stats, len(c.stats))
+	for name, s := range c.stats {
+		snapshot := *s
+		snapshot.Entries = counts[name]
+		result[name] = snapshot
+	}
+	return result
+}
+
+func (c *Cache) statsLocked(endpoint string) *Stats {
+	s, ok := c.stats[endpoint]
+	if !ok {
+		s = &Stats{}
+		c.stats[endpoint] = s
+	}
+	return s
+}
+
+// 超过条目上限时先删除过期条目，仍然超出时删除最早过期的条目
+func (c *Cache) evictLocked() {
+	if c.maxEntries <= 0 || len(c.entries) <= c.maxEntries {
+		return
+	}
+	now := c.now()
+	for k, e := range c.entries {
+		if !e.expiresAt.After(now) {
+			delete(c.entries, k)
+		}
+	}
+	for len(c.entries) > c.maxEntries {
+		var oldest string
+		var oldestAt time.Time
+		for k, e := range c.entries {
+			if oldest == "" || e.expiresAt.Before(oldestAt) {
+				oldest, oldestAt = k, e.expiresAt
+			}
+		}
+		delete(c.entries, oldest)
+		if name, _, ok := strings.Cut(oldest, ":"); ok {
+			c.statsLocked(name).Evictions++
+		}
+	}
+}
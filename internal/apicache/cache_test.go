@@ -0,0 +1,245 @@
+package apicache
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/panedioic/bilibili-favlist-syncer/internal/config"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/db"
+	"github.com/panedioic/bilibili-favlist-syncer/utils"
+)
+
+var t0 = time.Unix(1700000000, 0)
+
+func newTestCache(now *time.Time, cfg config.AdvancedConfig, database *db.DB) *Cache {
+	c := New(cfg, database, utils.NewLogger("error"))
+	c.now = func() time.Time { return *now }
+	return c
+}
+
+func cached(c *Cache, endpoint, key string) (string, bool) {
+	var v string
+	ok := c.get(endpoint, key, &v)
+	return v, ok
+}
+
+func TestCacheTTL(t *testing.T) {
+	now := t0
+	c := newTestCache(&now, config.AdvancedConfig{
+		CacheTTL: time.Minute,
+		Cache: config.CacheConfig{TTLs: map[string]time.Duration{
+			EndpointUserCard:  time.Hour,
+			EndpointVideoTags: 0,
+		}},
+	}, nil)
+
+	c.set(EndpointVideoInfo, "BV1", "info")
+	c.set(EndpointUserCard, "1", "card")
+	c.set(EndpointVideoTags, "BV1", "tags")
+
+	if v, ok := cached(c, EndpointVideoInfo, "BV1"); !ok || v != "info" {
+		t.Errorf("过期前 get = %q, %v", v, ok)
+	}
+	if _, ok := cached(c, EndpointVideoTags, "BV1"); ok {
+		t.Error("缓存时间为 0 的接口不应缓存")
+	}
+
+	// 到达过期时间即失效，按接口覆盖的缓存时间单独计算
+	now = t0.Add(time.Minute)
+	if _, ok := cached(c, EndpointVideoInfo, "BV1"); ok {
+		t.Error("过期后仍然命中")
+	}
+	if v, ok := cached(c, EndpointUserCard, "1"); !ok || v != "card" {
+		t.Errorf("user_card get = %q, %v", v, ok)
+	}
+
+	stats := c.Stats()
+	if s := stats[EndpointVideoInfo]; s.Hits != 1 || s.Misses != 1 || s.Entries != 0 {
+		t.Errorf("video_info Stats = %+v", s)
+	}
+	if s := stats[EndpointUserCard]; s.Hits != 1 || s.Entries != 1 {
+		t.Errorf("user_card Stats = %+v", s)
+	}
+
+	// 更新配置后新的缓存使用新的时间，已缓存的条目不变
+	c.Update(config.AdvancedConfig{CacheTTL: 2 * time.Minute})
+	if got := c.TTL(EndpointUserCard); got != 2*time.Minute {
+		t.Errorf("TTL = %v, want 2m", got)
+	}
+	now = t0.Add(59 * time.Minute)
+	if _, ok := cached(c, EndpointUserCard, "1"); !ok {
+		t.Error("更新配置后已缓存的条目失效")
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	now := t0
+	cfg := func(maxEntries int) config.AdvancedConfig {
+		return config.AdvancedConfig{
+			CacheTTL: time.Hour,
+			Cache: config.CacheConfig{
+				MaxEntries: maxEntries,
+				TTLs:       map[string]time.Duration{EndpointUserCard: time.Minute},
+			},
+		}
+	}
+	c := newTestCache(&now, cfg(2), nil)
+
+	// 超出上限时删除最早过期的条目
+	c.set(EndpointVideoInfo, "BV1", "a")
+	c.set(EndpointUserCard, "1", "b")
+	now = now.Add(time.Second)
+	c.set(EndpointVideoInfo, "BV2", "c")
+	if _, ok := cached(c, EndpointUserCard, "1"); ok {
+		t.Error("最早过期的条目未被删除")
+	}
+	for _, key := range []string{"BV1", "BV2"} {
+		if _, ok := cached(c, EndpointVideoInfo, key); !ok {
+			t.Errorf("%s 不应被删除", key)
+		}
+	}
+	if s := c.Stats()[EndpointUserCard]; s.Evictions != 1 {
+		t.Errorf("user_card Evictions = %d, want 1", s.Evictions)
+	}
+
+	// 先删除已过期的条目，不计入淘汰次数
+	c.Update(cfg(3))
+	c.set(EndpointUserCard, "2", "d")
+	now = now.Add(time.Minute)
+	c.set(EndpointVideoInfo, "BV3", "e")
+	stats := c.Stats()
+	if s := stats[EndpointUserCard]; s.Evictions != 1 || s.Entries != 0 {
+		t.Errorf("user_card Stats = %+v", s)
+	}
+	if s := stats[EndpointVideoInfo]; s.Evictions != 0 || s.Entries != 3 {
+		t.Errorf("video_info Stats = %+v", s)
+	}
+
+	// 降低上限后立即淘汰，保留最晚过期的条目
+	c.Update(cfg(1))
+	if _, ok := cached(c, EndpointVideoInfo, "BV3"); !ok {
+		t.Error("降低上限后最晚过期的条目应保留")
+	}
+	if s := c.Stats()[EndpointVideoInfo]; s.Evictions != 2 || s.Entries != 1 {
+		t.Errorf("降低上限后 Stats = %+v", s)
+	}
+}
+
+func TestCacheInvalidate(t *testing.T) {
+	now := t0
+	c := newTestCache(&now, config.AdvancedConfig{CacheTTL: time.Hour}, nil)
+	for _, e := range endpoints {
+		c.set(e, "BV1", e)
+	}
+	c.set(EndpointUserCard, midKey(1), "card")
+
+	c.InvalidateVideo("BV1")
+	c.InvalidateVideo("BV1")
+	for _, e := range []string{EndpointVideoInfo, EndpointVideoPages, EndpointVideoTags} {
+		if _, ok := cached(c, e, "BV1"); ok {
+			t.Errorf("%s 未被删除", e)
+		}
+		if s := c.Stats()[e]; s.Invalidations != 1 {
+			t.Errorf("%s Invalidations = %d, want 1", e, s.Invalidations)
+		}
+	}
+
+	c.InvalidateUploader(1)
+	if _, ok := cached(c, EndpointUserCard, midKey(1)); ok {
+		t.Error("UP 主名片未被删除")
+	}
+	if _, ok := cached(c, EndpointUserCard, "BV1"); !ok {
+		t.Error("删除了其他条目")
+	}
+
+	if err := c.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if s := c.Stats()[EndpointUserCard]; s.Entries != 0 || s.Hits != 1 {
+		t.Errorf("Clear 后 Stats = %+v", s)
+	}
+}
+
+func TestFetch(t *testing.T) {
+	now := t0
+	c := newTestCache(&now, config.AdvancedConfig{CacheTTL: time.Minute}, nil)
+	calls := 0
+	load := func() (string, error) {
+		calls++
+		if calls == 1 {
+			return "", errors.New("请求失败")
+		}
+		return "info", nil
+	}
+
+	// 失败的结果不缓存，没有 key 时不使用缓存
+	for range 3 {
+		fetch(c, EndpointVideoInfo, "BV1", load)
+	}
+	if calls != 2 {
+		t.Errorf("load 调用 %d 次, want 2", calls)
+	}
+	fetch(c, EndpointVideoInfo, "", load)
+	fetch(c, EndpointVideoInfo, "", load)
+	if calls != 4 {
+		t.Errorf("load 调用 %d 次, want 4", calls)
+	}
+
+	now = now.Add(time.Minute)
+	if v, err := fetch(c, EndpointVideoInfo, "BV1", load); err != nil || v != "info" || calls != 5 {
+		t.Errorf("过期后 fetch = %q, %v, 调用 %d 次", v, err, calls)
+	}
+}
+
+// 数据库中的过期时间与创建缓存时的清理使用真实时间，因此时钟从当前时间开始
+func TestCachePersist(t *testing.T) {
+	database, err := db.NewDB(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	now := time.Now()
+	cfg := config.AdvancedConfig{
+		CacheTTL: time.Hour,
+		Cache: config.CacheConfig{
+			Persist: true,
+			TTLs:    map[string]time.Duration{EndpointVideoTags: time.Millisecond},
+		},
+	}
+	c := newTestCache(&now, cfg, database)
+	c.set(EndpointVideoInfo, "BV1", "info")
+	c.set(EndpointVideoTags, "BV1", "tags")
+	c.set(EndpointVideoPages, "BV1", "pages")
+	c.Invalidate(EndpointVideoPages, "BV1")
+
+	// 重启后从数据库读取，并清理已过期的条目
+	time.Sleep(5 * time.Millisecond)
+	now = time.Now()
+	c = newTestCache(&now, cfg, database)
+	if v, ok := cached(c, EndpointVideoInfo, "BV1"); !ok || v != "info" {
+		t.Errorf("重启后 get = %q, %v", v, ok)
+	}
+	if _, ok := cached(c, EndpointVideoInfo, "BV1"); !ok {
+		t.Error("第二次读取未命中")
+	}
+	if s := c.Stats()[EndpointVideoInfo]; s.Hits != 2 || s.PersistedHits != 1 || s.Entries != 1 {
+		t.Errorf("Stats = %+v", s)
+	}
+	for _, e := range []string{EndpointVideoTags, EndpointVideoPages} {
+		if _, ok := cached(c, e, "BV1"); ok {
+			t.Errorf("%s 不应从数据库读到", e)
+		}
+	}
+	if value, _, err := database.GetCacheEntry(cacheKey(EndpointVideoTags, "BV1"), t0); err != nil || value != nil {
+		t.Errorf("过期的条目未从数据库清理: %q, %v", value, err)
+	}
+
+	// 过期后内存与数据库中的条目都不再使用
+	now = now.Add(time.Hour)
+	if _, ok := cached(c, EndpointVideoInfo, "BV1"); ok {
+		t.Error("过期后仍然命中")
+	}
+}
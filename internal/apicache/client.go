@@ -0,0 +1,152 @@
+package apicache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/CuteReimu/bilibili/v2"
+)
+
+// Client 在 bilibili.Client 的只读接口前加一层缓存，其余接口直接使用内嵌的客户端
+type Client struct {
+	*bilibili.Client
+	cache *Cache
+}
+
+func NewClient(client *bilibili.Client, cache *Cache) *Client {
+	return &Client{Client: client, cache: cache}
+}
+
+func (c *Client) Cache() *Cache {
+	return c.cache
+}
+
+func (c *Client) GetVideoInfo(param bilibili.VideoParam) (*bilibili.VideoInfo, error) {
+	return fetch(c.cache, EndpointVideoInfo, videoKey(param), func() (*bilibili.VideoInfo, error) {
+		return c.Client.GetVideoInfo(param)
+	})
+}
+
+func (c *Client) GetVideoPageList(param bilibili.VideoParam) ([]bilibili.VideoPage, error) {
+	return fetch(c.cache, EndpointVideoPages, videoKey(param), func() ([]bilibili.VideoPage, error) {
+		return c.Client.GetVideoPageList(param)
+	})
+}
+
+func (c *Client) GetVideoTags(param bilibili.VideoParam) ([]bilibili.VideoTag, error) {
+	return fetch(c.cache, EndpointVideoTags, videoKey(param), func() ([]bilibili.VideoTag, error) {
+		return c.Client.GetVideoTags(param)
+	})
+}
+
+// GetUserCard 只缓存不带头图的请求
+func (c *Client) GetUserCard(param bilibili.GetUserCardParam) (*bilibili.UserCard, error) {
+	if param.Photo {
+		return c.Client.GetUserCard(param)
+	}
+	return fetch(c.cache, EndpointUserCard, midKey(int64(param.Mid)), func() (*bilibili.UserCard, error) {
+		return c.Client.GetUserCard(param)
+	})
+}
+
+// 以下接口与 bilibili.Client 中的对应方法相同，但请求随 ctx 取消，供下载任务使用
+const (
+	videoInfoURL  = "https://api.bilibili.com/x/web-interface/view"
+	videoPagesURL = "https://api.bilibili.com/x/player/pagelist"
+	videoTagsURL  = "https://api.bilibili.com/x/tag/archive/tags"
+)
+
+// FetchVideoInfo 跳过缓存请求视频详情并用结果更新缓存，用于播放量等需要实时数据的场景
+func (c *Client) FetchVideoInfo(ctx context.Context, param bilibili.VideoParam) (*bilibili.VideoInfo, error) {
+	info, err := c.loadVideoInfo(ctx, param)
+	if err == nil {
+		if key := videoKey(param); key != "" {
+			c.cache.set(EndpointVideoInfo, key, info)
+		}
+	}
+	return info, err
+}
+
+func (c *Client) loadVideoInfo(ctx context.Context, param bilibili.VideoParam) (*bilibili.VideoInfo, error) {
+	var info bilibili.VideoInfo
+	if err := c.GetJSON(ctx, videoInfoURL, videoParams(param), &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (c *Client) GetVideoPageListContext(ctx context.Context, param bilibili.VideoParam) ([]bilibili.VideoPage, error) {
+	return fetch(c.cache, EndpointVideoPages, videoKey(param), func() ([]bilibili.VideoPage, error) {
+		var pages []bilibili.VideoPage
+		err := c.GetJSON(ctx, videoPagesURL, videoParams(param), &pages)
+		return pages, err
+	})
+}
+
+func (c *Client) GetVideoTagsContext(ctx context.Context, param bilibili.VideoParam) ([]bilibili.VideoTag, error) {
+	return fetch(c.cache, EndpointVideoTags, videoKey(param), func() ([]bilibili.VideoTag, error) {
+		var tags []bilibili.VideoTag
+		err := c.GetJSON(ctx, videoTagsURL, videoParams(param), &tags)
+		return tags, err
+	})
+}
+
+// GetJSON 请求B站通用格式（code/message/data）的接口并解析 data，不经过缓存
+func (c *Client) GetJSON(ctx context.Context, url string, params map[string]string, out any) error {
+	resp, err := c.Resty().R().SetContext(ctx).SetQueryParams(params).Get(url)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() != 200 {
+		return fmt.Errorf("状态码: %d", resp.StatusCode())
+	}
+	var body struct {
+		Code    int             `json:"code"`
+		Message string          `json:"message"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(resp.Body(), &body); err != nil {
+		return err
+	}
+	if body.Code != 0 {
+		return bilibili.Error{Code: body.Code, Message: body.Message}
+	}
+	return json.Unmarshal(body.Data, out)
+}
+
+// 先查缓存，未命中时调用 load 并缓存成功的结果
+func fetch[T any](c *Cache, endpoint, key string, load func() (T, error)) (T, error) {
+	var cached T
+	if key != "" && c.get(endpoint, key, &cached) {
+		return cached, nil
+	}
+	value, err := load()
+	if err == nil && key != "" {
+		c.set(endpoint, key, value)
+	}
+	return value, err
+}
+
+// 视频按 bvid 缓存，只有 avid 时使用 av 号
+func videoKey(param bilibili.VideoParam) string {
+	if param.Bvid != "" {
+		return param.Bvid
+	}
+	if param.Aid > 0 {
+		return "av" + strconv.Itoa(param.Aid)
+	}
+	return ""
+}
+
+func videoParams(param bilibili.VideoParam) map[string]string {
+	if param.Bvid != "" {
+		return map[string]string{"bvid": param.Bvid}
+	}
+	return map[string]string{"aid": strconv.Itoa(param.Aid)}
+}
+
+func midKey(mid int64) string {
+	return strconv.FormatInt(mid, 10)
+}
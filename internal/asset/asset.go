@@ -0,0 +1,296 @@
+// Package asset 负责封面、头像等图片资源的下载与本地存储。
+// 图片按内容的 sha256 存放在 {base_dir}/assets 下，相同内容只保存一份
+package asset
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/panedioic/bilibili-favlist-syncer/internal/config"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/db"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/storage"
+	"github.com/panedioic/bilibili-favlist-syncer/utils"
+	"go.uber.org/zap"
+)
+
+// 资源类型
+const (
+	KindCover        = "cover"
+	KindFace         = "face"
+	KindFavlistCover = "favlist_cover"
+)
+
+const (
+	statusOK     = "ok"
+	statusFailed = "failed"
+
+	// 同一远程地址连续失败超过该次数后，补齐任务不再尝试
+	maxBackfillAttempts = 5
+	backfillBatchSize   = 200
+)
+
+var (
+	errNotImage = errors.New("响应内容不是图片")
+	errTooLarge = errors.New("图片超过大小上限")
+)
+
+type Manager struct {
+	cfg    *config.Config
+	logger utils.Logger
+	db     *db.DB
+	st     storage.Storage
+	client *http.Client
+}
+
+func NewManager(cfg *config.Config, logger utils.Logger, database *db.DB, st storage.Storage, client *http.Client) *Manager {
+	return &Manager{
+		cfg:    cfg,
+		logger: logger,
+		db:     database,
+		st:     st,
+		client: client,
+	}
+}
+
+// Fetch 下载资源并返回供前端访问的本地地址，失败时按配置重试，结果记录到 asset 表
+func (m *Manager) Fetch(ctx context.Context, kind, ownerKey, url string) (string, error) {
+	record := &db.Asset{Kind: kind, OwnerKey: ownerKey, URL: url}
+	if old, err := m.db.GetAsset(kind, ownerKey); err == nil {
+		// 下载失败时保留上一份成功的内容
+		record.Hash, record.Path, record.Size, record.ContentType = old.Hash, old.Path, old.Size, old.ContentType
+		if old.URL == url {
+			record.Attempts = old.Attempts
+		}
+	}
+
+	path, err := m.fetchWithRetry(ctx, record)
+	if err != nil {
+		record.Status = statusFailed
+		record.Attempts++
+		record.LastError = err.Error()
+		if err := m.db.SaveAsset(record); err != nil {
+			m.logger.Warn("写入资源记录失败", zap.String("kind", kind), zap.String("key", ownerKey), zap.Error(err))
+		}
+		return "", err
+	}
+
+	record.Status = statusOK
+	record.Attempts = 0
+	if err := m.db.SaveAsset(record); err != nil {
+		return "", err
+	}
+	m.generateThumbnails(record.Hash, path)
+	return m.publicURL(path), nil
+}
+
+// 下载视频封面并更新视频记录
+func (m *Manager) FetchCover(ctx context.Context, bvid, url string) (string, error) {
+	local, err := m.Fetch(ctx, KindCover, bvid, url)
+	if err != nil {
+		return "", err
+	}
+	return local, m.db.UpdateVideoCover(bvid, local)
+}
+
+// 下载 UP 主头像并更新 UP 主记录
+func (m *Manager) FetchFace(ctx context.Context, uid int64, url string) (string, error) {
+	local, err := m.Fetch(ctx, KindFace, strconv.FormatInt(uid, 10), url)
+	if err != nil {
+		return "", err
+	}
+	return local, m.db.UpdateUploaderFace(uid, local)
+}
+
+// 下载收藏夹封面并更新收藏夹记录
+func (m *Manager) FetchFavlistCover(ctx context.Context, id int64, url string) (string, error) {
+	local, err := m.Fetch(ctx, KindFavlistCover, strconv.FormatInt(id, 10), url)
+	if err != nil {
+		return "", err
+	}
+	return local, m.db.UpdateFavlistCover(id, local)
+}
+
+func (m *Manager) fetchWithRetry(ctx context.Context, record *db.Asset) (string, error) {
+	retry := m.cfg.Asset.Retry
+	var lastErr error
+	for attempt := 1; attempt <= max(retry.MaxAttempts, 1); attempt++ {
+		path, err := m.download(ctx, record)
+		if err == nil {
+			return path, nil
+		}
+		lastErr = err
+		// 内容类型或大小不符时重试没有意义
+		if errors.Is(err, errNotImage) || errors.Is(err, errTooLarge) {
+			break
+		}
+		if attempt < retry.MaxAttempts {
+			select {
+			case <-ctx.Done():
+				return "", ctx.Err()
+			case <-time.After(retry.Backoff):
+			}
+		}
+	}
+	return "", lastErr
+}
+
+// 下载到临时文件，校验后按内容哈希落盘
+func (m *Manager) download(ctx context.Context, record *db.Asset) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, record.URL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+	req.Header.Set("Referer", "https://www.bilibili.com/")
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("状态码: %d", resp.StatusCode)
+	}
+
+	limit := int64(m.cfg.Asset.MaxSize) << 20
+	if limit > 0 && resp.ContentLength > limit {
+		return "", errTooLarge
+	}
+
+	dir := m.dir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(dir, "*.part")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	// 先读出文件头判断类型，部分 CDN 返回的 Content-Type 不准确
+	head := make([]byte, 512)
+	n, err := io.ReadFull(resp.Body, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		tmp.Close()
+		return "", err
+	}
+	head = head[:n]
+	contentType := imageType(resp.Header.Get("Content-Type"), head)
+	if contentType == "" {
+		tmp.Close()
+		return "", errNotImage
+	}
+
+	hasher := sha256.New()
+	body := io.MultiReader(bytes.NewReader(head), resp.Body)
+	if limit > 0 {
+		body = io.LimitReader(body, limit+1)
+	}
+	size, err := io.Copy(io.MultiWriter(tmp, hasher), body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	if limit > 0 && size > limit {
+		return "", errTooLarge
+	}
+
+	hash := hex.EncodeToString(hasher.Sum(nil))
+	path, err := m.store(tmp.Name(), hash, contentType)
+	if err != nil {
+		return "", err
+	}
+	record.Hash = hash
+	record.Path = path
+	record.Size = size
+	record.ContentType = contentType
+	m.publish(ctx, path)
+	return path, nil
+}
+
+// 将图片写入存储后端，本地副本始终保留用于生成缩略图，失败只记录日志
+func (m *Manager) publish(ctx context.Context, path string) {
+	key, err := storage.KeyFor(storage.BaseDir(m.cfg), path)
+	if err != nil {
+		return
+	}
+	if err := storage.Upload(ctx, m.st, key, path, m.cfg.Storage.Retry); err != nil {
+		m.logger.Warn("上传图片失败", zap.String("key", key), zap.Error(err))
+	}
+}
+
+// 按内容哈希保存临时文件，已有相同内容时直接复用
+func (m *Manager) store(tmp, hash, contentType string) (string, error) {
+	existing, err := m.db.FindAssetPathByHash(hash)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	if existing != "" {
+		if _, err := os.Stat(existing); err == nil {
+			return existing, nil
+		}
+	}
+
+	path := filepath.Join(m.dir(), hash[:2], hash+extension(contentType))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func (m *Manager) dir() string {
+	return filepath.Join(m.cfg.Download.BaseDir, "assets")
+}
+
+// 将本地路径转换为 /downloads 下的访问地址
+func (m *Manager) publicURL(path string) string {
+	rel, err := filepath.Rel(m.cfg.Download.BaseDir, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return ""
+	}
+	return "/downloads/" + filepath.ToSlash(rel)
+}
+
+// 判断响应是否为图片，优先使用响应头，否则根据文件头推断
+func imageType(header string, head []byte) string {
+	ct := strings.TrimSpace(strings.SplitN(header, ";", 2)[0])
+	if strings.HasPrefix(ct, "image/") {
+		return ct
+	}
+	if sniffed := http.DetectContentType(head); strings.HasPrefix(sniffed, "image/") {
+		return sniffed
+	}
+	return ""
+}
+
+func extension(contentType string) string {
+	switch contentType {
+	case "image/jpeg", "image/jpg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "image/webp":
+		return ".webp"
+	case "image/gif":
+		return ".gif"
+	case "image/avif":
+		return ".avif"
+	}
+	return ".img"
+}
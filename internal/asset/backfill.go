@@ -0,0 +1,65 @@
+package asset
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Run 定期补齐缺失的封面、头像和收藏夹封面，启动时立即执行一次
+func (m *Manager) Run(ctx context.Context) {
+	interval := m.cfg.Asset.BackfillInterval
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		m.Backfill(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Backfill 补齐一批缺失的资源，返回成功数量
+func (m *Manager) Backfill(ctx context.Context) int {
+	missing, err := m.db.ListMissingAssets(maxBackfillAttempts, backfillBatchSize)
+	if err != nil {
+		m.logger.Warn("查询缺失资源失败", zap.Error(err))
+		return 0
+	}
+	if len(missing) == 0 {
+		return 0
+	}
+
+	done := 0
+	for _, item := range missing {
+		if ctx.Err() != nil {
+			break
+		}
+		var err error
+		switch item.Kind {
+		case KindCover:
+			_, err = m.FetchCover(ctx, item.OwnerKey, item.URL)
+		case KindFace:
+			uid, _ := strconv.ParseInt(item.OwnerKey, 10, 64)
+			_, err = m.FetchFace(ctx, uid, item.URL)
+		case KindFavlistCover:
+			id, _ := strconv.ParseInt(item.OwnerKey, 10, 64)
+			_, err = m.FetchFavlistCover(ctx, id, item.URL)
+		}
+		if err != nil {
+			m.logger.Warn("补齐资源失败", zap.String("kind", item.Kind), zap.String("key", item.OwnerKey), zap.Error(err))
+			continue
+		}
+		done++
+	}
+	m.logger.Info("资源补齐完成", zap.Int("total", len(missing)), zap.Int("success", done))
+	return done
+}
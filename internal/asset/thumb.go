@@ -0,0 +1,167 @@
+package asset
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/panedioic/bilibili-favlist-syncer/internal/db"
+	"go.uber.org/zap"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+var (
+	ErrInvalidWidth = errors.New("不支持的缩略图宽度")
+	ErrNotFound     = errors.New("资源不存在")
+)
+
+// Thumbnail 返回资源指定宽度的缩略图路径和 ETag，缩略图不存在时即时生成
+func (m *Manager) Thumbnail(kind, ownerKey string, width int) (string, string, error) {
+	if !slices.Contains(m.cfg.Asset.Thumbnail.Widths, width) {
+		return "", "", ErrInvalidWidth
+	}
+
+	a, err := m.db.GetAsset(kind, ownerKey)
+	if err == sql.ErrNoRows {
+		a, err = m.adoptLegacy(kind, ownerKey)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	if a.Hash == "" || a.Path == "" {
+		return "", "", ErrNotFound
+	}
+
+	path := m.thumbnailPath(a.Hash, width)
+	if _, err := os.Stat(path); err != nil {
+		if err := m.generateThumbnail(a.Path, path, width); err != nil {
+			return "", "", err
+		}
+	}
+	return path, `"` + a.Hash[:16] + "-" + strconv.Itoa(width) + `"`, nil
+}
+
+// 预先生成所有配置宽度的缩略图，失败时仅记录日志，请求时会再次尝试
+func (m *Manager) generateThumbnails(hash, src string) {
+	for _, width := range m.cfg.Asset.Thumbnail.Widths {
+		path := m.thumbnailPath(hash, width)
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+		if err := m.generateThumbnail(src, path, width); err != nil {
+			m.logger.Warn("生成缩略图失败", zap.String("src", src), zap.Int("width", width), zap.Error(err))
+			return
+		}
+	}
+}
+
+func (m *Manager) thumbnailPath(hash string, width int) string {
+	return filepath.Join(m.dir(), "thumbs", strconv.Itoa(width), hash[:2], hash+".jpg")
+}
+
+// 按宽度等比缩放，原图更窄时不放大
+func (m *Manager) generateThumbnail(src, dst string, width int) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	img, _, err := image.Decode(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("解码图片失败: %w", err)
+	}
+
+	bounds := img.Bounds()
+	if bounds.Dx() > width {
+		height := max(bounds.Dy()*width/bounds.Dx(), 1)
+		scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.CatmullRom.Scale(scaled, scaled.Bounds(), img, bounds, draw.Src, nil)
+		img = scaled
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "*.part")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	err = jpeg.Encode(tmp, img, &jpeg.Options{Quality: m.cfg.Asset.Thumbnail.Quality})
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// 早期版本直接保存在 covers/faces 目录下的图片没有资源记录，首次访问时补登记
+func (m *Manager) adoptLegacy(kind, ownerKey string) (*db.Asset, error) {
+	var local, remote string
+	switch kind {
+	case KindCover:
+		v, err := m.db.GetVideoByBVID(ownerKey)
+		if err != nil {
+			return nil, ErrNotFound
+		}
+		local, remote = v.Cover, v.CoverURL
+	case KindFace:
+		uid, err := strconv.ParseInt(ownerKey, 10, 64)
+		if err != nil {
+			return nil, ErrNotFound
+		}
+		u, err := m.db.GetUploader(uid)
+		if err != nil {
+			return nil, ErrNotFound
+		}
+		local, remote = u.Face, u.FaceURL
+	default:
+		return nil, ErrNotFound
+	}
+	// 在 Windows 上保存的旧记录使用反斜杠分隔
+	local = strings.ReplaceAll(local, "\\", "/")
+	if !strings.HasPrefix(local, "/downloads/") {
+		return nil, ErrNotFound
+	}
+	path := filepath.Join(m.cfg.Download.BaseDir, filepath.FromSlash(strings.TrimPrefix(local, "/downloads/")))
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	defer f.Close()
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, f)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &db.Asset{
+		Kind:     kind,
+		OwnerKey: ownerKey,
+		URL:      remote,
+		Hash:     hex.EncodeToString(hasher.Sum(nil)),
+		Path:     path,
+		Size:     size,
+		Status:   statusOK,
+	}
+	if err := m.db.SaveAsset(a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
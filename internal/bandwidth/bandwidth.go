@@ -0,0 +1,163 @@
+// Package bandwidth 实现下载限速：所有任务共享一个全局令牌桶，每个任务另有自己的令牌桶。
+// 限速可以按时段变化，也可以在运行时修改
+package bandwidth
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/panedioic/bilibili-favlist-syncer/internal/config"
+)
+
+// 单次读取的上限，避免一次取走过多令牌导致速度波动
+const maxChunk = 32 * 1024
+
+// Limits 为某一时刻生效的限速，单位 KB/s，0 表示不限速
+type Limits struct {
+	Global  int
+	PerTask int
+}
+
+type Limiter struct {
+	mu     sync.RWMutex
+	cfg    config.RateLimitConfig
+	global *bucket
+	now    func() time.Time
+}
+
+func New(cfg config.RateLimitConfig) *Limiter {
+	return &Limiter{cfg: cfg, global: &bucket{}, now: time.Now}
+}
+
+// Config 返回当前的限速配置
+func (l *Limiter) Config() config.RateLimitConfig {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	cfg := l.cfg
+	cfg.Schedules = append([]config.RateSchedule(nil), l.cfg.Schedules...)
+	return cfg
+}
+
+// Update 替换限速配置，正在进行的下载在下一次读取时生效
+func (l *Limiter) Update(cfg config.RateLimitConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cfg = cfg
+	return nil
+}
+
+// Current 返回当前时刻生效的限速，以及匹配到的时段（未匹配时为 nil）
+func (l *Limiter) Current() (Limits, *config.RateSchedule) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	now := l.now()
+	for i := range l.cfg.Schedules {
+		s := l.cfg.Schedules[i]
+		if s.Contains(now) {
+			return Limits{Global: s.Global, PerTask: s.PerTask}, &s
+		}
+	}
+	return Limits{Global: l.cfg.Global, PerTask: l.cfg.PerTask}, nil
+}
+
+// TaskInterval 返回每个任务结束后的等待时间
+func (l *Limiter) TaskInterval() time.Duration {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.cfg.TaskInterval
+}
+
+// Reader 为单个任务包装限速读取
+func (l *Limiter) Reader(ctx context.Context, r io.Reader) io.Reader {
+	return l.Task().Reader(ctx, r)
+}
+
+// Task 创建单个任务的限速器，同一任务的多个连接共享单任务限速
+func (l *Limiter) Task() *Task {
+	return &Task{limiter: l, bucket: &bucket{}}
+}
+
+type Task struct {
+	limiter *Limiter
+	bucket  *bucket
+}
+
+// Reader 包装任务中一个连接的读取
+func (t *Task) Reader(ctx context.Context, r io.Reader) io.Reader {
+	return &reader{ctx: ctx, r: r, task: t}
+}
+
+type reader struct {
+	ctx  context.Context
+	r    io.Reader
+	task *Task
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	limiter := r.task.limiter
+	limits, _ := limiter.Current()
+	if limits.Global > 0 || limits.PerTask > 0 {
+		p = p[:min(len(p), maxChunk)]
+	}
+	n, err := r.r.Read(p)
+	if n <= 0 {
+		return n, err
+	}
+
+	now := limiter.now()
+	wait := max(
+		limiter.global.take(now, n, limits.Global),
+		r.task.bucket.take(now, n, limits.PerTask),
+	)
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-r.ctx.Done():
+			return n, r.ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return n, err
+}
+
+// bucket 为令牌桶，容量为一秒的流量。令牌不足时允许透支，
+// 由调用方等待透支部分按速率补齐
+type bucket struct {
+	mu     sync.Mutex
+	rate   int64 // 字节/秒
+	tokens float64
+	last   time.Time
+}
+
+// take 取走 n 个令牌，返回需要等待的时间。rate 单位为 KB/s，0 表示不限速
+func (b *bucket) take(now time.Time, n int, rate int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	bytesPerSec := int64(rate) * 1024
+	if bytesPerSec <= 0 {
+		b.rate, b.tokens, b.last = 0, 0, now
+		return 0
+	}
+	if b.rate != bytesPerSec || b.last.IsZero() {
+		// 限速变化后重新开始计量，避免沿用旧速率下的透支
+		b.rate, b.tokens, b.last = bytesPerSec, 0, now
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * float64(b.rate)
+	if b.tokens > float64(b.rate) {
+		b.tokens = float64(b.rate)
+	}
+	b.last = now
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / float64(b.rate) * float64(time.Second))
+}
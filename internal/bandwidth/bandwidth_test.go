@@ -0,0 +1,172 @@
+package bandwidth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/panedioic/bilibili-favlist-syncer/internal/config"
+)
+
+var t0 = time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local)
+
+func TestBucketTake(t *testing.T) {
+	type step struct {
+		after time.Duration // 距上一步的时间
+		n     int
+		rate  int // KB/s
+		want  time.Duration
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name:  "不限速",
+			steps: []step{{0, 1 << 20, 0, 0}, {0, 1 << 20, 0, 0}},
+		},
+		{
+			name: "透支部分按速率等待",
+			steps: []step{
+				{0, 1024, 1, time.Second},
+				{0, 512, 1, 1500 * time.Millisecond},
+			},
+		},
+		{
+			name: "等待后令牌补齐",
+			steps: []step{
+				{0, 1024, 1, time.Second},
+				{time.Second, 1024, 1, time.Second},
+			},
+		},
+		{
+			name: "空闲时最多积累一秒的令牌",
+			steps: []step{
+				{0, 0, 1, 0},
+				{time.Minute, 1024, 1, 0},
+				{0, 1024, 1, time.Second},
+			},
+		},
+		{
+			name: "限速变化后重新计量",
+			steps: []step{
+				{0, 4096, 1, 4 * time.Second},
+				{0, 2048, 2, time.Second},
+			},
+		},
+		{
+			name: "取消限速后清除透支",
+			steps: []step{
+				{0, 4096, 1, 4 * time.Second},
+				{0, 4096, 0, 0},
+				{0, 1024, 1, time.Second},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &bucket{}
+			now := t0
+			for i, s := range tt.steps {
+				now = now.Add(s.after)
+				if got := b.take(now, s.n, s.rate); got != s.want {
+					t.Errorf("第 %d 步 take = %v, want %v", i, got, s.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCurrent(t *testing.T) {
+	l := New(config.RateLimitConfig{
+		Global:  1000,
+		PerTask: 500,
+		Schedules: []config.RateSchedule{
+			{Start: "01:00", End: "07:00", Global: 0, PerTask: 0},
+			{Start: "22:00", End: "01:00", Global: 200, PerTask: 100},
+		},
+	})
+	tests := []struct {
+		clock    string
+		want     Limits
+		schedule string
+	}{
+		{"12:00", Limits{1000, 500}, ""},
+		{"01:00", Limits{0, 0}, "01:00"},
+		{"06:59", Limits{0, 0}, "01:00"},
+		{"07:00", Limits{1000, 500}, ""},
+		{"23:30", Limits{200, 100}, "22:00"},
+		{"00:30", Limits{200, 100}, "22:00"},
+	}
+	for _, tt := range tests {
+		clock, err := time.ParseInLocation("15:04", tt.clock, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		l.now = func() time.Time {
+			return time.Date(2024, 1, 1, clock.Hour(), clock.Minute(), 0, 0, time.Local)
+		}
+		got, s := l.Current()
+		var start string
+		if s != nil {
+			start = s.Start
+		}
+		if got != tt.want || start != tt.schedule {
+			t.Errorf("%s: Current = %+v, %q, want %+v, %q", tt.clock, got, start, tt.want, tt.schedule)
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	l := New(config.RateLimitConfig{Global: 100})
+	l.now = func() time.Time { return t0 }
+
+	if err := l.Update(config.RateLimitConfig{Global: -1}); err == nil {
+		t.Error("无效的配置应当返回错误")
+	}
+	if got, _ := l.Current(); got.Global != 100 {
+		t.Errorf("更新失败后 Global = %d, want 100", got.Global)
+	}
+
+	if err := l.Update(config.RateLimitConfig{Global: 50, PerTask: 10, TaskInterval: time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := l.Current(); got != (Limits{50, 10}) {
+		t.Errorf("Current = %+v", got)
+	}
+	if l.TaskInterval() != time.Second {
+		t.Errorf("TaskInterval = %v", l.TaskInterval())
+	}
+
+	// Config 返回副本，修改不影响限速器
+	cfg := l.Config()
+	cfg.Schedules = append(cfg.Schedules, config.RateSchedule{Start: "00:00", End: "23:59"})
+	if len(l.Config().Schedules) != 0 {
+		t.Error("修改 Config 的返回值影响了限速器")
+	}
+}
+
+func TestReader(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 3*maxChunk)
+
+	// 不限速时不拆分读取
+	l := New(config.RateLimitConfig{})
+	r := l.Reader(context.Background(), bytes.NewReader(data))
+	buf := make([]byte, len(data))
+	if n, err := r.Read(buf); n != len(data) || err != nil {
+		t.Errorf("Read = %d, %v", n, err)
+	}
+
+	// 限速时单次最多读取 maxChunk，需要等待时随 ctx 返回
+	l = New(config.RateLimitConfig{PerTask: 1})
+	l.now = func() time.Time { return t0 }
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r = l.Reader(ctx, bytes.NewReader(data))
+	n, err := r.Read(buf)
+	if n != maxChunk || !errors.Is(err, context.Canceled) {
+		t.Errorf("Read = %d, %v, want %d, context.Canceled", n, err, maxChunk)
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
 )
 
@@ -16,6 +15,8 @@ type Config struct {
 	Schedule ScheduleConfig `mapstructure:"schedule"`
 	Proxy    ProxyConfig    `mapstructure:"proxy"`
 	Log      LogConfig      `mapstructure:"log"`
+	Asset    AssetConfig    `mapstructure:"asset"`
+	Storage  StorageConfig  `mapstructure:"storage"`
 	Advanced AdvancedConfig `mapstructure:"advanced"`
 }
 
@@ -28,21 +29,142 @@ type AppConfig struct {
 
 type BilibiliConfig struct {
 	Cookies struct {
-		SESSDATA   string `mapstructure:"SESSDATA"`
-		BiliJCT    string `mapstructure:"bili_jct"`
+		SESSDATA   string `mapstructure:"SESSDATA" secret:"true"`
+		BiliJCT    string `mapstructure:"bili_jct" secret:"true"`
 		DedeUserID string `mapstructure:"DedeUserID"`
+		// 设备标识，留空时启动后自动获取
+		Buvid3 string `mapstructure:"buvid3"`
+		Buvid4 string `mapstructure:"buvid4"`
 	} `mapstructure:"cookies"`
 	UserAgent string `mapstructure:"user_agent"`
 }
 
 type DownloadConfig struct {
-	BaseDir       string        `mapstructure:"base_dir"`
-	Concurrent    int           `mapstructure:"concurrent"`
-	Retry         RetryConfig   `mapstructure:"retry"`
-	Timeout       time.Duration `mapstructure:"timeout"`
-	NamingPattern string        `mapstructure:"naming_pattern"`
-	Quality       string        `mapstructure:"quality"`
-	Format        string        `mapstructure:"format"`
+	BaseDir         string          `mapstructure:"base_dir"`
+	Concurrent      int             `mapstructure:"concurrent"`
+	Retry           RetryConfig     `mapstructure:"retry"`
+	Timeout         time.Duration   `mapstructure:"timeout"`          // 单个任务的总耗时上限，0 表示不限制
+	ResponseTimeout time.Duration   `mapstructure:"response_timeout"` // 单个请求建立连接并等待响应头的超时时间
+	NamingPattern   string          `mapstructure:"naming_pattern"`
+	Quality         string          `mapstructure:"quality"`
+	Format          string          `mapstructure:"format"`
+	Danmaku         DanmakuConfig   `mapstructure:"danmaku"`
+	Subtitle        SubtitleConfig  `mapstructure:"subtitle"`
+	Disk            DiskConfig      `mapstructure:"disk"`
+	Quota           QuotaConfig     `mapstructure:"quota"`
+	RateLimit       RateLimitConfig `mapstructure:"rate_limit"`
+	Segment         SegmentConfig   `mapstructure:"segment"`
+	StallTimeout    time.Duration   `mapstructure:"stall_timeout"` // 超过该时间收不到数据时切换下载节点
+}
+
+// 分段下载：服务器支持 Range 时将大文件拆分后多连接并行下载
+type SegmentConfig struct {
+	Connections int `mapstructure:"connections"` // 单个文件的连接数，1 表示不分段
+	MinSize     int `mapstructure:"min_size"`    // 小于该大小(MB)的文件不分段
+}
+
+// 下载限速，单位 KB/s，0 表示不限速
+type RateLimitConfig struct {
+	Global       int            `mapstructure:"global"`        // 所有任务合计的速度上限
+	PerTask      int            `mapstructure:"per_task"`      // 单个任务的速度上限
+	TaskInterval time.Duration  `mapstructure:"task_interval"` // 每个任务结束后的等待时间
+	Schedules    []RateSchedule `mapstructure:"schedules"`     // 按时段覆盖上面的限速
+}
+
+// 时段限速，Start 与 End 为 HH:MM，End 早于 Start 时表示跨越午夜
+type RateSchedule struct {
+	Start   string `mapstructure:"start"`
+	End     string `mapstructure:"end"`
+	Global  int    `mapstructure:"global"`
+	PerTask int    `mapstructure:"per_task"`
+}
+
+// Window 返回时段起止时间距离当天零点的分钟数
+func (s RateSchedule) Window() (int, int, error) {
+	start, err := parseClock(s.Start)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := parseClock(s.End)
+	if err != nil {
+		return 0, 0, err
+	}
+	return start, end, nil
+}
+
+// Contains 判断 t 是否处于该时段内
+func (s RateSchedule) Contains(t time.Time) bool {
+	start, end, err := s.Window()
+	if err != nil || start == end {
+		return false
+	}
+	now := t.Hour()*60 + t.Minute()
+	if start < end {
+		return now >= start && now < end
+	}
+	return now >= start || now < end
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("无效的时间: %q，应为 HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// 磁盘空间检查
+type DiskConfig struct {
+	LowWatermark  int           `mapstructure:"low_watermark"`  // 可用空间低于该值(MB)时暂停下载
+	Margin        int           `mapstructure:"margin"`         // 开始下载前要求可用空间比文件大小多出的余量(MB)
+	CheckInterval time.Duration `mapstructure:"check_interval"` // 暂停期间检查可用空间的间隔
+}
+
+// 已下载视频的存储配额，超出后不再下载新视频，0 表示不限制
+type QuotaConfig struct {
+	MaxSize  int            `mapstructure:"max_size"` // 所有视频的总上限(MB)
+	Favlists []FavlistQuota `mapstructure:"favlists"`
+}
+
+type FavlistQuota struct {
+	FavlistID int64 `mapstructure:"favlist_id"`
+	MaxSize   int   `mapstructure:"max_size"` // MB
+}
+
+// 返回收藏夹的配额(MB)，未配置时为 0
+func (q *QuotaConfig) FavlistMaxSize(favlistID int64) int {
+	for _, f := range q.Favlists {
+		if f.FavlistID == favlistID {
+			return f.MaxSize
+		}
+	}
+	return 0
+}
+
+type SubtitleConfig struct {
+	Enabled   bool     `mapstructure:"enabled"`
+	Languages []string `mapstructure:"languages"`  // 语言代码，如 zh-CN、en-US、ai-zh，为空表示全部
+	IncludeAI bool     `mapstructure:"include_ai"` // 是否下载AI生成的字幕
+	Formats   []string `mapstructure:"formats"`    // 额外转换的格式 (srt|vtt)，原始JSON总会保存
+}
+
+type DanmakuConfig struct {
+	Enabled bool      `mapstructure:"enabled"`
+	Formats []string  `mapstructure:"formats"` // xml、protobuf，可同时启用
+	ASS     ASSConfig `mapstructure:"ass"`
+}
+
+// 弹幕转换为 ASS 字幕时的排布参数
+type ASSConfig struct {
+	Enabled        bool          `mapstructure:"enabled"`
+	Width          int           `mapstructure:"width"`
+	Height         int           `mapstructure:"height"`
+	FontName       string        `mapstructure:"font_name"`
+	FontSize       int           `mapstructure:"font_size"`
+	Opacity        float64       `mapstructure:"opacity"`
+	ScrollDuration time.Duration `mapstructure:"scroll_duration"`
+	FixedDuration  time.Duration `mapstructure:"fixed_duration"`
+	DisplayArea    float64       `mapstructure:"display_area"`
 }
 
 type RetryConfig struct {
@@ -54,18 +176,99 @@ type ScheduleConfig struct {
 	SyncInterval time.Duration `mapstructure:"sync_interval"`
 	MaxHistory   int           `mapstructure:"max_history"`
 	Cleanup      CleanupConfig `mapstructure:"cleanup"`
+	// 定期比对下载目录与数据库，为 0 时不自动执行
+	ReconcileInterval time.Duration `mapstructure:"reconcile_interval"`
 }
 
+// 清理规则：全局规则写在 cleanup 下，favlists 中可按收藏夹覆盖部分字段
 type CleanupConfig struct {
-	Enabled  bool `mapstructure:"enabled"`
-	KeepDays int  `mapstructure:"keep_days"`
+	Enabled     bool          `mapstructure:"enabled"`
+	Interval    time.Duration `mapstructure:"interval"`
+	CleanupRule `mapstructure:",squash"`
+	Favlists    []FavlistCleanupRule `mapstructure:"favlists"`
+}
+
+type CleanupRule struct {
+	KeepDays    int  `mapstructure:"keep_days"`    // 从收藏夹移除后保留的天数，0 表示不按时间删除
+	KeepInvalid bool `mapstructure:"keep_invalid"` // 已失效的视频无法重新下载，始终保留
+	MaxSize     int  `mapstructure:"max_size"`     // 单个收藏夹的存储上限(MB)，超出时从最早收藏的开始删除，0 表示不限制
+}
+
+// 未填写的字段沿用全局规则
+type FavlistCleanupRule struct {
+	FavlistID   int64 `mapstructure:"favlist_id"`
+	KeepDays    *int  `mapstructure:"keep_days"`
+	KeepInvalid *bool `mapstructure:"keep_invalid"`
+	MaxSize     *int  `mapstructure:"max_size"`
+}
+
+// 返回收藏夹实际生效的规则
+func (c *CleanupConfig) RuleFor(favlistID int64) CleanupRule {
+	rule := c.CleanupRule
+	for _, r := range c.Favlists {
+		if r.FavlistID != favlistID {
+			continue
+		}
+		if r.KeepDays != nil {
+			rule.KeepDays = *r.KeepDays
+		}
+		if r.KeepInvalid != nil {
+			rule.KeepInvalid = *r.KeepInvalid
+		}
+		if r.MaxSize != nil {
+			rule.MaxSize = *r.MaxSize
+		}
+	}
+	return rule
 }
 
 type ProxyConfig struct {
-	Enabled bool     `mapstructure:"enabled"`
-	HTTP    string   `mapstructure:"http"`
-	HTTPS   string   `mapstructure:"https"`
-	Bypass  []string `mapstructure:"bypass"`
+	Enabled       bool          `mapstructure:"enabled"`
+	HTTP          string        `mapstructure:"http" secret:"url"` // 地址中的密码读取时隐藏
+	HTTPS         string        `mapstructure:"https" secret:"url"`
+	Bypass        []string      `mapstructure:"bypass"`
+	CheckInterval time.Duration `mapstructure:"check_interval"` // 检查代理是否可用的间隔
+}
+
+// 封面、头像等图片资源的下载配置
+type AssetConfig struct {
+	MaxSize          int             `mapstructure:"max_size"` // 单个图片大小上限(MB)
+	Retry            RetryConfig     `mapstructure:"retry"`
+	BackfillInterval time.Duration   `mapstructure:"backfill_interval"` // 补齐缺失资源的间隔
+	Thumbnail        ThumbnailConfig `mapstructure:"thumbnail"`
+}
+
+// 缩略图配置，按宽度等比缩放并输出为 JPEG（不支持 WebP 编码）
+type ThumbnailConfig struct {
+	Widths  []int `mapstructure:"widths"`
+	Quality int   `mapstructure:"quality"` // JPEG 质量 1-100
+}
+
+// 完成的视频、封面与元数据的存储位置，下载目录作为本地暂存区
+type StorageConfig struct {
+	Type          string        `mapstructure:"type"`       // local / s3 / webdav
+	KeepLocal     bool          `mapstructure:"keep_local"` // 上传到远程存储后保留本地视频文件
+	Timeout       time.Duration `mapstructure:"timeout"`    // 单次请求（含上传）的超时时间，0 表示不限制
+	Retry         RetryConfig   `mapstructure:"retry"`
+	RetryInterval time.Duration `mapstructure:"retry_interval"` // 重新上传失败文件的间隔，0 表示不自动重试
+	S3            S3Config      `mapstructure:"s3"`
+	WebDAV        WebDAVConfig  `mapstructure:"webdav"`
+}
+
+type S3Config struct {
+	Endpoint  string `mapstructure:"endpoint"`
+	Region    string `mapstructure:"region"`
+	Bucket    string `mapstructure:"bucket"`
+	AccessKey string `mapstructure:"access_key" secret:"true"`
+	SecretKey string `mapstructure:"secret_key" secret:"true"`
+	Prefix    string `mapstructure:"prefix"`     // 对象 key 前缀
+	PathStyle bool   `mapstructure:"path_style"` // 使用 endpoint/bucket/key 形式的地址，MinIO 等需要开启
+}
+
+type WebDAVConfig struct {
+	URL      string `mapstructure:"url"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password" secret:"true"`
 }
 
 type LogConfig struct {
@@ -78,13 +281,32 @@ type LogConfig struct {
 }
 
 type AdvancedConfig struct {
-	DebugMode   bool          `mapstructure:"debug_mode"`
-	EnablePprof bool          `mapstructure:"enable_pprof"`
-	CacheTTL    time.Duration `mapstructure:"cache_ttl"`
-	RateLimit   int           `mapstructure:"rate_limit"`
+	DebugMode    bool          `mapstructure:"debug_mode"`
+	EnablePprof  bool          `mapstructure:"enable_pprof"`
+	CacheTTL     time.Duration `mapstructure:"cache_ttl"` // B 站只读接口的默认缓存时间，0 表示不缓存
+	Cache        CacheConfig   `mapstructure:"cache"`
+	RateLimit    int           `mapstructure:"rate_limit"`     // 所有 B 站接口请求合计每秒的次数，0 表示不限制
+	APIRetry     RetryConfig   `mapstructure:"api_retry"`      // 接口请求失败或被限流时的重试，间隔按次数翻倍并加随机抖动
+	RiskPause    time.Duration `mapstructure:"risk_pause"`     // 触发风控(-412/-352)后暂停所有请求的时长，连续触发时翻倍
+	MaxRiskPause time.Duration `mapstructure:"max_risk_pause"` // 风控暂停的最长时间
+}
+
+// 接口缓存，cache_ttl 为所有接口的默认值
+type CacheConfig struct {
+	Persist    bool                     `mapstructure:"persist"`     // 同时写入数据库，重启后仍然有效
+	MaxEntries int                      `mapstructure:"max_entries"` // 内存中最多缓存的条目数
+	TTLs       map[string]time.Duration `mapstructure:"ttls"`        // 按接口覆盖缓存时间：video_info、video_pages、video_tags、user_card
 }
 
 func Load(path string) (*Config, error) {
+	v := newViper(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("读取配置文件失败: %w", err)
+	}
+	return decode(v)
+}
+
+func newViper(path string) *viper.Viper {
 	v := viper.New()
 
 	// 基础配置
@@ -95,17 +317,10 @@ func Load(path string) (*Config, error) {
 
 	// 设置默认值
 	setDefaults(v)
+	return v
+}
 
-	if err := v.ReadInConfig(); err != nil {
-		return nil, fmt.Errorf("读取配置文件失败: %w", err)
-	}
-
-	// 监听配置变化
-	v.WatchConfig()
-	v.OnConfigChange(func(e fsnotify.Event) {
-		fmt.Println("检测到配置文件变更:", e.Name)
-	})
-
+func decode(v *viper.Viper) (*Config, error) {
 	var cfg Config
 	if err := v.Unmarshal(&cfg); err != nil {
 		return nil, fmt.Errorf("解析配置失败: %w", err)
@@ -126,25 +341,65 @@ func setDefaults(v *viper.Viper) {
 
 	v.SetDefault("download.base_dir", "./downloads")
 	v.SetDefault("download.concurrent", 3)
+	v.SetDefault("download.quality", "1080p")
+	v.SetDefault("download.format", "mp4")
 	v.SetDefault("download.retry.max_attempts", 3)
 	v.SetDefault("download.retry.backoff", "2s")
-	v.SetDefault("download.timeout", "30s")
-}
+	v.SetDefault("download.timeout", "0s")
+	v.SetDefault("download.response_timeout", "30s")
 
-func (c *Config) Validate() error {
-	if c.Bilibili.Cookies.SESSDATA == "" {
-		return fmt.Errorf("必须配置 SESSDATA")
-	}
+	v.SetDefault("download.disk.low_watermark", 1024)
+	v.SetDefault("download.disk.margin", 512)
+	v.SetDefault("download.disk.check_interval", "1m")
+	v.SetDefault("download.stall_timeout", "30s")
+	v.SetDefault("download.segment.connections", 4)
+	v.SetDefault("download.segment.min_size", 8)
 
-	if c.Download.Concurrent <= 0 {
-		return fmt.Errorf("并发下载数必须大于 0")
-	}
+	v.SetDefault("download.danmaku.enabled", false)
+	v.SetDefault("download.danmaku.formats", []string{"xml", "protobuf"})
+	v.SetDefault("download.danmaku.ass.enabled", false)
+	v.SetDefault("download.danmaku.ass.width", 1920)
+	v.SetDefault("download.danmaku.ass.height", 1080)
+	v.SetDefault("download.danmaku.ass.font_name", "Microsoft YaHei")
+	v.SetDefault("download.danmaku.ass.font_size", 48)
+	v.SetDefault("download.danmaku.ass.opacity", 0.8)
+	v.SetDefault("download.danmaku.ass.scroll_duration", "10s")
+	v.SetDefault("download.danmaku.ass.fixed_duration", "5s")
+	v.SetDefault("download.danmaku.ass.display_area", 1.0)
+
+	v.SetDefault("schedule.cleanup.interval", "24h")
+	v.SetDefault("schedule.cleanup.keep_invalid", true)
+
+	v.SetDefault("asset.max_size", 10)
+	v.SetDefault("asset.retry.max_attempts", 3)
+	v.SetDefault("asset.retry.backoff", "2s")
+	v.SetDefault("asset.backfill_interval", "1h")
+	v.SetDefault("asset.thumbnail.widths", []int{160, 480})
+	v.SetDefault("asset.thumbnail.quality", 80)
+
+	v.SetDefault("proxy.check_interval", "5m")
+
+	v.SetDefault("log.level", "info")
+
+	v.SetDefault("advanced.cache_ttl", "24h")
+	v.SetDefault("advanced.cache.max_entries", 10000)
+	v.SetDefault("advanced.rate_limit", 10)
+	v.SetDefault("advanced.api_retry.max_attempts", 3)
+	v.SetDefault("advanced.api_retry.backoff", "1s")
+	v.SetDefault("advanced.risk_pause", "1m")
+	v.SetDefault("advanced.max_risk_pause", "30m")
 
-	// if c.Schedule.SyncInterval < time.Minute {
-	// 	return fmt.Errorf("同步间隔不能小于 1 分钟")
-	// }
+	v.SetDefault("storage.type", "local")
+	v.SetDefault("storage.keep_local", true)
+	v.SetDefault("storage.timeout", "30m")
+	v.SetDefault("storage.retry_interval", "1h")
+	v.SetDefault("storage.retry.max_attempts", 3)
+	v.SetDefault("storage.retry.backoff", "5s")
+	v.SetDefault("storage.s3.region", "us-east-1")
 
-	return nil
+	v.SetDefault("download.subtitle.enabled", false)
+	v.SetDefault("download.subtitle.include_ai", true)
+	v.SetDefault("download.subtitle.formats", []string{"srt", "vtt"})
 }
 
 // 安全打印配置（隐藏敏感信息）
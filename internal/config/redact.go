@@ -0,0 +1,46 @@
+package config
+
+import (
+	"net/url"
+	"reflect"
+)
+
+// RedactedValue 替换 Cookie、密钥等敏感字段的值
+const RedactedValue = "******"
+
+// Redacted 返回隐藏了敏感字段的副本，用于接口返回与日志。
+// 带 secret:"true" 标签的字段整体替换，secret:"url" 只把地址中的密码替换为 xxxxx
+func (c *Config) Redacted() *Config {
+	cp := *c
+	redact(reflect.ValueOf(&cp).Elem())
+	return &cp
+}
+
+func redact(v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := v.Field(i)
+		if !t.Field(i).IsExported() {
+			continue
+		}
+		switch {
+		case f.Kind() == reflect.Struct:
+			redact(f)
+		case f.Kind() == reflect.String && f.String() != "":
+			switch t.Field(i).Tag.Get("secret") {
+			case "true":
+				f.SetString(RedactedValue)
+			case "url":
+				f.SetString(redactURL(f.String()))
+			}
+		}
+	}
+}
+
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	return u.Redacted()
+}
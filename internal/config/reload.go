@@ -0,0 +1,104 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// 可以在运行时生效的配置项（含其下的所有子项），其余配置项变更后需要重启
+var hotReloadable = []string{
+	"schedule.sync_interval",
+	"download.concurrent",
+	"download.rate_limit",
+	"log.level",
+	"advanced.cache_ttl",
+	"advanced.cache.max_entries",
+	"advanced.cache.ttls",
+	"advanced.rate_limit",
+	"advanced.api_retry",
+	"advanced.risk_pause",
+	"advanced.max_risk_pause",
+}
+
+// Watch 监听配置文件，变更后重新读取并校验，结果交给 onChange。
+// 读取或校验失败时 cfg 为 nil
+func Watch(path string, onChange func(cfg *Config, err error)) error {
+	v := newViper(path)
+	if err := v.ReadInConfig(); err != nil {
+		return fmt.Errorf("读取配置文件失败: %w", err)
+	}
+	v.OnConfigChange(func(e fsnotify.Event) {
+		onChange(decode(v))
+	})
+	v.WatchConfig()
+	return nil
+}
+
+// Diff 返回两份配置中取值不同的配置项路径，例如 download.concurrent
+func Diff(old, new *Config) []string {
+	var changed []string
+	diffValue("", reflect.ValueOf(*old), reflect.ValueOf(*new), &changed)
+	return changed
+}
+
+func diffValue(path string, a, b reflect.Value, changed *[]string) {
+	if a.Kind() != reflect.Struct {
+		if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			*changed = append(*changed, path)
+		}
+		return
+	}
+	t := a.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts := fieldKey(f)
+		if name == "-" {
+			continue
+		}
+		sub := path
+		if !(f.Anonymous && strings.Contains(opts, "squash")) {
+			sub = joinPath(path, name)
+		}
+		diffValue(sub, a.Field(i), b.Field(i), changed)
+	}
+}
+
+func joinPath(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+// RestartRequired 返回 changed 中不能在运行时生效的配置项
+func RestartRequired(changed []string) []string {
+	var result []string
+	for _, path := range changed {
+		if !isHotReloadable(path) {
+			result = append(result, path)
+		}
+	}
+	return result
+}
+
+func isHotReloadable(path string) bool {
+	return Changed([]string{path}, hotReloadable...)
+}
+
+// Changed 判断 changed 中是否有 prefixes 中的配置项或其下级配置项
+func Changed(changed []string, prefixes ...string) bool {
+	for _, path := range changed {
+		for _, p := range prefixes {
+			if path == p || strings.HasPrefix(path, p+".") {
+				return true
+			}
+		}
+	}
+	return false
+}
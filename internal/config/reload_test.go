@@ -0,0 +1,102 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	base := mustLoad(t, copyConfig(t, nil))
+	tests := []struct {
+		name string
+		edit func(c *Config)
+		want []string
+	}{
+		{
+			name: "没有修改",
+			edit: func(c *Config) {},
+		},
+		{
+			name: "嵌套的配置项",
+			edit: func(c *Config) {
+				c.Bilibili.Cookies.SESSDATA = "changed"
+				c.Advanced.APIRetry.Backoff += time.Second
+			},
+			want: []string{"bilibili.cookies.SESSDATA", "advanced.api_retry.backoff"},
+		},
+		{
+			name: "squash 的字段使用上级路径",
+			edit: func(c *Config) { c.Schedule.Cleanup.KeepDays++ },
+			want: []string{"schedule.cleanup.keep_days"},
+		},
+		{
+			name: "列表按整体比较",
+			edit: func(c *Config) {
+				c.Download.RateLimit.Schedules = append(c.Download.RateLimit.Schedules, RateSchedule{Start: "01:00", End: "02:00"})
+			},
+			want: []string{"download.rate_limit.schedules"},
+		},
+		{
+			name: "映射按整体比较",
+			edit: func(c *Config) {
+				c.Advanced.Cache.TTLs = map[string]time.Duration{"video_info": time.Hour}
+			},
+			want: []string{"advanced.cache.ttls"},
+		},
+		{
+			name: "空映射与未填写不同",
+			edit: func(c *Config) { c.Advanced.Cache.TTLs = map[string]time.Duration{} },
+			want: []string{"advanced.cache.ttls"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := mustLoad(t, copyConfig(t, nil))
+			tt.edit(cfg)
+			if got := Diff(base, cfg); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestartRequired(t *testing.T) {
+	changed := []string{
+		"log.level",
+		"download.rate_limit.schedules",
+		"advanced.api_retry.max_attempts",
+		"advanced.cache.persist",
+		"advanced.cache_ttl",
+		"download.quality",
+		"log.path",
+	}
+	want := []string{"advanced.cache.persist", "download.quality", "log.path"}
+	if got := RestartRequired(changed); !reflect.DeepEqual(got, want) {
+		t.Errorf("RestartRequired = %v, want %v", got, want)
+	}
+	if got := RestartRequired(nil); got != nil {
+		t.Errorf("RestartRequired(nil) = %v", got)
+	}
+}
+
+func TestChanged(t *testing.T) {
+	tests := []struct {
+		changed  []string
+		prefixes []string
+		want     bool
+	}{
+		{[]string{"advanced.cache_ttl"}, []string{"advanced.cache_ttl", "advanced.cache"}, true},
+		{[]string{"advanced.cache.ttls"}, []string{"advanced.cache"}, true},
+		{[]string{"advanced.cache_ttl"}, []string{"advanced.cache"}, false},
+		{[]string{"download.rate_limit"}, []string{"download.rate_limit.global"}, false},
+		{[]string{"log.path", "log.level"}, []string{"log.level"}, true},
+		{nil, []string{"log.level"}, false},
+		{[]string{"log.level"}, nil, false},
+	}
+	for _, tt := range tests {
+		if got := Changed(tt.changed, tt.prefixes...); got != tt.want {
+			t.Errorf("Changed(%v, %v) = %v, want %v", tt.changed, tt.prefixes, got, tt.want)
+		}
+	}
+}
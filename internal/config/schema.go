@@ -0,0 +1,202 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// 时长的格式，与 time.ParseDuration 一致，不允许负数
+const durationPattern = `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$|^0$`
+
+// 值为 0 的时长，requiredFields 中的时长不能匹配
+const zeroDurationPattern = `^(0+(\.0+)?(ns|us|µs|ms|s|m|h))+$|^0$`
+
+// Schema 生成配置文件的 JSON Schema（draft 2020-12），用于编辑器补全与生成设置页面。
+// descriptions 为配置项路径到说明的映射，通常由 Descriptions 从带注释的配置文件中提取
+func Schema(descriptions map[string]string) map[string]any {
+	v := viper.New()
+	setDefaults(v)
+	s := &schemaBuilder{descriptions: lowerKeys(descriptions), defaults: v.AllSettings()}
+
+	schema := s.build("", reflect.TypeOf(Config{}), reflect.StructField{})
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = "bilibili-favlist-syncer 配置"
+	return schema
+}
+
+type schemaBuilder struct {
+	descriptions map[string]string
+	defaults     map[string]any
+}
+
+// key 为不带列表下标的路径
+func (s *schemaBuilder) build(key string, t reflect.Type, field reflect.StructField) map[string]any {
+	schema := map[string]any{}
+	if desc, ok := s.descriptions[strings.ToLower(key)]; ok && key != "" {
+		schema["description"] = desc
+	}
+	if def, ok := Lookup(s.defaults, key); ok && key != "" {
+		if _, nested := def.(map[string]any); !nested {
+			schema["default"] = def
+		}
+	}
+	switch field.Tag.Get("secret") {
+	case "true":
+		schema["format"] = "password"
+		schema["writeOnly"] = true
+	case "url":
+		schema["format"] = "uri"
+	}
+
+	isRequired := isRequired(key)
+	if t == durationType {
+		schema["type"] = "string"
+		schema["pattern"] = durationPattern
+		if isRequired {
+			schema["not"] = map[string]any{"pattern": zeroDurationPattern}
+		}
+		return schema
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		for k, v := range s.build(key, t.Elem(), field) {
+			schema[k] = v
+		}
+	case reflect.Struct:
+		props := map[string]any{}
+		var required []string
+		s.properties(key, t, props, &required)
+		schema["type"] = "object"
+		schema["properties"] = props
+		schema["additionalProperties"] = false
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+	case reflect.Slice:
+		schema["type"] = "array"
+		item := s.build(key, t.Elem(), field)
+		delete(item, "description")
+		delete(item, "default")
+		schema["items"] = item
+		return schema
+	case reflect.Map:
+		schema["type"] = "object"
+		item := s.build(key, t.Elem(), field)
+		delete(item, "description")
+		delete(item, "default")
+		schema["additionalProperties"] = item
+		if key == "advanced.cache.ttls" {
+			schema["propertyNames"] = map[string]any{"enum": CacheEndpoints}
+		}
+	case reflect.Bool:
+		schema["type"] = "boolean"
+	case reflect.Int, reflect.Int64:
+		schema["type"] = "integer"
+		s.bounds(key, schema)
+	case reflect.Float64:
+		schema["type"] = "number"
+		s.bounds(key, schema)
+	case reflect.String:
+		schema["type"] = "string"
+		if allowed, ok := enums[key]; ok {
+			schema["enum"] = allowed
+		}
+		if isRequired {
+			schema["minLength"] = 1
+		}
+	}
+	return schema
+}
+
+func (s *schemaBuilder) properties(key string, t reflect.Type, props map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts := fieldKey(f)
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && strings.Contains(opts, "squash") {
+			s.properties(key, f.Type, props, required)
+			continue
+		}
+		path := joinPath(key, name)
+		props[name] = s.build(path, f.Type, f)
+		if isRequired(path) {
+			*required = append(*required, name)
+		}
+	}
+}
+
+func isRequired(key string) bool {
+	_, ok := requiredFields[key]
+	return ok
+}
+
+func (s *schemaBuilder) bounds(key string, schema map[string]any) {
+	l := limits[key]
+	if isRequired(key) && l.Min <= 0 {
+		schema["exclusiveMinimum"] = 0
+	} else {
+		schema["minimum"] = l.Min
+	}
+	if l.Max > 0 {
+		schema["maximum"] = l.Max
+	}
+}
+
+// Descriptions 从配置文件中提取每个配置项的注释作为说明，优先使用行尾注释
+func Descriptions(data []byte) (map[string]string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	result := make(map[string]string)
+	if len(doc.Content) > 0 {
+		collectComments("", doc.Content[0], result)
+	}
+	return result, nil
+}
+
+func collectComments(prefix string, node *yaml.Node, result map[string]string) {
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		k, v := node.Content[i], node.Content[i+1]
+		path := joinPath(prefix, k.Value)
+		for _, c := range []string{v.LineComment, k.LineComment, k.HeadComment} {
+			if text := cleanComment(c); text != "" {
+				result[path] = text
+				break
+			}
+		}
+		collectComments(path, v, result)
+	}
+}
+
+// 去掉注释符号与分隔线，多行注释合并为一行
+func cleanComment(c string) string {
+	var parts []string
+	for _, line := range strings.Split(c, "\n") {
+		line = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "#"))
+		if line == "" || strings.Trim(line, "=-") == "" {
+			continue
+		}
+		parts = append(parts, line)
+	}
+	return strings.Join(parts, " ")
+}
+
+func lowerKeys(m map[string]string) map[string]string {
+	result := make(map[string]string, len(m))
+	for k, v := range m {
+		result[strings.ToLower(k)] = v
+	}
+	return result
+}
@@ -0,0 +1,189 @@
+package config
+
+import (
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// schema 中的一个叶子配置项。key 不带列表下标，与 enums、limits 的键一致；
+// path 为校验错误中的路径；wrap 把叶子的值包装为 Merge 使用的部分更新
+type schemaLeaf struct {
+	key    string
+	path   string
+	schema map[string]any
+	wrap   func(any) map[string]any
+}
+
+func schemaLeaves(node map[string]any, key, path string, wrap func(any) any, visit func(schemaLeaf)) {
+	switch node["type"] {
+	case "object":
+		if props, ok := node["properties"].(map[string]any); ok {
+			for name, child := range props {
+				schemaLeaves(child.(map[string]any), joinPath(key, name), joinPath(path, name),
+					func(v any) any { return wrap(map[string]any{name: v}) }, visit)
+			}
+			return
+		}
+		if item, ok := node["additionalProperties"].(map[string]any); ok {
+			name := "entry"
+			if names, ok := node["propertyNames"].(map[string]any); ok {
+				name = names["enum"].([]string)[0]
+			}
+			schemaLeaves(item, key, joinPath(path, name),
+				func(v any) any { return wrap(map[string]any{name: v}) }, visit)
+		}
+	case "array":
+		schemaLeaves(node["items"].(map[string]any), key, path+"[0]",
+			func(v any) any { return wrap([]any{v}) }, visit)
+	default:
+		visit(schemaLeaf{key: key, path: path, schema: node, wrap: func(v any) map[string]any {
+			return wrap(v).(map[string]any)
+		}})
+	}
+}
+
+// 按路径查找 schema 节点，列表取其元素的 schema
+func schemaNode(schema map[string]any, key string) map[string]any {
+	node := schema
+	for _, name := range strings.Split(key, ".") {
+		props, _ := node["properties"].(map[string]any)
+		next, ok := props[name].(map[string]any)
+		if !ok {
+			return nil
+		}
+		node = next
+		if item, ok := node["items"].(map[string]any); ok {
+			node = item
+		}
+	}
+	return node
+}
+
+// limits、enums 与 requiredFields 中的每一项都必须对应 schema 中的配置项，并生成相同的约束
+func TestSchemaRules(t *testing.T) {
+	schema := Schema(nil)
+	for key, allowed := range enums {
+		node := schemaNode(schema, key)
+		if node == nil {
+			t.Errorf("enums 中的 %s 不是配置项", key)
+			continue
+		}
+		if !reflect.DeepEqual(node["enum"], allowed) {
+			t.Errorf("%s: schema enum = %v, want %v", key, node["enum"], allowed)
+		}
+	}
+	for key, l := range limits {
+		node := schemaNode(schema, key)
+		if node == nil {
+			t.Errorf("limits 中的 %s 不是配置项", key)
+			continue
+		}
+		if node["minimum"] != l.Min {
+			t.Errorf("%s: schema minimum = %v, want %v", key, node["minimum"], l.Min)
+		}
+		if max, ok := node["maximum"]; ok != (l.Max > 0) || (ok && max != l.Max) {
+			t.Errorf("%s: schema maximum = %v, want %v", key, max, l.Max)
+		}
+	}
+	for key := range requiredFields {
+		parent, name := schema, key
+		if i := strings.LastIndex(key, "."); i >= 0 {
+			parent, name = schemaNode(schema, key[:i]), key[i+1:]
+		}
+		if parent == nil || schemaNode(schema, key) == nil {
+			t.Errorf("requiredFields 中的 %s 不是配置项", key)
+			continue
+		}
+		if required, _ := parent["required"].([]string); !slices.Contains(required, name) {
+			t.Errorf("%s: 不在 schema 的 required 中: %v", key, required)
+		}
+	}
+}
+
+// 对 schema 中的每个配置项分别写入刚好越界与刚好合法的值，校验结果必须与 schema 的约束一致
+func TestSchemaAgreesWithValidate(t *testing.T) {
+	base := mustLoad(t, copyConfig(t, nil))
+	schema := Schema(nil)
+
+	var leaves []schemaLeaf
+	schemaLeaves(schema, "", "", func(v any) any { return v }, func(l schemaLeaf) { leaves = append(leaves, l) })
+	sort.Slice(leaves, func(i, j int) bool { return leaves[i].path < leaves[j].path })
+	if len(leaves) < 50 {
+		t.Fatalf("只找到 %d 个配置项", len(leaves))
+	}
+
+	// 写入 value 后该配置项是否报错
+	rejects := func(l schemaLeaf, value any) bool {
+		cfg, err := Merge(base, l.wrap(value))
+		if err != nil {
+			t.Fatalf("%s: Merge(%v): %v", l.path, value, err)
+		}
+		for _, fe := range fieldErrors(t, cfg) {
+			if fe.Path == l.path {
+				return true
+			}
+		}
+		return false
+	}
+	check := func(l schemaLeaf, value any, wantReject bool) {
+		if got := rejects(l, value); got != wantReject {
+			t.Errorf("%s = %v: Validate 报错 = %v，与 schema 不一致", l.path, value, got)
+		}
+	}
+
+	for _, l := range leaves {
+		s := l.schema
+		switch s["type"] {
+		case "integer", "number":
+			if min, ok := s["minimum"].(float64); ok {
+				check(l, min-1, true)
+				check(l, min, false)
+			}
+			if _, ok := s["exclusiveMinimum"]; ok {
+				check(l, 0, true)
+				check(l, 1, false)
+			}
+			if max, ok := s["maximum"].(float64); ok {
+				check(l, max+1, true)
+				check(l, max, false)
+			}
+		case "string":
+			if allowed, ok := s["enum"].([]string); ok {
+				check(l, "invalid-value", true)
+				for _, a := range allowed {
+					check(l, a, false)
+				}
+			}
+			if s["minLength"] == 1 {
+				check(l, "", true)
+			}
+			if s["pattern"] == durationPattern {
+				check(l, "-1s", true)
+				check(l, "1h", false)
+				_, notZero := s["not"]
+				check(l, "0s", notZero)
+			}
+		case "boolean":
+		default:
+			t.Errorf("%s: 未知的类型 %v", l.path, s["type"])
+		}
+	}
+}
+
+func TestZeroDurationPattern(t *testing.T) {
+	re := regexp.MustCompile(zeroDurationPattern)
+	for _, s := range []string{"0", "0s", "0m0s", "00h", "0.0s"} {
+		if !re.MatchString(s) {
+			t.Errorf("%q 应当匹配", s)
+		}
+	}
+	for _, s := range []string{"1s", "0.5s", "1m0s", "10ms"} {
+		if re.MatchString(s) {
+			t.Errorf("%q 不应匹配", s)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 字符串配置项的可选值，列表类型的配置项限制其中的每一项。校验与 JSON Schema 共用
+var enums = map[string][]string{
+	"download.quality":          {"360p", "480p", "720p", "1080p"},
+	"download.format":           {"mp4", "flv"},
+	"download.danmaku.formats":  {"xml", "protobuf"},
+	"download.subtitle.formats": {"srt", "vtt"},
+	"log.level":                 {"debug", "info", "warn", "error"},
+	"storage.type":              {"local", "s3", "webdav"},
+}
+
+// 数值配置项的取值范围，未列出的数值与时长只要求不为负数。校验与 JSON Schema 共用
+var limits = map[string]limit{
+	"app.port":                          {Min: 1, Max: 65535},
+	"download.concurrent":               {Min: 1},
+	"download.retry.max_attempts":       {Min: 1},
+	"download.segment.connections":      {Min: 1},
+	"download.danmaku.ass.opacity":      {Max: 1},
+	"download.danmaku.ass.display_area": {Max: 1},
+	"asset.thumbnail.widths":            {Min: 1},
+	"asset.thumbnail.quality":           {Min: 1, Max: 100},
+	"asset.retry.max_attempts":          {Min: 1},
+	"storage.retry.max_attempts":        {Min: 1},
+	"advanced.api_retry.max_attempts":   {Min: 1},
+}
+
+// 必须配置的配置项及未配置时的错误信息：字符串不能为空，数值与时长必须大于 0。
+// 列表中的配置项对每一项都要求。校验与 JSON Schema 共用
+var requiredFields = map[string]string{
+	"bilibili.cookies.SESSDATA":            "必须配置",
+	"schedule.sync_interval":               "必须大于 0", // time.NewTicker 不接受 0
+	"download.quota.favlists.favlist_id":   "必须填写收藏夹 ID",
+	"schedule.cleanup.favlists.favlist_id": "必须填写收藏夹 ID",
+}
+
+type limit struct {
+	Min float64
+	Max float64 // 0 表示不限制
+}
+
+// CacheEndpoints 为 advanced.cache.ttls 可以覆盖的接口
+var CacheEndpoints = []string{"video_info", "video_pages", "video_tags", "user_card"}
+
+// NamingPlaceholders 为 download.naming_pattern 中可以使用的占位符
+var NamingPlaceholders = []string{"title", "bvid", "uploader", "uid", "pubdate"}
+
+var proxySchemes = []string{"http", "https", "socks5", "socks5h"}
+
+// FieldError 为单个配置项的校验错误，Path 为配置文件中的路径，如 download.quota.favlists[0].max_size
+type FieldError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidationError 包含所有未通过校验的配置项，按路径排序
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		msgs[i] = fe.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+type validator struct {
+	errs []FieldError
+}
+
+func (v *validator) add(path, format string, args ...any) {
+	v.errs = append(v.errs, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	sort.SliceStable(v.errs, func(i, j int) bool { return v.errs[i].Path < v.errs[j].Path })
+	return &ValidationError{Errors: v.errs}
+}
+
+// Validate 检查所有配置项，返回的错误为 *ValidationError，包含每个错误配置项的路径
+func (c *Config) Validate() error {
+	var v validator
+	v.walk("", "", reflect.ValueOf(*c))
+
+	v.namingPattern("download.naming_pattern", c.Download.NamingPattern)
+	c.Download.RateLimit.validate(&v, "download.rate_limit")
+
+	v.proxyURL("proxy.http", c.Proxy.HTTP)
+	v.proxyURL("proxy.https", c.Proxy.HTTPS)
+	if c.Proxy.Enabled && c.Proxy.HTTP == "" && c.Proxy.HTTPS == "" {
+		v.add("proxy", "启用代理时必须配置 http 或 https")
+	}
+	for i, b := range c.Proxy.Bypass {
+		if strings.TrimSpace(b) == "" {
+			v.add(fmt.Sprintf("proxy.bypass[%d]", i), "不能为空")
+		}
+	}
+
+	switch c.Storage.Type {
+	case "s3":
+		if c.Storage.S3.Bucket == "" {
+			v.add("storage.s3.bucket", "使用 S3 存储时必须配置")
+		}
+		if c.Storage.S3.Endpoint != "" {
+			v.httpURL("storage.s3.endpoint", c.Storage.S3.Endpoint)
+		}
+	case "webdav":
+		if c.Storage.WebDAV.URL == "" {
+			v.add("storage.webdav.url", "使用 WebDAV 存储时必须配置")
+		} else {
+			v.httpURL("storage.webdav.url", c.Storage.WebDAV.URL)
+		}
+	}
+
+	for name := range c.Advanced.Cache.TTLs {
+		if !slices.Contains(CacheEndpoints, name) {
+			v.add("advanced.cache.ttls."+name, "未知的接口，可选: %s", strings.Join(CacheEndpoints, ", "))
+		}
+	}
+
+	return v.err()
+}
+
+// Validate 检查下载限速配置，返回的错误为 *ValidationError
+func (r *RateLimitConfig) Validate() error {
+	var v validator
+	v.walk("download.rate_limit", "download.rate_limit", reflect.ValueOf(*r))
+	r.validate(&v, "download.rate_limit")
+	return v.err()
+}
+
+func (r *RateLimitConfig) validate(v *validator, path string) {
+	for i, s := range r.Schedules {
+		p := fmt.Sprintf("%s.schedules[%d]", path, i)
+		if _, err := parseClock(s.Start); err != nil {
+			v.add(p+".start", "%v", err)
+		}
+		if _, err := parseClock(s.End); err != nil {
+			v.add(p+".end", "%v", err)
+		}
+	}
+}
+
+// 按字段类型检查：requiredFields 中的配置项必须配置，数值与时长不能为负数或超出 limits，
+// 字符串必须为 enums 中的值。path 带列表下标，key 不带下标，用于查找上述规则
+func (v *validator) walk(path, key string, val reflect.Value) {
+	if msg, ok := requiredFields[key]; ok {
+		if (val.Kind() == reflect.String && val.String() == "") || (val.CanInt() && val.Int() <= 0) {
+			v.add(path, "%s", msg)
+			return
+		}
+	}
+	if val.Type() == durationType {
+		if d := time.Duration(val.Int()); d < 0 {
+			v.add(path, "不能为负数")
+		}
+		return
+	}
+	switch val.Kind() {
+	case reflect.Pointer:
+		if !val.IsNil() {
+			v.walk(path, key, val.Elem())
+		}
+	case reflect.Struct:
+		t := val.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name, opts := fieldKey(f)
+			if name == "-" {
+				continue
+			}
+			if f.Anonymous && strings.Contains(opts, "squash") {
+				v.walk(path, key, val.Field(i))
+				continue
+			}
+			v.walk(joinPath(path, name), joinPath(key, name), val.Field(i))
+		}
+	case reflect.Slice:
+		for i := 0; i < val.Len(); i++ {
+			v.walk(fmt.Sprintf("%s[%d]", path, i), key, val.Index(i))
+		}
+	case reflect.Map:
+		iter := val.MapRange()
+		for iter.Next() {
+			name := fmt.Sprint(iter.Key().Interface())
+			v.walk(joinPath(path, name), key, iter.Value())
+		}
+	case reflect.Int, reflect.Int64, reflect.Float64:
+		n := val.Convert(reflect.TypeOf(float64(0))).Float()
+		l := limits[key]
+		switch {
+		case n < l.Min && l.Min == 0:
+			v.add(path, "不能为负数")
+		case n < l.Min:
+			v.add(path, "不能小于 %v", l.Min)
+		case l.Max > 0 && n > l.Max:
+			v.add(path, "不能大于 %v", l.Max)
+		}
+	case reflect.String:
+		if allowed, ok := enums[key]; ok && !slices.Contains(allowed, val.String()) {
+			v.add(path, "无效的值 %q，可选: %s", val.String(), strings.Join(allowed, ", "))
+		}
+	}
+}
+
+var placeholderPattern = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// 文件名格式只能使用 NamingPlaceholders 中的占位符，且括号成对
+func (v *validator) namingPattern(path, pattern string) {
+	if pattern == "" {
+		return
+	}
+	for _, m := range placeholderPattern.FindAllStringSubmatch(pattern, -1) {
+		if !slices.Contains(NamingPlaceholders, m[1]) {
+			v.add(path, "未知的占位符 {%s}，可选: {%s}", m[1], strings.Join(NamingPlaceholders, "}, {"))
+		}
+	}
+	if strings.ContainsAny(placeholderPattern.ReplaceAllString(pattern, ""), "{}") {
+		v.add(path, "花括号不成对")
+	}
+}
+
+func (v *validator) proxyURL(path, raw string) {
+	if raw == "" {
+		return
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		v.add(path, "无效的代理地址")
+		return
+	}
+	if !slices.Contains(proxySchemes, u.Scheme) {
+		v.add(path, "不支持的代理协议 %q，可选: %s", u.Scheme, strings.Join(proxySchemes, ", "))
+	}
+	// http 与 https 代理缺少端口时使用默认端口，socks5 必须指定
+	if strings.HasPrefix(u.Scheme, "socks5") {
+		if _, _, err := net.SplitHostPort(u.Host); err != nil {
+			v.add(path, "socks5 代理地址缺少端口")
+		}
+	}
+}
+
+func (v *validator) httpURL(path, raw string) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		v.add(path, "无效的地址，应为 http:// 或 https:// 开头")
+	}
+}
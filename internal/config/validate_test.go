@@ -0,0 +1,214 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 校验 cfg，返回所有错误。未通过校验时错误必须为 *ValidationError
+func fieldErrors(t *testing.T, cfg *Config) []FieldError {
+	t.Helper()
+	err := cfg.Validate()
+	if err == nil {
+		return nil
+	}
+	var ve *ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("Validate 返回的错误类型为 %T: %v", err, err)
+	}
+	return ve.Errors
+}
+
+func TestValidate(t *testing.T) {
+	type want struct {
+		path    string
+		message string // 错误信息中应包含的内容
+	}
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		want   []want
+	}{
+		{
+			name:   "默认配置",
+			modify: func(c *Config) {},
+		},
+		{
+			name:   "同步间隔为 0",
+			modify: func(c *Config) { c.Schedule.SyncInterval = 0 },
+			want:   []want{{"schedule.sync_interval", "必须大于 0"}},
+		},
+		{
+			name:   "同步间隔为负数",
+			modify: func(c *Config) { c.Schedule.SyncInterval = -1 },
+			want:   []want{{"schedule.sync_interval", "必须大于 0"}},
+		},
+		{
+			name:   "未配置 SESSDATA",
+			modify: func(c *Config) { c.Bilibili.Cookies.SESSDATA = "" },
+			want:   []want{{"bilibili.cookies.SESSDATA", "必须配置"}},
+		},
+		{
+			name: "无效的画质与格式",
+			modify: func(c *Config) {
+				c.Download.Quality = "4k"
+				c.Download.Format = "avi"
+			},
+			want: []want{
+				{"download.format", `无效的值 "avi"`},
+				{"download.quality", `无效的值 "4k"`},
+			},
+		},
+		{
+			name:   "列表中的无效值",
+			modify: func(c *Config) { c.Download.Danmaku.Formats = []string{"xml", "ass"} },
+			want:   []want{{"download.danmaku.formats[1]", `无效的值 "ass"`}},
+		},
+		{
+			name:   "文件名花括号不成对",
+			modify: func(c *Config) { c.Download.NamingPattern = "{title_{bvid}" },
+			want:   []want{{"download.naming_pattern", "花括号不成对"}},
+		},
+		{
+			name:   "文件名使用未知的占位符",
+			modify: func(c *Config) { c.Download.NamingPattern = "{title}_{foo}" },
+			want:   []want{{"download.naming_pattern", "未知的占位符 {foo}"}},
+		},
+		{
+			name:   "不支持的代理协议",
+			modify: func(c *Config) { c.Proxy.HTTP = "ftp://proxy.lan:21" },
+			want:   []want{{"proxy.http", `不支持的代理协议 "ftp"`}},
+		},
+		{
+			name:   "HTTP 代理使用默认端口",
+			modify: func(c *Config) { c.Proxy.HTTP = "http://proxy.lan" },
+		},
+		{
+			name:   "socks5 代理缺少端口",
+			modify: func(c *Config) { c.Proxy.HTTPS = "socks5://proxy.lan" },
+			want:   []want{{"proxy.https", "缺少端口"}},
+		},
+		{
+			name: "启用代理但未配置地址",
+			modify: func(c *Config) {
+				c.Proxy.Enabled = true
+				c.Proxy.HTTP = ""
+			},
+			want: []want{{"proxy", "必须配置 http 或 https"}},
+		},
+		{
+			name: "列表项的路径带下标",
+			modify: func(c *Config) {
+				c.Download.Quota.Favlists = []FavlistQuota{{FavlistID: 1, MaxSize: 100}, {MaxSize: -1}}
+			},
+			want: []want{
+				{"download.quota.favlists[1].favlist_id", "必须填写收藏夹 ID"},
+				{"download.quota.favlists[1].max_size", "不能为负数"},
+			},
+		},
+		{
+			name:   "收藏夹 ID 未填写",
+			modify: func(c *Config) { c.Download.Quota.Favlists = []FavlistQuota{{MaxSize: 100}} },
+			want:   []want{{"download.quota.favlists[0].favlist_id", "必须填写收藏夹 ID"}},
+		},
+		{
+			name: "限速时段格式错误",
+			modify: func(c *Config) {
+				c.Download.RateLimit.Schedules = []RateSchedule{{Start: "25:00", End: "07:00"}}
+			},
+			want: []want{{"download.rate_limit.schedules[0].start", "无效的时间"}},
+		},
+		{
+			name: "超出取值范围",
+			modify: func(c *Config) {
+				c.App.Port = 70000
+				c.Download.Concurrent = 0
+				c.Download.Danmaku.ASS.Opacity = 1.5
+			},
+			want: []want{
+				{"app.port", "不能大于 65535"},
+				{"download.concurrent", "不能小于 1"},
+				{"download.danmaku.ass.opacity", "不能大于 1"},
+			},
+		},
+		{
+			name: "重试次数为 0",
+			modify: func(c *Config) {
+				c.Download.Retry.MaxAttempts = 0
+				c.Asset.Retry.MaxAttempts = 0
+				c.Storage.Retry.MaxAttempts = 0
+				c.Advanced.APIRetry.MaxAttempts = 0
+			},
+			want: []want{
+				{"advanced.api_retry.max_attempts", "不能小于 1"},
+				{"asset.retry.max_attempts", "不能小于 1"},
+				{"download.retry.max_attempts", "不能小于 1"},
+				{"storage.retry.max_attempts", "不能小于 1"},
+			},
+		},
+		{
+			name:   "未知的缓存接口",
+			modify: func(c *Config) { c.Advanced.Cache.TTLs = map[string]time.Duration{"foo": time.Hour} },
+			want:   []want{{"advanced.cache.ttls.foo", "未知的接口"}},
+		},
+		{
+			name: "S3 存储缺少 bucket",
+			modify: func(c *Config) {
+				c.Storage.Type = "s3"
+				c.Storage.S3.Endpoint = "127.0.0.1:9000"
+			},
+			want: []want{
+				{"storage.s3.bucket", "必须配置"},
+				{"storage.s3.endpoint", "无效的地址"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := mustLoad(t, copyConfig(t, nil))
+			tt.modify(cfg)
+			got := fieldErrors(t, cfg)
+			if len(got) != len(tt.want) {
+				t.Fatalf("错误数 = %d, want %d: %v", len(got), len(tt.want), got)
+			}
+			// 错误按路径排序
+			for i, w := range tt.want {
+				if got[i].Path != w.path || !strings.Contains(got[i].Message, w.message) {
+					t.Errorf("错误[%d] = %s, want %s: …%s…", i, got[i], w.path, w.message)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadReportsFieldErrors(t *testing.T) {
+	path := copyConfig(t, func(s string) string {
+		s = strings.Replace(s, `sync_interval: "1m"`, `sync_interval: "0s"`, 1)
+		return strings.Replace(s, "quality: 1080p", "quality: 4k", 1)
+	})
+	_, err := Load(path)
+	var ve *ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("Load 返回的错误应包含 *ValidationError: %v", err)
+	}
+	var paths []string
+	for _, fe := range ve.Errors {
+		paths = append(paths, fe.Path)
+	}
+	if strings.Join(paths, ",") != "download.quality,schedule.sync_interval" {
+		t.Errorf("错误的配置项 = %v", paths)
+	}
+}
+
+func TestRateLimitValidate(t *testing.T) {
+	r := RateLimitConfig{Global: -1, Schedules: []RateSchedule{{Start: "01:00", End: "7"}}}
+	var ve *ValidationError
+	if err := r.Validate(); !errors.As(err, &ve) {
+		t.Fatalf("Validate = %v", err)
+	}
+	if len(ve.Errors) != 2 || ve.Errors[0].Path != "download.rate_limit.global" || ve.Errors[1].Path != "download.rate_limit.schedules[0].end" {
+		t.Errorf("错误 = %v", ve.Errors)
+	}
+}
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+)
+
+// Map 按配置文件中的键名把配置转换为嵌套的 map，时长转换为 "30m" 形式的字符串。
+// 接口返回的配置与部分更新都使用这种形式
+func (c *Config) Map() map[string]any {
+	return toValue(reflect.ValueOf(*c)).(map[string]any)
+}
+
+// Merge 把部分更新合并到 base 上，返回新的配置，base 不会被修改。
+// patch 的键与配置文件一致，未知的配置项返回错误。
+// 与脱敏后的值相同的字段视为未修改，客户端可以原样提交读取到的配置
+func Merge(base *Config, patch map[string]any) (*Config, error) {
+	patch = dropRedacted(patch, base.Redacted().Map(), base.Map())
+
+	v := viper.New()
+	if err := v.MergeConfigMap(base.Map()); err != nil {
+		return nil, fmt.Errorf("解析配置失败: %w", err)
+	}
+	if err := v.MergeConfigMap(patch); err != nil {
+		return nil, fmt.Errorf("解析配置失败: %w", err)
+	}
+	var cfg Config
+	if err := v.Unmarshal(&cfg, func(dc *mapstructure.DecoderConfig) { dc.ErrorUnused = true }); err != nil {
+		return nil, fmt.Errorf("解析配置失败: %w", err)
+	}
+	return &cfg, nil
+}
+
+// Lookup 按路径取出 Map 中的值，键名不区分大小写
+func Lookup(m map[string]any, path string) (any, bool) {
+	var cur any = m
+	for _, key := range strings.Split(path, ".") {
+		node, ok := cur.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = lookupKey(node, key); !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+func lookupKey(m map[string]any, key string) (any, bool) {
+	if v, ok := m[key]; ok {
+		return v, true
+	}
+	for k, v := range m {
+		if strings.EqualFold(k, key) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// FormatDuration 去掉 time.Duration.String 末尾为 0 的单位，例如 1h0m0s 输出为 1h
+func FormatDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func toValue(v reflect.Value) any {
+	if v.Type() == durationType {
+		return FormatDuration(time.Duration(v.Int()))
+	}
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		return toValue(v.Elem())
+	case reflect.Struct:
+		m := make(map[string]any)
+		structToMap(v, m)
+		return m
+	case reflect.Slice:
+		if v.IsNil() {
+			return []any{}
+		}
+		items := make([]any, v.Len())
+		for i := range items {
+			items[i] = toValue(v.Index(i))
+		}
+		return items
+	case reflect.Map:
+		m := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			m[fmt.Sprint(iter.Key().Interface())] = toValue(iter.Value())
+		}
+		return m
+	}
+	return v.Interface()
+}
+
+func structToMap(v reflect.Value, m map[string]any) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts := fieldKey(f)
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && strings.Contains(opts, "squash") {
+			structToMap(v.Field(i), m)
+			continue
+		}
+		if value := toValue(v.Field(i)); value != nil {
+			m[name] = value
+		}
+	}
+}
+
+// 字段在配置文件中的键名与 mapstructure 选项
+func fieldKey(f reflect.StructField) (string, string) {
+	name, opts, _ := strings.Cut(f.Tag.Get("mapstructure"), ",")
+	if name == "" {
+		name = strings.ToLower(f.Name)
+	}
+	return name, opts
+}
+
+// 去掉 patch 中与脱敏值相同、且脱敏值不同于真实值的字段
+func dropRedacted(patch, redacted, actual map[string]any) map[string]any {
+	result := make(map[string]any, len(patch))
+	for k, v := range patch {
+		r, _ := lookupKey(redacted, k)
+		a, _ := lookupKey(actual, k)
+		if sub, ok := v.(map[string]any); ok {
+			rm, _ := r.(map[string]any)
+			am, _ := a.(map[string]any)
+			result[k] = dropRedacted(sub, rm, am)
+			continue
+		}
+		if r != nil && reflect.DeepEqual(v, r) && !reflect.DeepEqual(r, a) {
+			continue
+		}
+		result[k] = v
+	}
+	return result
+}
@@ -0,0 +1,359 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Save 把 cfg 中 paths 对应的配置项写回配置文件，其余内容与注释保持不变。
+// 标量、映射中的条目与单行的列表直接在原行修改或插入新行；
+// 无法原地修改时重新编码整个文件，注释保留但对齐与空行可能变化
+func Save(path string, cfg *Config, paths []string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("读取配置文件失败: %w", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("解析配置文件失败: %w", err)
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return fmt.Errorf("配置文件格式错误: %s", path)
+	}
+	root := doc.Content[0]
+
+	values := cfg.Map()
+	ed := &lineEditor{lines: strings.Split(string(data), "\n"), inserts: make(map[int][]string)}
+	inPlace := true
+	for _, p := range paths {
+		value, _ := Lookup(values, p)
+		if !ed.set(root, strings.Split(p, "."), value) {
+			inPlace = false
+			break
+		}
+	}
+	if inPlace {
+		return writeFile(path, ed.bytes())
+	}
+
+	for _, p := range paths {
+		value, _ := Lookup(values, p)
+		if err := setNode(root, strings.Split(p, "."), value); err != nil {
+			return fmt.Errorf("写入配置项 %s 失败: %w", p, err)
+		}
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return fmt.Errorf("编码配置文件失败: %w", err)
+	}
+	return writeFile(path, buf.Bytes())
+}
+
+// 先写入临时文件再重命名，避免写到一半时被读取
+func writeFile(path string, data []byte) error {
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("写入配置文件失败: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("写入配置文件失败: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("写入配置文件失败: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return fmt.Errorf("写入配置文件失败: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("写入配置文件失败: %w", err)
+	}
+	return nil
+}
+
+// 按路径查找映射中的值节点，键名不区分大小写
+func findNode(node *yaml.Node, keys []string) *yaml.Node {
+	for _, key := range keys {
+		if node.Kind != yaml.MappingNode {
+			return nil
+		}
+		var next *yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if strings.EqualFold(node.Content[i].Value, key) {
+				next = node.Content[i+1]
+				break
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		node = next
+	}
+	return node
+}
+
+// 按路径设置值节点，缺少的映射逐级创建，原节点的注释保留
+func setNode(node *yaml.Node, keys []string, value any) error {
+	for i, key := range keys {
+		if node.Kind != yaml.MappingNode {
+			return fmt.Errorf("%s 不是映射", strings.Join(keys[:i], "."))
+		}
+		var next *yaml.Node
+		for j := 0; j+1 < len(node.Content); j += 2 {
+			if strings.EqualFold(node.Content[j].Value, key) {
+				next = node.Content[j+1]
+				break
+			}
+		}
+		if i == len(keys)-1 {
+			var encoded yaml.Node
+			if err := encoded.Encode(value); err != nil {
+				return err
+			}
+			if next == nil {
+				node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, &encoded)
+				return nil
+			}
+			encoded.HeadComment, encoded.LineComment, encoded.FootComment = next.HeadComment, next.LineComment, next.FootComment
+			if encoded.Kind == yaml.ScalarNode && next.Kind == yaml.ScalarNode && encoded.Tag == next.Tag {
+				encoded.Style = next.Style
+			}
+			*next = encoded
+			return nil
+		}
+		if next == nil {
+			next = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, next)
+		}
+		node = next
+	}
+	return nil
+}
+
+// 在原文件的行上修改配置。所有修改完成前行号不变，插入的行在输出时加入
+type lineEditor struct {
+	lines   []string
+	inserts map[int][]string // 在该行之后插入的行
+}
+
+func (ed *lineEditor) bytes() []byte {
+	out := make([]string, 0, len(ed.lines)+len(ed.inserts))
+	for i, line := range ed.lines {
+		out = append(out, line)
+		out = append(out, ed.inserts[i]...)
+	}
+	return []byte(strings.Join(out, "\n"))
+}
+
+// 原地设置 keys 对应的值，无法原地修改时返回 false
+func (ed *lineEditor) set(root *yaml.Node, keys []string, value any) bool {
+	node := findNode(root, keys)
+	if node == nil {
+		parent := findNode(root, keys[:len(keys)-1])
+		return parent != nil && ed.insert(parent, keys[len(keys)-1], value)
+	}
+	switch v := value.(type) {
+	case map[string]any:
+		// 只能修改与新增条目，文件中多出的条目无法原地删除
+		if node.Kind != yaml.MappingNode || node.Style&yaml.FlowStyle != 0 {
+			return false
+		}
+		for i := 0; i < len(node.Content); i += 2 {
+			if _, ok := lookupKey(v, node.Content[i].Value); !ok {
+				return false
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if !ed.set(node, []string{name}, v[name]) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		return ed.replaceFlow(node, v)
+	}
+	return ed.replaceScalar(node, value)
+}
+
+// 在映射末尾插入新的条目，映射必须为多行格式且已有条目
+func (ed *lineEditor) insert(parent *yaml.Node, key string, value any) bool {
+	if parent.Kind != yaml.MappingNode || parent.Style&yaml.FlowStyle != 0 || len(parent.Content) == 0 {
+		return false
+	}
+	last := parent.Content[len(parent.Content)-1]
+	if last.Kind != yaml.ScalarNode || last.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 {
+		return false
+	}
+	text, ok := formatScalar(value, 0)
+	if !ok {
+		return false
+	}
+	indent := strings.Repeat(" ", parent.Content[0].Column-1)
+	ed.inserts[last.Line-1] = append(ed.inserts[last.Line-1], indent+key+": "+text)
+	return true
+}
+
+// 替换单行的流式列表，例如 ["a", "b"]
+func (ed *lineEditor) replaceFlow(node *yaml.Node, items []any) bool {
+	if node.Kind != yaml.SequenceNode || node.Style&yaml.FlowStyle == 0 {
+		return false
+	}
+	parts := make([]string, len(items))
+	quoted := yaml.Style(0)
+	if len(node.Content) > 0 {
+		quoted = node.Content[0].Style & (yaml.DoubleQuotedStyle | yaml.SingleQuotedStyle)
+	}
+	for i, item := range items {
+		text, ok := formatScalar(item, quoted)
+		if !ok {
+			return false
+		}
+		parts[i] = text
+	}
+	return ed.replace(node, "["+strings.Join(parts, ", ")+"]", flowEnd)
+}
+
+// 替换单行标量，保留引号风格
+func (ed *lineEditor) replaceScalar(node *yaml.Node, value any) bool {
+	if node.Kind != yaml.ScalarNode || node.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 {
+		return false
+	}
+	text, ok := formatScalar(value, node.Style)
+	if !ok {
+		return false
+	}
+	return ed.replace(node, text, func(line string, start int) (int, bool) {
+		return scalarEnd(line, start, node.Style)
+	})
+}
+
+// 用 text 替换节点在行中的原值，行尾注释尽量保持在原来的列
+func (ed *lineEditor) replace(node *yaml.Node, text string, end func(line string, start int) (int, bool)) bool {
+	if node.Line < 1 || node.Line > len(ed.lines) {
+		return false
+	}
+	line := ed.lines[node.Line-1]
+	start := node.Column - 1
+	if start < 0 || start > len(line) || strings.ContainsRune(line[:start], '\t') {
+		return false
+	}
+	stop, ok := end(line, start)
+	if !ok {
+		return false
+	}
+
+	rest := line[stop:]
+	trimmed := strings.TrimLeft(rest, " ")
+	if strings.HasPrefix(trimmed, "#") {
+		pad := len(rest) - len(trimmed) - (len(text) - (stop - start))
+		rest = strings.Repeat(" ", max(pad, 1)) + trimmed
+	}
+	ed.lines[node.Line-1] = line[:start] + text + rest
+	return true
+}
+
+// 流式列表在行中结束的位置，列表跨行时返回 false
+func flowEnd(line string, start int) (int, bool) {
+	depth := 0
+	var quote byte
+	for i := start; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+			if depth == 0 {
+				return i + 1, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// 原值在行中结束的位置
+func scalarEnd(line string, start int, style yaml.Style) (int, bool) {
+	if start >= len(line) {
+		return start, true
+	}
+	switch {
+	case style&yaml.DoubleQuotedStyle != 0:
+		for i := start + 1; i < len(line); i++ {
+			switch line[i] {
+			case '\\':
+				i++
+			case '"':
+				return i + 1, true
+			}
+		}
+		return 0, false
+	case style&yaml.SingleQuotedStyle != 0:
+		for i := start + 1; i < len(line); i++ {
+			if line[i] == '\'' {
+				if i+1 < len(line) && line[i+1] == '\'' {
+					i++
+					continue
+				}
+				return i + 1, true
+			}
+		}
+		return 0, false
+	}
+	end := len(line)
+	if i := strings.Index(line[start:], " #"); i >= 0 {
+		end = start + i
+	}
+	return start + len(strings.TrimRight(line[start:end], " ")), true
+}
+
+// 把值编码为单行 YAML 标量，原值带引号时沿用引号
+func formatScalar(value any, style yaml.Style) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		switch {
+		case style&yaml.DoubleQuotedStyle != 0:
+			b, _ := json.Marshal(v)
+			return string(b), true
+		case style&yaml.SingleQuotedStyle != 0:
+			return "'" + strings.ReplaceAll(v, "'", "''") + "'", true
+		}
+	case map[string]any, []any, nil:
+		return "", false
+	}
+	b, err := yaml.Marshal(value)
+	if err != nil {
+		return "", false
+	}
+	text := strings.TrimSuffix(string(b), "\n")
+	if strings.Contains(text, "\n") {
+		return "", false
+	}
+	return text, true
+}
@@ -0,0 +1,230 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 把仓库中的 configs/config.yaml 复制到临时目录，edit 非空时先修改内容
+func copyConfig(t *testing.T, edit func(string) string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("..", "..", "configs", "config.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := string(data)
+	if edit != nil {
+		content = edit(content)
+	}
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func mustLoad(t *testing.T, path string) *Config {
+	t.Helper()
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	return cfg
+}
+
+func mustMerge(t *testing.T, base *Config, patch map[string]any) *Config {
+	t.Helper()
+	cfg, err := Merge(base, patch)
+	if err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+	return cfg
+}
+
+// 保存 cfg 相对 base 的修改，重新读取后应与 cfg 完全一致，返回保存后的文件内容
+func saveAndReload(t *testing.T, path string, base, cfg *Config) string {
+	t.Helper()
+	changed := Diff(base, cfg)
+	if len(changed) == 0 {
+		t.Fatal("没有需要保存的修改")
+	}
+	if err := Save(path, cfg, changed); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if diff := Diff(cfg, mustLoad(t, path)); len(diff) != 0 {
+		t.Errorf("重新读取后不一致的配置项: %v", diff)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func lineCount(s string) int {
+	return strings.Count(s, "\n")
+}
+
+func TestSaveInPlace(t *testing.T) {
+	path := copyConfig(t, nil)
+	before, _ := os.ReadFile(path)
+	base := mustLoad(t, path)
+
+	cfg := mustMerge(t, base, map[string]any{
+		"download": map[string]any{
+			"concurrent":     5,
+			"quality":        "720p",
+			"naming_pattern": "{bvid}",
+			"retry":          map[string]any{"backoff": "10s"},
+			"danmaku":        map[string]any{"formats": []any{"xml"}},
+		},
+		"asset": map[string]any{
+			"thumbnail": map[string]any{"widths": []any{320}},
+		},
+		"proxy": map[string]any{"bypass": []any{"localhost", "10.0.0.0/8"}},
+		"advanced": map[string]any{
+			"cache": map[string]any{"ttls": map[string]any{"user_card": "2h", "video_info": "10m"}},
+		},
+	})
+	data := saveAndReload(t, path, base, cfg)
+
+	// 原地修改时其余行保持不变，只有 video_info 是新插入的行，行尾注释留在原来的列
+	if got, want := lineCount(data), lineCount(string(before))+1; got != want {
+		t.Errorf("行数 = %d, want %d", got, want)
+	}
+	for _, line := range []string{
+		"  concurrent: 5               # 最大并发下载数",
+		"  quality: 720p               # 视频质量 (360p|480p|720p|1080p)",
+		`  naming_pattern: "{bvid}"          # 文件名格式`,
+		"    backoff: 10s              # 重试间隔",
+		`    formats: ["xml"]              # 保存的原始格式 (xml|protobuf)`,
+		"    widths: [320]             # 生成的缩略图宽度(px)",
+		`  bypass: ["localhost", "10.0.0.0/8"]    # 代理排除列表，支持域名后缀与 CIDR`,
+		"      user_card: 2h",
+		"      video_info: 10m",
+		`    SESSDATA: "YOUR_SESSDATA_HERE"    # 登录Cookie`,
+	} {
+		if !strings.Contains(data, line+"\n") {
+			t.Errorf("保存后缺少行 %q", line)
+		}
+	}
+}
+
+func TestSaveInsertsMissingKeys(t *testing.T) {
+	path := copyConfig(t, func(s string) string {
+		s = strings.Replace(s, "    buvid4: \"\"                        # 设备标识，留空时自动获取\n", "", 1)
+		return strings.Replace(s, "  stdout: true                # 是否输出到控制台\n", "", 1)
+	})
+	before, _ := os.ReadFile(path)
+	base := mustLoad(t, path)
+
+	cfg := mustMerge(t, base, map[string]any{
+		"bilibili": map[string]any{"cookies": map[string]any{"buvid4": "abc"}},
+		"log":      map[string]any{"stdout": !base.Log.Stdout},
+	})
+	data := saveAndReload(t, path, base, cfg)
+
+	if got, want := lineCount(data), lineCount(string(before))+2; got != want {
+		t.Errorf("行数 = %d, want %d", got, want)
+	}
+	for _, line := range []string{
+		"    buvid3: \"\"                        # 设备标识，留空时自动获取\n    buvid4: abc\n",
+		"  compress: true              # 是否压缩旧日志\n  stdout: ",
+	} {
+		if !strings.Contains(data, line) {
+			t.Errorf("新插入的配置项位置错误，缺少 %q", line)
+		}
+	}
+}
+
+func TestSaveFallsBackToReencode(t *testing.T) {
+	path := copyConfig(t, nil)
+	base := mustLoad(t, path)
+
+	// 流式的空列表无法原地写入多行的映射，需要重新编码整个文件
+	cfg := mustMerge(t, base, map[string]any{
+		"download": map[string]any{
+			"concurrent": 2,
+			"quota": map[string]any{
+				"favlists": []any{map[string]any{"favlist_id": 123456, "max_size": 2048}},
+			},
+		},
+	})
+	data := saveAndReload(t, path, base, cfg)
+
+	// 块格式的列表只能由重新编码生成
+	if !strings.Contains(data, "- favlist_id: 123456") {
+		t.Errorf("没有重新编码整个文件:\n%s", data)
+	}
+	reloaded := mustLoad(t, path)
+	if got := reloaded.Download.Quota.FavlistMaxSize(123456); got != 2048 {
+		t.Errorf("FavlistMaxSize = %d, want 2048", got)
+	}
+	if reloaded.Advanced.Cache.TTLs["user_card"] != 6*time.Hour {
+		t.Errorf("未修改的配置项被改变: ttls = %v", reloaded.Advanced.Cache.TTLs)
+	}
+	// 重新编码后注释仍然保留
+	for _, comment := range []string{"# 登录Cookie", "# 最大并发下载数", "# B站账号配置"} {
+		if !strings.Contains(data, comment) {
+			t.Errorf("重新编码后缺少注释 %q", comment)
+		}
+	}
+}
+
+func TestScalarEnd(t *testing.T) {
+	tests := []struct {
+		line  string
+		style yaml.Style
+		want  int
+		ok    bool
+	}{
+		{"k: value", 0, 8, true},
+		{"k: value   # 注释", 0, 8, true},
+		{"k: a#b # 注释", 0, 6, true},
+		{"k:", 0, 3, true},
+		{`k: "a \" # b" # 注释`, yaml.DoubleQuotedStyle, 13, true},
+		{`k: "未结束`, yaml.DoubleQuotedStyle, 0, false},
+		{`k: 'it''s' # 注释`, yaml.SingleQuotedStyle, 10, true},
+	}
+	for _, tt := range tests {
+		got, ok := scalarEnd(tt.line, 3, tt.style)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("scalarEnd(%q) = %d, %v, want %d, %v", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestFlowEnd(t *testing.T) {
+	tests := []struct {
+		line string
+		want int
+		ok   bool
+	}{
+		{"k: []", 5, true},
+		{`k: ["a", "b"] # 注释`, 13, true},
+		{`k: ["]", '[']`, 13, true},
+		{"k: [[1], [2]]", 13, true},
+		{"k: [a,", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := flowEnd(tt.line, 3)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("flowEnd(%q) = %d, %v, want %d, %v", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSaveRejectsInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("- a\n- b\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Save(path, &Config{}, []string{"app.port"}); err == nil {
+		t.Error("顶层不是映射时 Save 应当失败")
+	}
+}
@@ -0,0 +1,222 @@
+package danmaku
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ASSOptions 控制弹幕转换为 ASS 时的画布与排布
+type ASSOptions struct {
+	Width          int           // 画布宽度
+	Height         int           // 画布高度
+	FontName       string        // 字体
+	FontSize       int           // 标准字号（对应B站字号 25）
+	Opacity        float64       // 不透明度，0~1
+	ScrollDuration time.Duration // 滚动弹幕在屏幕上停留的时间
+	FixedDuration  time.Duration // 顶部/底部弹幕停留的时间
+	DisplayArea    float64       // 滚动弹幕占用的屏幕高度比例，0~1
+}
+
+func (o *ASSOptions) normalize() {
+	if o.Width <= 0 {
+		o.Width = 1920
+	}
+	if o.Height <= 0 {
+		o.Height = 1080
+	}
+	if o.FontName == "" {
+		o.FontName = "Microsoft YaHei"
+	}
+	if o.FontSize <= 0 {
+		o.FontSize = 48
+	}
+	if o.Opacity <= 0 || o.Opacity > 1 {
+		o.Opacity = 0.8
+	}
+	if o.ScrollDuration <= 0 {
+		o.ScrollDuration = 10 * time.Second
+	}
+	if o.FixedDuration <= 0 {
+		o.FixedDuration = 5 * time.Second
+	}
+	if o.DisplayArea <= 0 || o.DisplayArea > 1 {
+		o.DisplayArea = 1
+	}
+}
+
+// 每条轨道上最后一条弹幕的信息，用于判断新弹幕能否放入
+type lane struct {
+	used  bool
+	start float64 // 出现时间（秒）
+	width float64 // 文本宽度（像素）
+}
+
+// WriteASS 将弹幕转换为 ASS 字幕。放不下的弹幕会被丢弃，高级/代码弹幕不转换。
+// 返回实际写入的弹幕条数
+func WriteASS(w io.Writer, comments []Comment, opts ASSOptions) (int, error) {
+	opts.normalize()
+	bw := bufio.NewWriter(w)
+
+	alpha := int(math.Round((1 - opts.Opacity) * 255))
+	fmt.Fprintf(bw, "[Script Info]\nScriptType: v4.00+\nCollisions: Normal\nPlayResX: %d\nPlayResY: %d\nWrapStyle: 2\nScaledBorderAndShadow: yes\n\n", opts.Width, opts.Height)
+	fmt.Fprintf(bw, "[V4+ Styles]\nFormat: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding\n")
+	fmt.Fprintf(bw, "Style: Danmaku,%s,%d,&H%02XFFFFFF,&H%02XFFFFFF,&H%02X000000,&H%02X000000,0,0,0,0,100,100,0,0,1,1,0,7,0,0,0,1\n\n", opts.FontName, opts.FontSize, alpha, alpha, alpha, alpha)
+	fmt.Fprintf(bw, "[Events]\nFormat: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n")
+
+	rowHeight := opts.FontSize + 4
+	scrollRows := int(float64(opts.Height)*opts.DisplayArea) / rowHeight
+	fixedRows := opts.Height / rowHeight
+	if scrollRows < 1 {
+		scrollRows = 1
+	}
+	scrollLanes := make([]lane, scrollRows)
+	topLanes := make([]lane, fixedRows)
+	bottomLanes := make([]lane, fixedRows)
+
+	screenW := float64(opts.Width)
+	scrollD := opts.ScrollDuration.Seconds()
+	fixedD := opts.FixedDuration.Seconds()
+
+	written := 0
+	for _, c := range comments {
+		if c.Mode == ModeAdvanced || c.Mode == ModeCode || c.Content == "" {
+			continue
+		}
+		size := scaledFontSize(c.FontSize, opts.FontSize)
+		text := escapeText(c.Content)
+		width := textWidth(c.Content, size)
+		start := c.Progress.Seconds()
+		style := colorTag(c.Color) + sizeTag(size, opts.FontSize)
+
+		var line string
+		switch c.Mode {
+		case ModeTop, ModeBottom:
+			lanes := topLanes
+			if c.Mode == ModeBottom {
+				lanes = bottomLanes
+			}
+			row := findFixedLane(lanes, start, fixedD)
+			if row < 0 {
+				continue
+			}
+			lanes[row] = lane{used: true, start: start, width: width}
+			y := row * rowHeight
+			align := `\an8`
+			if c.Mode == ModeBottom {
+				align = `\an2`
+				y = opts.Height - row*rowHeight
+			}
+			line = fmt.Sprintf("Dialogue: 1,%s,%s,Danmaku,,0,0,0,,{%s\\pos(%d,%d)%s}%s\n",
+				formatTime(start), formatTime(start+fixedD), align, opts.Width/2, y, style, text)
+		default:
+			row := findScrollLane(scrollLanes, start, width, screenW, scrollD)
+			if row < 0 {
+				continue
+			}
+			scrollLanes[row] = lane{used: true, start: start, width: width}
+			y := row * rowHeight
+			fromX, toX := screenW, -width
+			if c.Mode == ModeReverse {
+				fromX, toX = -width, screenW
+			}
+			line = fmt.Sprintf("Dialogue: 0,%s,%s,Danmaku,,0,0,0,,{\\move(%d,%d,%d,%d)%s}%s\n",
+				formatTime(start), formatTime(start+scrollD), int(fromX), y, int(toX), y, style, text)
+		}
+		if _, err := bw.WriteString(line); err != nil {
+			return written, err
+		}
+		written++
+	}
+	return written, bw.Flush()
+}
+
+// 滚动弹幕的速度与文本宽度相关：新弹幕需等前一条完全进入屏幕，
+// 且在前一条离开屏幕之前不会追上它
+func findScrollLane(lanes []lane, start, width, screenW, d float64) int {
+	speed := (screenW + width) / d
+	for i, l := range lanes {
+		if !l.used {
+			return i
+		}
+		prevSpeed := (screenW + l.width) / d
+		entered := l.start + l.width/prevSpeed
+		noCatchUp := start+screenW/speed >= l.start+d
+		if start >= entered && noCatchUp {
+			return i
+		}
+	}
+	return -1
+}
+
+func findFixedLane(lanes []lane, start, d float64) int {
+	for i, l := range lanes {
+		if !l.used || start >= l.start+d {
+			return i
+		}
+	}
+	return -1
+}
+
+// B站字号以 25 为标准，按比例映射到配置的字号
+func scaledFontSize(size, base int) int {
+	if size <= 0 {
+		return base
+	}
+	return size * base / 25
+}
+
+func sizeTag(size, base int) string {
+	if size == base {
+		return ""
+	}
+	return fmt.Sprintf(`\fs%d`, size)
+}
+
+func colorTag(rgb uint32) string {
+	if rgb == 0xFFFFFF || rgb == 0 {
+		return ""
+	}
+	r, g, b := (rgb>>16)&0xFF, (rgb>>8)&0xFF, rgb&0xFF
+	return fmt.Sprintf(`\c&H%02X%02X%02X&`, b, g, r)
+}
+
+// 粗略估算文本宽度：全角字符按一个字号计，半角字符按半个字号计
+func textWidth(s string, size int) float64 {
+	var w float64
+	for _, r := range s {
+		if r < 0x80 {
+			w += float64(size) / 2
+		} else {
+			w += float64(size)
+		}
+	}
+	return w
+}
+
+func escapeText(s string) string {
+	s = strings.ReplaceAll(s, `\`, `＼`)
+	s = strings.ReplaceAll(s, "{", "｛")
+	s = strings.ReplaceAll(s, "}", "｝")
+	s = strings.ReplaceAll(s, "\r", "")
+	s = strings.ReplaceAll(s, "\n", `\N`)
+	if !utf8.ValidString(s) {
+		s = strings.ToValidUTF8(s, "")
+	}
+	return s
+}
+
+func formatTime(sec float64) string {
+	if sec < 0 {
+		sec = 0
+	}
+	cs := int(math.Round(sec * 100))
+	h := cs / 360000
+	m := cs / 6000 % 60
+	s := cs / 100 % 60
+	return fmt.Sprintf("%d:%02d:%02d.%02d", h, m, s, cs%100)
+}
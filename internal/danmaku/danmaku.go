@@ -0,0 +1,51 @@
+// Package danmaku 解析B站弹幕（XML 与 protobuf 分段格式）并转换为 ASS 字幕
+package danmaku
+
+import (
+	"sort"
+	"time"
+)
+
+// 弹幕模式
+const (
+	ModeScroll   = 1 // 普通滚动
+	ModeScroll2  = 2
+	ModeScroll3  = 3
+	ModeBottom   = 4 // 底部固定
+	ModeTop      = 5 // 顶部固定
+	ModeReverse  = 6 // 逆向滚动
+	ModeAdvanced = 7 // 高级弹幕，不转换
+	ModeCode     = 8 // 代码弹幕，不转换
+)
+
+type Comment struct {
+	ID       int64
+	Progress time.Duration // 出现时间
+	Mode     int
+	FontSize int
+	Color    uint32 // RGB
+	MidHash  string
+	Content  string
+	Ctime    int64
+	Pool     int
+	Weight   int
+}
+
+// Merge 按弹幕ID去重合并多个来源，结果按出现时间排序
+func Merge(lists ...[]Comment) []Comment {
+	seen := make(map[int64]struct{})
+	var out []Comment
+	for _, list := range lists {
+		for _, c := range list {
+			if c.ID != 0 {
+				if _, ok := seen[c.ID]; ok {
+					continue
+				}
+				seen[c.ID] = struct{}{}
+			}
+			out = append(out, c)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Progress < out[j].Progress })
+	return out
+}
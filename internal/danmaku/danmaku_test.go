@@ -0,0 +1,243 @@
+package danmaku
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// testdata/seg.so 按 seg.so 接口返回的 DmSegMobileReply 构造，包含解析时跳过的字段
+// （action、idStr、attr 与外层的 state）、一条没有内容的弹幕和一条高级弹幕
+func loadSegment(t *testing.T) []Comment {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "seg.so"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	comments, err := DecodeSegment(data)
+	if err != nil {
+		t.Fatalf("DecodeSegment: %v", err)
+	}
+	return comments
+}
+
+// 与分段中的 1001 重复，另有两条只在 XML 中的弹幕
+const fixtureXML = `<?xml version="1.0" encoding="UTF-8"?>
+<i>
+<d p="0.50000,1,25,16777215,1699999990,0,0f0f0f0f,2001,3">xml only</d>
+<d p="1.50000,1,25,16777215,1700000000,0,a1b2c3d4,1001,10">前方高能</d>
+<d p="1.50000,1,25,16777215,1699999991,0,1e1e1e1e,2002,3">同一时刻</d>
+</i>`
+
+func TestDecodeSegment(t *testing.T) {
+	want := []Comment{
+		{ID: 1001, Progress: 1500 * time.Millisecond, Mode: ModeScroll, FontSize: 25, Color: 0xFFFFFF, MidHash: "a1b2c3d4", Content: "前方高能", Ctime: 1700000000, Weight: 10},
+		{ID: 1002, Progress: 2 * time.Second, Mode: ModeTop, FontSize: 25, Color: 0xFF0000, MidHash: "b2c3d4e5", Content: "顶部弹幕", Ctime: 1700000001, Weight: 5},
+		{ID: 1003, Progress: 2 * time.Second, Mode: ModeBottom, FontSize: 18, Color: 0x00FF00, MidHash: "c3d4e5f6", Content: `a{b}\c`, Ctime: 1700000002, Weight: 5},
+		{ID: 1004, Progress: 2500 * time.Millisecond, Mode: ModeScroll, FontSize: 36, Color: 0xFFFFFF, MidHash: "d4e5f6a7", Content: "hello world", Ctime: 1700000003, Weight: 1},
+		{ID: 1005, Progress: 2600 * time.Millisecond, Mode: ModeAdvanced, FontSize: 25, Color: 0xFFFFFF, MidHash: "e5f6a7b8", Content: `[0,0,"1-1",4.5,"高级"]`, Ctime: 1700000004, Weight: 1, Pool: 2},
+		{ID: 1007, Progress: 3 * time.Second, Mode: ModeReverse, FontSize: 25, Color: 0xFFFFFF, MidHash: "a7b8c9d0", Content: "逆向", Ctime: 1700000006, Weight: 1},
+	}
+	got := loadSegment(t)
+	if len(got) != len(want) {
+		t.Fatalf("解析出 %d 条弹幕, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("弹幕[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestDecodeSegmentErrors(t *testing.T) {
+	elem := protowire.AppendTag(nil, 7, protowire.BytesType)
+	elem = protowire.AppendString(elem, "内容")
+	valid := protowire.AppendTag(nil, 1, protowire.BytesType)
+	valid = protowire.AppendBytes(valid, elem)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"标签不完整", []byte{0x80}},
+		{"弹幕长度超出数据", valid[:len(valid)-1]},
+		{"弹幕内容不完整", protowire.AppendBytes(protowire.AppendTag(nil, 1, protowire.BytesType), elem[:len(elem)-1])},
+		{"未知字段不完整", protowire.AppendTag(nil, 3, protowire.Fixed64Type)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeSegment(tt.data); err == nil {
+				t.Error("应当返回错误")
+			}
+		})
+	}
+
+	comments, err := DecodeSegment(valid)
+	if err != nil || len(comments) != 1 || comments[0].Content != "内容" {
+		t.Errorf("DecodeSegment = %+v, %v", comments, err)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	c := func(id int64, ms int, content string) Comment {
+		return Comment{ID: id, Progress: time.Duration(ms) * time.Millisecond, Content: content}
+	}
+	tests := []struct {
+		name  string
+		lists [][]Comment
+		want  []string
+	}{
+		{
+			name:  "按出现时间排序",
+			lists: [][]Comment{{c(1, 300, "c"), c(2, 100, "a")}, {c(3, 200, "b")}},
+			want:  []string{"a", "b", "c"},
+		},
+		{
+			name:  "重复的ID保留先出现的来源",
+			lists: [][]Comment{{c(1, 100, "xml")}, {c(1, 100, "protobuf"), c(2, 200, "b")}},
+			want:  []string{"xml", "b"},
+		},
+		{
+			name:  "没有ID的弹幕不去重",
+			lists: [][]Comment{{c(0, 100, "a")}, {c(0, 100, "a")}},
+			want:  []string{"a", "a"},
+		},
+		{
+			name:  "出现时间相同时保持原顺序",
+			lists: [][]Comment{{c(1, 100, "a"), c(2, 100, "b")}, {c(3, 100, "c")}},
+			want:  []string{"a", "b", "c"},
+		},
+		{
+			name: "没有弹幕",
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, m := range Merge(tt.lists...) {
+				got = append(got, m.Content)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Merge = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeSources(t *testing.T) {
+	fromXML, err := ParseXML(strings.NewReader(fixtureXML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged := Merge(fromXML, loadSegment(t))
+	var ids []int64
+	for _, c := range merged {
+		ids = append(ids, c.ID)
+	}
+	if want := []int64{2001, 1001, 2002, 1002, 1003, 1004, 1005, 1007}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("合并后的弹幕 = %v, want %v", ids, want)
+	}
+}
+
+// 小画布上只有两条滚动轨道，2002 与 1001 同时出现且轨道已满，被丢弃；
+// 1005 为高级弹幕不转换。结果与 testdata/danmaku.ass 逐字节比较
+func TestWriteASSGolden(t *testing.T) {
+	fromXML, err := ParseXML(strings.NewReader(fixtureXML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := ASSOptions{
+		Width:          640,
+		Height:         120,
+		FontName:       "Noto Sans CJK SC",
+		FontSize:       20,
+		Opacity:        0.8,
+		ScrollDuration: 10 * time.Second,
+		FixedDuration:  5 * time.Second,
+		DisplayArea:    0.5,
+	}
+	var buf bytes.Buffer
+	n, err := WriteASS(&buf, Merge(fromXML, loadSegment(t)), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 6 {
+		t.Errorf("写入 %d 条弹幕, want 6", n)
+	}
+	want, err := os.ReadFile(filepath.Join("testdata", "danmaku.ass"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != string(want) {
+		t.Errorf("ASS 与 testdata/danmaku.ass 不一致:\n%s", got)
+	}
+}
+
+func TestFindScrollLane(t *testing.T) {
+	const screenW, d = 640.0, 10.0
+	tests := []struct {
+		name  string
+		lanes []lane
+		start float64
+		width float64
+		want  int
+	}{
+		{"空轨道", []lane{{}, {}}, 0, 100, 0},
+		{"前一条尚未完全进入屏幕", []lane{{used: true, start: 0, width: 100}, {}}, 0.5, 100, 1},
+		{"前一条已进入屏幕且不会追上", []lane{{used: true, start: 0, width: 100}}, 2, 100, 0},
+		{"更长的弹幕速度更快会追上前一条", []lane{{used: true, start: 0, width: 20}}, 1, 600, -1},
+		{"所有轨道已满", []lane{{used: true, start: 0, width: 100}, {used: true, start: 0, width: 100}}, 0.1, 100, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := findScrollLane(tt.lanes, tt.start, tt.width, screenW, d); got != tt.want {
+				t.Errorf("findScrollLane = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindFixedLane(t *testing.T) {
+	lanes := []lane{{used: true, start: 0}, {used: true, start: 1}, {}}
+	tests := []struct {
+		start float64
+		want  int
+	}{
+		{0.5, 2},
+		{5, 0}, // 第一条刚好消失
+		{5.5, 0},
+	}
+	for _, tt := range tests {
+		if got := findFixedLane(lanes, tt.start, 5); got != tt.want {
+			t.Errorf("findFixedLane(%v) = %d, want %d", tt.start, got, tt.want)
+		}
+	}
+	if got := findFixedLane(lanes[:2], 0.5, 5); got != -1 {
+		t.Errorf("轨道已满时 findFixedLane = %d, want -1", got)
+	}
+}
+
+func TestFormatTime(t *testing.T) {
+	tests := []struct {
+		sec  float64
+		want string
+	}{
+		{0, "0:00:00.00"},
+		{-1, "0:00:00.00"},
+		{1.234, "0:00:01.23"},
+		{59.999, "0:01:00.00"},
+		{3723.5, "1:02:03.50"},
+	}
+	for _, tt := range tests {
+		if got := formatTime(tt.sec); got != tt.want {
+			t.Errorf("formatTime(%v) = %q, want %q", tt.sec, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package danmaku
+
+import (
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// 分段弹幕每段覆盖的时长
+const SegmentDuration = 6 * time.Minute
+
+// DecodeSegment 解析 /x/v2/dm/web/seg.so 返回的 DmSegMobileReply。
+// 只解码需要的字段，未知字段直接跳过
+func DecodeSegment(data []byte) ([]Comment, error) {
+	var comments []Comment
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		if num == 1 && typ == protowire.BytesType {
+			elem, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			c, err := decodeElem(elem)
+			if err != nil {
+				return nil, fmt.Errorf("解析弹幕分段失败: %w", err)
+			}
+			if c.Content != "" {
+				comments = append(comments, c)
+			}
+			data = data[n:]
+			continue
+		}
+
+		n = protowire.ConsumeFieldValue(num, typ, data)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+	}
+	return comments, nil
+}
+
+// DanmakuElem 字段编号：1 id, 2 progress(ms), 3 mode, 4 fontsize, 5 color,
+// 6 midHash, 7 content, 8 ctime, 9 weight, 11 pool
+func decodeElem(data []byte) (Comment, error) {
+	var c Comment
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return c, protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		switch typ {
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return c, protowire.ParseError(n)
+			}
+			data = data[n:]
+			switch num {
+			case 1:
+				c.ID = int64(v)
+			case 2:
+				c.Progress = time.Duration(int32(v)) * time.Millisecond
+			case 3:
+				c.Mode = int(int32(v))
+			case 4:
+				c.FontSize = int(int32(v))
+			case 5:
+				c.Color = uint32(v)
+			case 8:
+				c.Ctime = int64(v)
+			case 9:
+				c.Weight = int(int32(v))
+			case 11:
+				c.Pool = int(int32(v))
+			}
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return c, protowire.ParseError(n)
+			}
+			data = data[n:]
+			switch num {
+			case 6:
+				c.MidHash = string(v)
+			case 7:
+				c.Content = string(v)
+			}
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return c, protowire.ParseError(n)
+			}
+			data = data[n:]
+		}
+	}
+	return c, nil
+}
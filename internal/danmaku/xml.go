@@ -0,0 +1,55 @@
+package danmaku
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type xmlDocument struct {
+	Items []struct {
+		P    string `xml:"p,attr"`
+		Text string `xml:",chardata"`
+	} `xml:"d"`
+}
+
+// ParseXML 解析 comment.bilibili.com/{cid}.xml 格式的弹幕。
+// p 属性依次为：出现时间(秒),模式,字号,颜色,发送时间,弹幕池,用户hash,弹幕ID[,权重]
+func ParseXML(r io.Reader) ([]Comment, error) {
+	var doc xmlDocument
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("解析弹幕XML失败: %w", err)
+	}
+
+	comments := make([]Comment, 0, len(doc.Items))
+	for _, item := range doc.Items {
+		fields := strings.Split(item.P, ",")
+		if len(fields) < 8 {
+			continue
+		}
+		progress, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			continue
+		}
+		c := Comment{
+			Progress: time.Duration(progress * float64(time.Second)),
+			MidHash:  fields[6],
+			Content:  item.Text,
+		}
+		c.Mode, _ = strconv.Atoi(fields[1])
+		c.FontSize, _ = strconv.Atoi(fields[2])
+		color, _ := strconv.ParseUint(fields[3], 10, 32)
+		c.Color = uint32(color)
+		c.Ctime, _ = strconv.ParseInt(fields[4], 10, 64)
+		c.Pool, _ = strconv.Atoi(fields[5])
+		c.ID, _ = strconv.ParseInt(fields[7], 10, 64)
+		if len(fields) > 8 {
+			c.Weight, _ = strconv.Atoi(fields[8])
+		}
+		comments = append(comments, c)
+	}
+	return comments, nil
+}
@@ -0,0 +1,106 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// 写入资源记录，同一资源重复写入时覆盖
+func (db *DB) SaveAsset(a *Asset) error {
+	_, err := db.conn.Exec(`
+INSERT INTO asset (kind, owner_key, url, hash, path, size, content_type, status, attempts, last_error, updated_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT(kind, owner_key) DO UPDATE SET
+    url = excluded.url, hash = excluded.hash, path = excluded.path, size = excluded.size,
+    content_type = excluded.content_type, status = excluded.status, attempts = excluded.attempts,
+    last_error = excluded.last_error, updated_at = excluded.updated_at`,
+		a.Kind, a.OwnerKey, a.URL, a.Hash, a.Path, a.Size, a.ContentType, a.Status, a.Attempts, a.LastError, time.Now(),
+	)
+	return err
+}
+
+// 查询资源记录，不存在时返回 sql.ErrNoRows
+func (db *DB) GetAsset(kind, ownerKey string) (*Asset, error) {
+	var a Asset
+	var hash, path, contentType, lastError sql.NullString
+	var updated sql.NullTime
+	err := db.conn.QueryRow(`
+SELECT kind, owner_key, url, hash, path, size, content_type, status, attempts, last_error, updated_at
+FROM asset WHERE kind = ? AND owner_key = ?`, kind, ownerKey).Scan(
+		&a.Kind, &a.OwnerKey, &a.URL, &hash, &path, &a.Size, &contentType, &a.Status, &a.Attempts, &lastError, &updated,
+	)
+	if err != nil {
+		return nil, err
+	}
+	a.Hash = hash.String
+	a.Path = path.String
+	a.ContentType = contentType.String
+	a.LastError = lastError.String
+	a.UpdatedAt = updated.Time
+	return &a, nil
+}
+
+// 查找已有相同内容的本地文件，用于去重
+func (db *DB) FindAssetPathByHash(hash string) (string, error) {
+	var path string
+	err := db.conn.QueryRow(`SELECT path FROM asset WHERE hash = ? AND status = 'ok' LIMIT 1`, hash).Scan(&path)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return path, err
+}
+
+// 列出有远程地址但缺少本地副本的封面、头像和收藏夹封面。
+// 连续失败达到 maxAttempts 次的资源不再返回，远程地址变化后会重新计数
+func (db *DB) ListMissingAssets(maxAttempts, limit int) ([]MissingAsset, error) {
+	rows, err := db.conn.Query(`
+SELECT m.kind, m.owner_key, m.url FROM (
+    SELECT 'cover' AS kind, bvid AS owner_key, cover_url AS url FROM video
+    WHERE COALESCE(cover, '') = '' AND COALESCE(cover_url, '') != ''
+    UNION ALL
+    SELECT 'face', CAST(uid AS TEXT), face_url FROM uploader
+    WHERE COALESCE(face, '') = '' AND COALESCE(face_url, '') != ''
+    UNION ALL
+    SELECT 'favlist_cover', CAST(id AS TEXT), cover_url FROM favlist
+    WHERE COALESCE(cover, '') = '' AND COALESCE(cover_url, '') != ''
+) m
+LEFT JOIN asset a ON a.kind = m.kind AND a.owner_key = m.owner_key AND a.url = m.url
+WHERE COALESCE(a.attempts, 0) < ?
+LIMIT ?`, maxAttempts, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []MissingAsset
+	for rows.Next() {
+		var m MissingAsset
+		if err := rows.Scan(&m.Kind, &m.OwnerKey, &m.URL); err != nil {
+			return nil, err
+		}
+		list = append(list, m)
+	}
+	return list, rows.Err()
+}
+
+// 更新视频的本地封面地址
+func (db *DB) UpdateVideoCover(bvid, cover string) error {
+	_, err := db.conn.Exec(`UPDATE video SET cover = ? WHERE bvid = ?`, cover, bvid)
+	return err
+}
+
+// 更新收藏夹的本地封面地址
+func (db *DB) UpdateFavlistCover(id int64, cover string) error {
+	_, err := db.conn.Exec(`UPDATE favlist SET cover = ? WHERE id = ?`, cover, id)
+	return err
+}
+
+// 同步收藏夹的标题与远程封面，封面变化时清空本地封面等待重新下载
+func (db *DB) UpdateFavlistInfo(id int64, name, coverURL string) error {
+	_, err := db.conn.Exec(`
+UPDATE favlist SET name = ?,
+    cover = CASE WHEN COALESCE(cover_url, '') = ? THEN cover ELSE '' END,
+    cover_url = ?, last_checked_at = ?
+WHERE id = ?`, name, coverURL, coverURL, time.Now(), id)
+	return err
+}
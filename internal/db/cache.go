@@ -0,0 +1,51 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// 读取未过期的接口缓存，不存在或已过期时返回 nil
+func (db *DB) GetCacheEntry(key string, now time.Time) ([]byte, time.Time, error) {
+	var value []byte
+	var expiresAt time.Time
+	err := db.conn.QueryRow(`SELECT value, expires_at FROM api_cache WHERE key = ?`, key).Scan(&value, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, time.Time{}, nil
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if !expiresAt.After(now) {
+		return nil, time.Time{}, nil
+	}
+	return value, expiresAt, nil
+}
+
+func (db *DB) SetCacheEntry(key, endpoint string, value []byte, expiresAt time.Time) error {
+	_, err := db.conn.Exec(
+		`INSERT OR REPLACE INTO api_cache (key, endpoint, value, expires_at) VALUES (?, ?, ?, ?)`,
+		key, endpoint, value, expiresAt,
+	)
+	return err
+}
+
+func (db *DB) DeleteCacheEntry(key string) error {
+	_, err := db.conn.Exec(`DELETE FROM api_cache WHERE key = ?`, key)
+	return err
+}
+
+// 删除过期的缓存，返回删除的条数
+func (db *DB) DeleteExpiredCache(now time.Time) (int64, error) {
+	res, err := db.conn.Exec(`DELETE FROM api_cache WHERE expires_at <= ?`, now)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (db *DB) ClearCache() error {
+	_, err := db.conn.Exec(`DELETE FROM api_cache`)
+	return err
+}
@@ -0,0 +1,169 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// 查询收藏夹中的视频及其在该收藏夹中是否已被移除
+func (db *DB) ListFavlistVideoStates(favlistID int64) (map[string]bool, error) {
+	rows, err := db.conn.Query(`SELECT bvid, removed_at IS NOT NULL FROM favlist_video WHERE favlist_id = ?`, favlistID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	states := make(map[string]bool)
+	for rows.Next() {
+		var bvid string
+		var removed bool
+		if err := rows.Scan(&bvid, &removed); err != nil {
+			return nil, err
+		}
+		states[bvid] = removed
+	}
+	return states, rows.Err()
+}
+
+// 收藏夹中同时仍在其他正在监视的收藏夹中的视频
+func (db *DB) ListSharedVideos(favlistID int64) (map[string]bool, error) {
+	rows, err := db.conn.Query(`
+SELECT DISTINCT fv.bvid FROM favlist_video fv JOIN favlist f ON f.id = fv.favlist_id
+WHERE fv.favlist_id != ? AND fv.removed_at IS NULL
+    AND fv.bvid IN (SELECT bvid FROM favlist_video WHERE favlist_id = ?)`, favlistID, favlistID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shared := make(map[string]bool)
+	for rows.Next() {
+		var bvid string
+		if err := rows.Scan(&bvid); err != nil {
+			return nil, err
+		}
+		shared[bvid] = true
+	}
+	return shared, rows.Err()
+}
+
+// 仍包含该视频的收藏夹（只统计正在监视的收藏夹）
+const activeMembership = `EXISTS (SELECT 1 FROM favlist_video fv JOIN favlist f ON f.id = fv.favlist_id
+    WHERE fv.bvid = video.bvid AND fv.removed_at IS NULL)`
+
+// 记录视频在某个收藏夹中是否已被移除，并据此更新视频的移除状态：
+// 只有所有正在监视的收藏夹都不再包含该视频时才标记为已移除。
+// 已移除的视频重新加入任一收藏夹时清除移除与清理时间，被清理的视频会重新下载
+func (db *DB) SetVideoRemoved(favlistID int64, bvid string, removed bool) error {
+	var removedAt any
+	if removed {
+		removedAt = time.Now()
+	}
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+INSERT INTO favlist_video (favlist_id, bvid, added_at, removed_at) VALUES (?, ?, ?, ?)
+ON CONFLICT(favlist_id, bvid) DO UPDATE SET removed_at = excluded.removed_at`,
+		favlistID, bvid, time.Now(), removedAt,
+	)
+	if err != nil {
+		return err
+	}
+	// SET 中的表达式都使用更新前的值
+	_, err = tx.Exec(`
+UPDATE video SET
+    is_removed = NOT `+activeMembership+`,
+    removed_at = CASE WHEN `+activeMembership+` THEN NULL ELSE COALESCE(removed_at, ?) END,
+    deleted_at = CASE WHEN `+activeMembership+` AND is_removed = 1 THEN NULL ELSE deleted_at END,
+    is_downloaded = CASE WHEN `+activeMembership+` AND is_removed = 1 AND deleted_at IS NOT NULL THEN 0 ELSE is_downloaded END
+WHERE bvid = ?`, time.Now(), bvid)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// 视频当前所在的收藏夹
+func (db *DB) ListVideoFavlists(bvid string) ([]int64, error) {
+	rows, err := db.conn.Query(`SELECT favlist_id FROM favlist_video WHERE bvid = ? AND removed_at IS NULL ORDER BY favlist_id`, bvid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// 记录清理规则删除的文件，同时清除视频的下载标记
+func (db *DB) MarkVideoDeleted(v *Video, path, reason string) error {
+	now := time.Now()
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+UPDATE video SET is_downloaded = 0, file_path = '', file_size = 0, file_hash = '',
+    verify_status = '', verify_error = '', deleted_at = ?
+WHERE id = ?`, now, v.ID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		`INSERT INTO cleanup_log (bvid, favlist_id, title, path, size, reason, deleted_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		v.BVID, v.FavlistID, v.Title, path, v.FileSize, reason, now,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// 分页查询清理记录，最新的在前
+func (db *DB) ListCleanupLog(page, pageSize int) ([]CleanupLog, int, error) {
+	if pageSize <= 0 || pageSize > MaxPageSize {
+		return nil, 0, ErrInvalidPageSize
+	}
+	if page < 1 {
+		page = 1
+	}
+
+	var total int
+	if err := db.conn.QueryRow(`SELECT COUNT(*) FROM cleanup_log`).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.conn.Query(`
+SELECT id, bvid, favlist_id, title, path, size, reason, deleted_at
+FROM cleanup_log ORDER BY id DESC LIMIT ? OFFSET ?`, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	logs := make([]CleanupLog, 0, pageSize)
+	for rows.Next() {
+		var l CleanupLog
+		var title, path sql.NullString
+		if err := rows.Scan(&l.ID, &l.BVID, &l.FavlistID, &title, &path, &l.Size, &l.Reason, &l.DeletedAt); err != nil {
+			return nil, 0, err
+		}
+		l.Title = title.String
+		l.Path = path.String
+		logs = append(logs, l)
+	}
+	return logs, total, rows.Err()
+}
@@ -2,6 +2,8 @@ package db
 
 import (
 	"database/sql"
+	"fmt"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -19,15 +21,24 @@ func NewDB(path string) (*DB, error) {
 	if err := db.initSchema(); err != nil {
 		return nil, err
 	}
+	if err := db.migrate(); err != nil {
+		return nil, err
+	}
 	return db, nil
 }
 
+// Close 关闭数据库连接，应在所有使用数据库的组件停止后调用
+func (db *DB) Close() error {
+	return db.conn.Close()
+}
+
 func (db *DB) initSchema() error {
 	_, err := db.conn.Exec(`
 CREATE TABLE IF NOT EXISTS favlist (
     id INTEGER PRIMARY KEY,
     name TEXT,
     cover TEXT,
+    cover_url TEXT DEFAULT '',                      -- 远程封面地址
     last_checked_at DATETIME
 );
 
@@ -36,7 +47,10 @@ CREATE TABLE IF NOT EXISTS video (
     bvid TEXT,
     title TEXT,
     cover TEXT,
+    cover_url TEXT DEFAULT '',                      -- 远程封面地址
     created_at DATETIME,
+    pubdate DATETIME,                               -- 发布时间
+    fav_time DATETIME,                              -- 收藏时间
     duration INTEGER,
     page_count INTEGER,
     desc TEXT,
@@ -48,18 +62,266 @@ CREATE TABLE IF NOT EXISTS video (
     is_downloaded INTEGER DEFAULT 0,                -- 新增：是否下载完成
     is_invalid INTEGER DEFAULT 0,                   -- 新增：是否失效
     is_removed INTEGER DEFAULT 0,                   -- 新增：是否被移除
+    file_path TEXT DEFAULT '',                      -- 本地文件路径
+    file_size INTEGER DEFAULT 0,                    -- 本地文件大小
+    file_hash TEXT DEFAULT '',                      -- 本地文件的 sha256
+    verify_status TEXT DEFAULT '',                  -- 校验结果：ok / corrupt / missing
+    verify_error TEXT DEFAULT '',
+    verified_at DATETIME,
+    removed_at DATETIME,                            -- 从收藏夹移除的时间
+    deleted_at DATETIME,                            -- 本地文件被清理的时间
     FOREIGN KEY(favlist_id) REFERENCES favlist(id)
 );
 CREATE INDEX IF NOT EXISTS idx_video_bvid ON video(bvid);
+
+-- 视频与收藏夹的对应关系，同一视频可以在多个收藏夹中
+CREATE TABLE IF NOT EXISTS favlist_video (
+    favlist_id INTEGER,
+    bvid TEXT,
+    added_at DATETIME,
+    removed_at DATETIME,                            -- 从该收藏夹移除的时间
+    PRIMARY KEY(favlist_id, bvid)
+);
+CREATE INDEX IF NOT EXISTS idx_favlist_video_bvid ON favlist_video(bvid);
+
+CREATE TABLE IF NOT EXISTS video_revision (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    bvid TEXT,
+    field TEXT,
+    old_value TEXT,
+    new_value TEXT,
+    changed_at DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_video_revision_bvid ON video_revision(bvid, changed_at);
+
+CREATE TABLE IF NOT EXISTS video_meta (
+    bvid TEXT PRIMARY KEY,
+    aid INTEGER,
+    tid INTEGER,
+    tname TEXT,
+    copyright INTEGER,
+    pubdate DATETIME,
+    ctime DATETIME,
+    state INTEGER,
+    dynamic TEXT,
+    raw TEXT,
+    fetched_at DATETIME
+);
+
+CREATE TABLE IF NOT EXISTS video_tag (
+    bvid TEXT,
+    tag_id INTEGER,
+    tag_name TEXT,
+    PRIMARY KEY(bvid, tag_id)
+);
+CREATE INDEX IF NOT EXISTS idx_video_tag_name ON video_tag(tag_name);
+
+CREATE TABLE IF NOT EXISTS video_page (
+    bvid TEXT,
+    page INTEGER,
+    cid INTEGER,
+    part TEXT,
+    duration INTEGER,
+    width INTEGER,
+    height INTEGER,
+    danmaku_status TEXT DEFAULT '',
+    danmaku_count INTEGER DEFAULT 0,
+    PRIMARY KEY(bvid, page)
+);
+
+CREATE TABLE IF NOT EXISTS video_subtitle (
+    bvid TEXT,
+    page INTEGER,
+    cid INTEGER,
+    lan TEXT,
+    lan_doc TEXT,
+    is_ai INTEGER DEFAULT 0,
+    path TEXT,                                      -- 不含扩展名的文件路径
+    formats TEXT,                                   -- 已保存的格式，逗号分隔
+    fetched_at DATETIME,
+    PRIMARY KEY(bvid, page, lan)
+);
+
+CREATE TABLE IF NOT EXISTS video_stat (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    bvid TEXT,
+    view INTEGER,
+    danmaku INTEGER,
+    reply INTEGER,
+    favorite INTEGER,
+    coin INTEGER,
+    share INTEGER,
+    like_count INTEGER,
+    captured_at DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_video_stat_bvid ON video_stat(bvid, captured_at);
+
+CREATE TABLE IF NOT EXISTS uploader (
+    uid INTEGER PRIMARY KEY,
+    name TEXT,
+    face_url TEXT DEFAULT '',
+    face TEXT DEFAULT '',
+    sign TEXT DEFAULT '',
+    fans INTEGER DEFAULT 0,
+    attention INTEGER DEFAULT 0,
+    archive_count INTEGER DEFAULT 0,
+    first_seen_at DATETIME,
+    updated_at DATETIME,
+    profile_synced_at DATETIME
+);
+
+CREATE TABLE IF NOT EXISTS uploader_name_history (
+    uid INTEGER,
+    name TEXT,
+    first_seen_at DATETIME,
+    PRIMARY KEY(uid, name)
+);
+
+CREATE TABLE IF NOT EXISTS asset (
+    kind TEXT,                                      -- cover / face / favlist_cover
+    owner_key TEXT,                                 -- bvid、uid 或收藏夹id
+    url TEXT,                                       -- 远程地址
+    hash TEXT,                                      -- 内容的 sha256，相同内容只存一份
+    path TEXT,                                      -- 本地文件路径
+    size INTEGER DEFAULT 0,
+    content_type TEXT,
+    status TEXT,                                    -- ok / failed
+    attempts INTEGER DEFAULT 0,                     -- 连续失败次数
+    last_error TEXT,
+    updated_at DATETIME,
+    PRIMARY KEY(kind, owner_key)
+);
+
+CREATE TABLE IF NOT EXISTS cleanup_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    bvid TEXT,
+    favlist_id INTEGER,
+    title TEXT,
+    path TEXT,
+    size INTEGER,
+    reason TEXT,
+    deleted_at DATETIME
+);
+
+CREATE TABLE IF NOT EXISTS api_cache (
+    key TEXT PRIMARY KEY,
+    endpoint TEXT,
+    value BLOB,
+    expires_at DATETIME
+);
+
+-- 上传到存储后端失败的视频，定期重试
+CREATE TABLE IF NOT EXISTS pending_upload (
+    bvid TEXT PRIMARY KEY,
+    attempts INTEGER DEFAULT 0,
+    last_error TEXT,
+    updated_at DATETIME
+);
+
+CREATE TABLE IF NOT EXISTS download_queue (
+    bvid TEXT PRIMARY KEY,
+    title TEXT,
+    status TEXT,
+    progress REAL DEFAULT 0,
+    created_at DATETIME,
+    saved_at DATETIME
+);
 `)
 	return err
 }
 
+// 旧数据库缺少的列在这里补齐，新增列只需追加到列表末尾
+var columnMigrations = []struct {
+	table  string
+	column string
+	def    string
+}{
+	{"video", "pubdate", "DATETIME"},
+	{"video", "fav_time", "DATETIME"},
+	{"video", "file_path", "TEXT DEFAULT ''"},
+	{"video", "file_size", "INTEGER DEFAULT 0"},
+	{"video", "cover_url", "TEXT DEFAULT ''"},
+	{"video_page", "danmaku_status", "TEXT DEFAULT ''"},
+	{"video_page", "danmaku_count", "INTEGER DEFAULT 0"},
+	{"favlist", "cover_url", "TEXT DEFAULT ''"},
+	{"video", "file_hash", "TEXT DEFAULT ''"},
+	{"video", "verify_status", "TEXT DEFAULT ''"},
+	{"video", "verify_error", "TEXT DEFAULT ''"},
+	{"video", "verified_at", "DATETIME"},
+	{"video", "removed_at", "DATETIME"},
+	{"video", "deleted_at", "DATETIME"},
+}
+
+func (db *DB) migrate() error {
+	for _, m := range columnMigrations {
+		exists, err := db.columnExists(m.table, m.column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := db.conn.Exec(`ALTER TABLE ` + m.table + ` ADD COLUMN ` + m.column + ` ` + m.def); err != nil {
+			return fmt.Errorf("迁移 %s.%s 失败: %w", m.table, m.column, err)
+		}
+	}
+
+	// 依赖新增列的索引放在迁移之后创建
+	_, err := db.conn.Exec(`
+CREATE INDEX IF NOT EXISTS idx_video_favlist ON video(favlist_id);
+CREATE INDEX IF NOT EXISTS idx_video_uploader ON video(uploader_uid);
+CREATE INDEX IF NOT EXISTS idx_video_created_at ON video(created_at, id);
+`)
+	if err != nil {
+		return err
+	}
+
+	// 旧版本只在视频上记录第一个收藏夹，从中补齐对应关系
+	_, err = db.conn.Exec(`
+INSERT OR IGNORE INTO favlist_video (favlist_id, bvid, added_at, removed_at)
+SELECT favlist_id, bvid, created_at, CASE WHEN is_removed = 1 THEN COALESCE(removed_at, last_checked_at) END
+FROM video WHERE favlist_id IS NOT NULL AND favlist_id != 0;
+`)
+	if err != nil {
+		return err
+	}
+
+	// 从已有视频中补齐 UP 主记录
+	_, err = db.conn.Exec(`
+INSERT OR IGNORE INTO uploader (uid, name, face_url, first_seen_at, updated_at)
+SELECT uploader_uid, uploader_name, uploader_face, MIN(created_at), MAX(last_checked_at)
+FROM video WHERE uploader_uid IS NOT NULL AND uploader_uid != 0
+GROUP BY uploader_uid;
+INSERT OR IGNORE INTO uploader_name_history (uid, name, first_seen_at)
+SELECT uid, name, first_seen_at FROM uploader;
+`)
+	return err
+}
+
+func (db *DB) columnExists(table, column string) (bool, error) {
+	rows, err := db.conn.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
 // 示例：插入收藏夹
 func (db *DB) InsertFavlist(f *Favlist) error {
 	_, err := db.conn.Exec(
-		`INSERT OR REPLACE INTO favlist (id, name, cover, last_checked_at) VALUES (?, ?, ?, ?)`,
-		f.ID, f.Name, f.Cover, f.LastCheckedAt,
+		`INSERT OR REPLACE INTO favlist (id, name, cover, cover_url, last_checked_at) VALUES (?, ?, ?, ?, ?)`,
+		f.ID, f.Name, f.Cover, f.CoverURL, f.LastCheckedAt,
 	)
 	return err
 }
@@ -68,81 +330,26 @@ func (db *DB) InsertFavlist(f *Favlist) error {
 func (db *DB) InsertVideo(v *Video) error {
 	_, err := db.conn.Exec(
 		`INSERT OR REPLACE INTO video 
-        (bvid, title, cover, created_at, duration, page_count, desc, uploader_name, uploader_uid, uploader_face, last_checked_at, favlist_id, is_downloaded, is_invalid, is_removed)
-        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		v.BVID, v.Title, v.Cover, v.CreatedAt, v.Duration, v.PageCount, v.Desc,
+        (bvid, title, cover, cover_url, created_at, pubdate, fav_time, duration, page_count, desc, uploader_name, uploader_uid, uploader_face, last_checked_at, favlist_id, is_downloaded, is_invalid, is_removed, file_path, file_size)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		v.BVID, v.Title, v.Cover, v.CoverURL, v.CreatedAt, v.Pubdate, v.FavTime, v.Duration, v.PageCount, v.Desc,
 		v.UploaderName, v.UploaderUID, v.UploaderFace, v.LastCheckedAt, v.FavlistID,
 		boolToInt(v.IsDownloaded), boolToInt(v.IsInvalid), boolToInt(v.IsRemoved),
+		v.FilePath, v.FileSize,
 	)
 	return err
 }
 
 // 查询视频信息（所有字段）
 func (db *DB) GetVideoByBVID(bvid string) (*Video, error) {
-	row := db.conn.QueryRow(`
-        SELECT bvid, title, cover, created_at, duration, page_count, desc, uploader_name, uploader_uid, uploader_face, last_checked_at, favlist_id, is_downloaded, is_invalid, is_removed
-        FROM video WHERE bvid = ?`, bvid)
-
-	var v Video
-	var isDownloaded, isInvalid, isRemoved int
-	err := row.Scan(
-		&v.BVID, &v.Title, &v.Cover, &v.CreatedAt, &v.Duration, &v.PageCount, &v.Desc,
-		&v.UploaderName, &v.UploaderUID, &v.UploaderFace, &v.LastCheckedAt, &v.FavlistID,
-		&isDownloaded, &isInvalid, &isRemoved,
-	)
-	if err != nil {
-		return nil, err
-	}
-	v.IsDownloaded = isDownloaded != 0
-	v.IsInvalid = isInvalid != 0
-	v.IsRemoved = isRemoved != 0
-	return &v, nil
-}
-
-// 查询所有视频，支持分页
-func (db *DB) ListVideos(page, pageSize int) ([]*Video, error) {
-	if page < 1 {
-		page = 1
-	}
-	if pageSize <= 0 || pageSize > 10000 {
-		pageSize = 10000
-	}
-	offset := (page - 1) * pageSize
-
-	rows, err := db.conn.Query(`
-        SELECT bvid, title, cover, created_at, duration, page_count, desc, uploader_name, uploader_uid, uploader_face, last_checked_at, favlist_id, is_downloaded, is_invalid, is_removed
-        FROM video
-        ORDER BY created_at DESC
-        LIMIT ? OFFSET ?`, pageSize, offset)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var videos []*Video
-	for rows.Next() {
-		var v Video
-		var isDownloaded, isInvalid, isRemoved int
-		err := rows.Scan(
-			&v.BVID, &v.Title, &v.Cover, &v.CreatedAt, &v.Duration, &v.PageCount, &v.Desc,
-			&v.UploaderName, &v.UploaderUID, &v.UploaderFace, &v.LastCheckedAt, &v.FavlistID,
-			&isDownloaded, &isInvalid, &isRemoved,
-		)
-		if err != nil {
-			return nil, err
-		}
-		v.IsDownloaded = isDownloaded != 0
-		v.IsInvalid = isInvalid != 0
-		v.IsRemoved = isRemoved != 0
-		videos = append(videos, &v)
-	}
-	return videos, nil
+	row := db.conn.QueryRow(`SELECT `+videoColumns+` FROM video WHERE bvid = ?`, bvid)
+	return scanVideo(row)
 }
 
 // 获取所有收藏夹
 func (db *DB) ListFavlists() ([]*Favlist, error) {
 	rows, err := db.conn.Query(`
-        SELECT id, name, cover, last_checked_at
+        SELECT id, name, cover, cover_url, last_checked_at
         FROM favlist
         ORDER BY id ASC`)
 	if err != nil {
@@ -153,15 +360,28 @@ func (db *DB) ListFavlists() ([]*Favlist, error) {
 	var favlists []*Favlist
 	for rows.Next() {
 		var f Favlist
-		err := rows.Scan(&f.ID, &f.Name, &f.Cover, &f.LastCheckedAt)
+		var cover, coverURL sql.NullString
+		err := rows.Scan(&f.ID, &f.Name, &cover, &coverURL, &f.LastCheckedAt)
 		if err != nil {
 			return nil, err
 		}
+		f.Cover = cover.String
+		f.CoverURL = coverURL.String
 		favlists = append(favlists, &f)
 	}
 	return favlists, nil
 }
 
+// 记录视频的本地文件，并标记为已下载。文件在下载时已通过校验
+func (db *DB) SetVideoFile(bvid, path string, size int64, hash string) error {
+	_, err := db.conn.Exec(
+		`UPDATE video SET is_downloaded = 1, file_path = ?, file_size = ?, file_hash = ?,
+        verify_status = ?, verify_error = '', verified_at = ?, deleted_at = NULL WHERE bvid = ?`,
+		path, size, hash, VerifyOK, time.Now(), bvid,
+	)
+	return err
+}
+
 // 更新视频为已下载
 func (db *DB) UpdateVideoDownloaded(bvid string, downloaded bool) error {
 	val := 0
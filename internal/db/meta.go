@@ -0,0 +1,194 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// VideoArchive 汇总一个视频归档的全部元数据
+type VideoArchive struct {
+	Meta  *VideoMeta
+	Tags  []VideoTag
+	Pages []VideoPage
+	Stat  *VideoStat // 最新一次快照
+}
+
+// SaveVideoArchive 写入元数据、TAG、分P列表，并追加一次数据快照。
+// TAG 与分P以最新结果为准整体替换
+func (db *DB) SaveVideoArchive(a *VideoArchive) error {
+	if a.Meta == nil {
+		return errors.New("缺少视频元数据")
+	}
+	bvid := a.Meta.BVID
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	m := a.Meta
+	_, err = tx.Exec(`
+INSERT OR REPLACE INTO video_meta (bvid, aid, tid, tname, copyright, pubdate, ctime, state, dynamic, raw, fetched_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		m.BVID, m.AID, m.Tid, m.Tname, m.Copyright, m.Pubdate, m.Ctime, m.State, m.Dynamic, m.Raw, m.FetchedAt,
+	)
+	if err != nil {
+		return err
+	}
+	// 收藏夹同步时未能获得发布时间的旧记录在这里补齐
+	if _, err := tx.Exec(`UPDATE video SET pubdate = ? WHERE bvid = ? AND pubdate IS NULL`, m.Pubdate, bvid); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM video_tag WHERE bvid = ?`, bvid); err != nil {
+		return err
+	}
+	for _, t := range a.Tags {
+		if _, err := tx.Exec(`INSERT OR REPLACE INTO video_tag (bvid, tag_id, tag_name) VALUES (?, ?, ?)`, bvid, t.TagID, t.TagName); err != nil {
+			return err
+		}
+	}
+
+	// 分P的弹幕状态由下载流程单独维护，这里只更新基础信息
+	if _, err := tx.Exec(`DELETE FROM video_page WHERE bvid = ? AND page > ?`, bvid, len(a.Pages)); err != nil {
+		return err
+	}
+	for _, p := range a.Pages {
+		_, err := tx.Exec(`
+INSERT INTO video_page (bvid, page, cid, part, duration, width, height) VALUES (?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT(bvid, page) DO UPDATE SET cid = excluded.cid, part = excluded.part, duration = excluded.duration,
+    width = excluded.width, height = excluded.height`,
+			bvid, p.Page, p.CID, p.Part, p.Duration, p.Width, p.Height,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	if s := a.Stat; s != nil {
+		_, err := tx.Exec(`
+INSERT INTO video_stat (bvid, view, danmaku, reply, favorite, coin, share, like_count, captured_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			bvid, s.View, s.Danmaku, s.Reply, s.Favorite, s.Coin, s.Share, s.Like, s.CapturedAt,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetVideoArchive 查询视频的归档元数据，从未获取过时返回 sql.ErrNoRows
+func (db *DB) GetVideoArchive(bvid string) (*VideoArchive, error) {
+	var m VideoMeta
+	var tname, dynamic, raw sql.NullString
+	var pubdate, ctime, fetchedAt sql.NullTime
+	err := db.conn.QueryRow(`
+SELECT bvid, aid, tid, tname, copyright, pubdate, ctime, state, dynamic, raw, fetched_at
+FROM video_meta WHERE bvid = ?`, bvid).Scan(
+		&m.BVID, &m.AID, &m.Tid, &tname, &m.Copyright, &pubdate, &ctime, &m.State, &dynamic, &raw, &fetchedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	m.Tname = tname.String
+	m.Dynamic = dynamic.String
+	m.Raw = raw.String
+	m.Pubdate = pubdate.Time
+	m.Ctime = ctime.Time
+	m.FetchedAt = fetchedAt.Time
+
+	a := &VideoArchive{Meta: &m}
+	if a.Tags, err = db.ListVideoTags(bvid); err != nil {
+		return nil, err
+	}
+	if a.Pages, err = db.ListVideoPages(bvid); err != nil {
+		return nil, err
+	}
+	stats, err := db.ListVideoStats(bvid, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(stats) > 0 {
+		a.Stat = stats[0]
+	}
+	return a, nil
+}
+
+func (db *DB) ListVideoTags(bvid string) ([]VideoTag, error) {
+	rows, err := db.conn.Query(`SELECT tag_id, tag_name FROM video_tag WHERE bvid = ? ORDER BY tag_id`, bvid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make([]VideoTag, 0)
+	for rows.Next() {
+		var t VideoTag
+		if err := rows.Scan(&t.TagID, &t.TagName); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+func (db *DB) ListVideoPages(bvid string) ([]VideoPage, error) {
+	rows, err := db.conn.Query(
+		`SELECT bvid, page, cid, part, duration, width, height, danmaku_status, danmaku_count FROM video_page WHERE bvid = ? ORDER BY page`, bvid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pages := make([]VideoPage, 0)
+	for rows.Next() {
+		var p VideoPage
+		var status sql.NullString
+		var count sql.NullInt64
+		if err := rows.Scan(&p.BVID, &p.Page, &p.CID, &p.Part, &p.Duration, &p.Width, &p.Height, &status, &count); err != nil {
+			return nil, err
+		}
+		p.DanmakuStatus = status.String
+		p.DanmakuCount = int(count.Int64)
+		pages = append(pages, p)
+	}
+	return pages, rows.Err()
+}
+
+// 查询数据快照，按时间倒序，limit <= 0 表示不限制
+func (db *DB) ListVideoStats(bvid string, limit int) ([]*VideoStat, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := db.conn.Query(`
+SELECT bvid, view, danmaku, reply, favorite, coin, share, like_count, captured_at
+FROM video_stat WHERE bvid = ? ORDER BY captured_at DESC, id DESC LIMIT ?`, bvid, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := make([]*VideoStat, 0)
+	for rows.Next() {
+		var s VideoStat
+		var capturedAt sql.NullTime
+		if err := rows.Scan(&s.BVID, &s.View, &s.Danmaku, &s.Reply, &s.Favorite, &s.Coin, &s.Share, &s.Like, &capturedAt); err != nil {
+			return nil, err
+		}
+		s.CapturedAt = capturedAt.Time
+		stats = append(stats, &s)
+	}
+	return stats, rows.Err()
+}
+
+// 更新分P的弹幕下载状态，分P记录不存在时一并创建
+func (db *DB) UpdatePageDanmaku(bvid string, page int, cid int64, status string, count int) error {
+	_, err := db.conn.Exec(`
+INSERT INTO video_page (bvid, page, cid, danmaku_status, danmaku_count) VALUES (?, ?, ?, ?, ?)
+ON CONFLICT(bvid, page) DO UPDATE SET danmaku_status = excluded.danmaku_status, danmaku_count = excluded.danmaku_count`,
+		bvid, page, cid, status, count,
+	)
+	return err
+}
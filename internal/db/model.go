@@ -6,6 +6,7 @@ type Favlist struct {
 	ID            int64     `db:"id"`
 	Name          string    `db:"name"`
 	Cover         string    `db:"cover"`
+	CoverURL      string    `db:"cover_url"`
 	LastCheckedAt time.Time `db:"last_checked_at"`
 }
 
@@ -14,7 +15,10 @@ type Video struct {
 	BVID          string    `db:"bvid"`
 	Title         string    `db:"title"`
 	Cover         string    `db:"cover"`
+	CoverURL      string    `db:"cover_url"` // 远程封面地址，用于检测封面变更
 	CreatedAt     time.Time `db:"created_at"`
+	Pubdate       time.Time `db:"pubdate"`  // 发布时间
+	FavTime       time.Time `db:"fav_time"` // 收藏时间
 	Duration      int       `db:"duration"`
 	PageCount     int       `db:"page_count"`
 	Desc          string    `db:"desc"`
@@ -26,4 +30,153 @@ type Video struct {
 	IsDownloaded  bool      `db:"is_downloaded"` // 新增：是否下载完成
 	IsInvalid     bool      `db:"is_invalid"`    // 新增：是否失效
 	IsRemoved     bool      `db:"is_removed"`    // 新增：是否被移除
+	FilePath      string    `db:"file_path"`     // 本地文件路径
+	FileSize      int64     `db:"file_size"`     // 本地文件大小（字节）
+	FileHash      string    `db:"file_hash"`     // 本地文件的 sha256
+	VerifyStatus  string    `db:"verify_status"` // 校验结果，见 VerifyOK 等常量，未校验时为空
+	VerifyError   string    `db:"verify_error"`
+	VerifiedAt    time.Time `db:"verified_at"`
+	RemovedAt     time.Time `db:"removed_at"` // 从收藏夹移除的时间
+	DeletedAt     time.Time `db:"deleted_at"` // 本地文件被清理规则删除的时间，删除后不再重新下载
+}
+
+// VideoMeta 保存视频详情接口返回的完整元数据
+type VideoMeta struct {
+	BVID      string    `db:"bvid"`
+	AID       int64     `db:"aid"`
+	Tid       int       `db:"tid"`       // 分区ID
+	Tname     string    `db:"tname"`     // 子分区名称
+	Copyright int       `db:"copyright"` // 1：原创，2：转载
+	Pubdate   time.Time `db:"pubdate"`
+	Ctime     time.Time `db:"ctime"`
+	State     int       `db:"state"`
+	Dynamic   string    `db:"dynamic"`
+	Raw       string    `db:"raw"` // 接口原始JSON
+	FetchedAt time.Time `db:"fetched_at"`
+}
+
+type VideoTag struct {
+	TagID   int64  `db:"tag_id"`
+	TagName string `db:"tag_name"`
+}
+
+// VideoPage 为视频的一个分P
+type VideoPage struct {
+	BVID     string `db:"bvid"`
+	Page     int    `db:"page"`
+	CID      int64  `db:"cid"`
+	Part     string `db:"part"` // 分P标题
+	Duration int    `db:"duration"`
+	Width    int    `db:"width"`
+	Height   int    `db:"height"`
+
+	DanmakuStatus string `db:"danmaku_status"` // 见 downloader 中的弹幕状态
+	DanmakuCount  int    `db:"danmaku_count"`
+}
+
+// VideoSubtitle 为一个分P已下载的一条字幕轨道
+type VideoSubtitle struct {
+	BVID      string    `db:"bvid"`
+	Page      int       `db:"page"`
+	CID       int64     `db:"cid"`
+	Lan       string    `db:"lan"`     // 语言代码
+	LanDoc    string    `db:"lan_doc"` // 语言名称
+	IsAI      bool      `db:"is_ai"`
+	Path      string    `db:"path"`    // 不含扩展名的文件路径
+	Formats   []string  `db:"formats"` // json、srt、vtt
+	FetchedAt time.Time `db:"fetched_at"`
+}
+
+// VideoStat 为某一时刻的播放、点赞等数据快照
+type VideoStat struct {
+	BVID       string    `db:"bvid"`
+	View       int       `db:"view"`
+	Danmaku    int       `db:"danmaku"`
+	Reply      int       `db:"reply"`
+	Favorite   int       `db:"favorite"`
+	Coin       int       `db:"coin"`
+	Share      int       `db:"share"`
+	Like       int       `db:"like_count"`
+	CapturedAt time.Time `db:"captured_at"`
+}
+
+// VideoRevision 记录一次同步中检测到的单个字段变化
+type VideoRevision struct {
+	ID        int64     `db:"id"`
+	BVID      string    `db:"bvid"`
+	Field     string    `db:"field"`
+	OldValue  string    `db:"old_value"`
+	NewValue  string    `db:"new_value"`
+	ChangedAt time.Time `db:"changed_at"`
+}
+
+type Uploader struct {
+	UID           int64     `db:"uid"`
+	Name          string    `db:"name"`
+	FaceURL       string    `db:"face_url"` // 远程头像地址
+	Face          string    `db:"face"`     // 本地头像地址，供前端访问
+	Sign          string    `db:"sign"`
+	Fans          int       `db:"fans"`      // 粉丝数，获取失败时为 0
+	Attention     int       `db:"attention"` // 关注数
+	ArchiveCount  int       `db:"archive_count"`
+	FirstSeenAt   time.Time `db:"first_seen_at"`
+	UpdatedAt     time.Time `db:"updated_at"`
+	ProfileSynced time.Time `db:"profile_synced_at"` // 上次拉取名片信息的时间
+}
+
+// UploaderStats 为 UP 主附带的本地统计
+type UploaderStats struct {
+	Uploader
+	VideoCount      int
+	DownloadedCount int
+	DownloadedBytes int64
+}
+
+type UploaderName struct {
+	Name        string    `db:"name"`
+	FirstSeenAt time.Time `db:"first_seen_at"`
+}
+
+// Asset 记录封面、头像等图片资源的本地副本
+type Asset struct {
+	Kind        string    `db:"kind"`
+	OwnerKey    string    `db:"owner_key"`
+	URL         string    `db:"url"`
+	Hash        string    `db:"hash"`
+	Path        string    `db:"path"`
+	Size        int64     `db:"size"`
+	ContentType string    `db:"content_type"`
+	Status      string    `db:"status"`
+	Attempts    int       `db:"attempts"`
+	LastError   string    `db:"last_error"`
+	UpdatedAt   time.Time `db:"updated_at"`
+}
+
+// MissingAsset 为缺少本地副本、需要补齐的资源
+type MissingAsset struct {
+	Kind     string
+	OwnerKey string
+	URL      string
+}
+
+// CleanupLog 记录清理规则删除的一个文件
+type CleanupLog struct {
+	ID        int64     `db:"id"`
+	BVID      string    `db:"bvid"`
+	FavlistID int64     `db:"favlist_id"`
+	Title     string    `db:"title"`
+	Path      string    `db:"path"`
+	Size      int64     `db:"size"`
+	Reason    string    `db:"reason"`
+	DeletedAt time.Time `db:"deleted_at"`
+}
+
+// QueuedDownload 为关闭时尚未完成的下载任务，下次启动时重新加入队列
+type QueuedDownload struct {
+	BVID      string    `db:"bvid"`
+	Title     string    `db:"title"`
+	Status    string    `db:"status"`   // 关闭时的状态：queued 或 canceled（下载中被中断）
+	Progress  float64   `db:"progress"` // 中断时的进度
+	CreatedAt time.Time `db:"created_at"`
+	SavedAt   time.Time `db:"saved_at"`
 }
@@ -0,0 +1,59 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// 用关闭时的下载队列替换已保存的队列
+func (db *DB) SaveDownloadQueue(items []QueuedDownload) error {
+	now := time.Now()
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM download_queue`); err != nil {
+		return err
+	}
+	for _, q := range items {
+		_, err := tx.Exec(
+			`INSERT OR REPLACE INTO download_queue (bvid, title, status, progress, created_at, saved_at) VALUES (?, ?, ?, ?, ?, ?)`,
+			q.BVID, q.Title, q.Status, q.Progress, q.CreatedAt, now,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// 按加入队列的顺序返回保存的下载任务
+func (db *DB) ListDownloadQueue() ([]QueuedDownload, error) {
+	rows, err := db.conn.Query(`
+SELECT bvid, title, status, progress, created_at, saved_at
+FROM download_queue ORDER BY created_at, bvid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]QueuedDownload, 0)
+	for rows.Next() {
+		var q QueuedDownload
+		var title, status sql.NullString
+		if err := rows.Scan(&q.BVID, &title, &status, &q.Progress, &q.CreatedAt, &q.SavedAt); err != nil {
+			return nil, err
+		}
+		q.Title = title.String
+		q.Status = status.String
+		items = append(items, q)
+	}
+	return items, rows.Err()
+}
+
+func (db *DB) ClearDownloadQueue() error {
+	_, err := db.conn.Exec(`DELETE FROM download_queue`)
+	return err
+}
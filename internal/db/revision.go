@@ -0,0 +1,64 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// UpdateVideoMetadata 用同步得到的元数据覆盖视频记录，并在同一事务中写入变更历史
+func (db *DB) UpdateVideoMetadata(v *Video, revisions []VideoRevision) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+UPDATE video SET title = ?, cover = ?, cover_url = ?, desc = ?, duration = ?, page_count = ?, is_invalid = ?, last_checked_at = ?
+WHERE id = ?`,
+		v.Title, v.Cover, v.CoverURL, v.Desc, v.Duration, v.PageCount, boolToInt(v.IsInvalid), v.LastCheckedAt, v.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range revisions {
+		_, err := tx.Exec(
+			`INSERT INTO video_revision (bvid, field, old_value, new_value, changed_at) VALUES (?, ?, ?, ?, ?)`,
+			v.BVID, r.Field, r.OldValue, r.NewValue, r.ChangedAt,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// 查询视频的变更历史，按时间先后排序
+func (db *DB) ListVideoRevisions(bvid string) ([]*VideoRevision, error) {
+	rows, err := db.conn.Query(`
+SELECT id, bvid, field, old_value, new_value, changed_at
+FROM video_revision WHERE bvid = ? ORDER BY changed_at ASC, id ASC`, bvid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := make([]*VideoRevision, 0)
+	for rows.Next() {
+		var r VideoRevision
+		var changedAt sql.NullTime
+		if err := rows.Scan(&r.ID, &r.BVID, &r.Field, &r.OldValue, &r.NewValue, &changedAt); err != nil {
+			return nil, err
+		}
+		r.ChangedAt = changedAt.Time
+		revisions = append(revisions, &r)
+	}
+	return revisions, rows.Err()
+}
+
+// 更新视频的最后检查时间
+func (db *DB) TouchVideo(id int64, checkedAt time.Time) error {
+	_, err := db.conn.Exec(`UPDATE video SET last_checked_at = ? WHERE id = ?`, checkedAt, id)
+	return err
+}
@@ -0,0 +1,45 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// 写入或更新一条字幕轨道
+func (db *DB) SaveVideoSubtitle(s *VideoSubtitle) error {
+	_, err := db.conn.Exec(`
+INSERT OR REPLACE INTO video_subtitle (bvid, page, cid, lan, lan_doc, is_ai, path, formats, fetched_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		s.BVID, s.Page, s.CID, s.Lan, s.LanDoc, boolToInt(s.IsAI), s.Path, strings.Join(s.Formats, ","), s.FetchedAt,
+	)
+	return err
+}
+
+// 查询视频已下载的字幕轨道，按分P与语言排序
+func (db *DB) ListVideoSubtitles(bvid string) ([]*VideoSubtitle, error) {
+	rows, err := db.conn.Query(`
+SELECT bvid, page, cid, lan, lan_doc, is_ai, path, formats, fetched_at
+FROM video_subtitle WHERE bvid = ? ORDER BY page, lan`, bvid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subtitles := make([]*VideoSubtitle, 0)
+	for rows.Next() {
+		var s VideoSubtitle
+		var isAI int
+		var formats string
+		var fetchedAt sql.NullTime
+		if err := rows.Scan(&s.BVID, &s.Page, &s.CID, &s.Lan, &s.LanDoc, &isAI, &s.Path, &formats, &fetchedAt); err != nil {
+			return nil, err
+		}
+		s.IsAI = isAI != 0
+		if formats != "" {
+			s.Formats = strings.Split(formats, ",")
+		}
+		s.FetchedAt = fetchedAt.Time
+		subtitles = append(subtitles, &s)
+	}
+	return subtitles, rows.Err()
+}
@@ -0,0 +1,38 @@
+package db
+
+import "time"
+
+// 记录上传失败的视频，重复失败时累加次数
+func (db *DB) SavePendingUpload(bvid, lastError string) error {
+	_, err := db.conn.Exec(`
+INSERT INTO pending_upload (bvid, attempts, last_error, updated_at) VALUES (?, 1, ?, ?)
+ON CONFLICT(bvid) DO UPDATE SET attempts = attempts + 1, last_error = excluded.last_error, updated_at = excluded.updated_at`,
+		bvid, lastError, time.Now(),
+	)
+	return err
+}
+
+// 上传成功后清除记录
+func (db *DB) DeletePendingUpload(bvid string) error {
+	_, err := db.conn.Exec(`DELETE FROM pending_upload WHERE bvid = ?`, bvid)
+	return err
+}
+
+// 查询待重新上传的视频，最早失败的在前
+func (db *DB) ListPendingUploads(limit int) ([]string, error) {
+	rows, err := db.conn.Query(`SELECT bvid FROM pending_upload ORDER BY updated_at ASC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bvids []string
+	for rows.Next() {
+		var bvid string
+		if err := rows.Scan(&bvid); err != nil {
+			return nil, err
+		}
+		bvids = append(bvids, bvid)
+	}
+	return bvids, rows.Err()
+}
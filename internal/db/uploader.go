@@ -0,0 +1,180 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// UpsertUploader 写入 UP 主的基础信息（昵称与远程头像），昵称变化时记录历史。
+// 本地头像与名片信息由 UpdateUploaderFace / UpdateUploaderProfile 单独维护
+func (db *DB) UpsertUploader(uid int64, name, faceURL string) error {
+	now := time.Now()
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+INSERT INTO uploader (uid, name, face_url, first_seen_at, updated_at) VALUES (?, ?, ?, ?, ?)
+ON CONFLICT(uid) DO UPDATE SET name = excluded.name, face_url = excluded.face_url, updated_at = excluded.updated_at`,
+		uid, name, faceURL, now, now,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		`INSERT OR IGNORE INTO uploader_name_history (uid, name, first_seen_at) VALUES (?, ?, ?)`,
+		uid, name, now,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// 更新本地头像地址
+func (db *DB) UpdateUploaderFace(uid int64, face string) error {
+	_, err := db.conn.Exec(`UPDATE uploader SET face = ? WHERE uid = ?`, face, uid)
+	return err
+}
+
+// 更新名片信息（签名、粉丝数等）
+func (db *DB) UpdateUploaderProfile(u *Uploader) error {
+	_, err := db.conn.Exec(
+		`UPDATE uploader SET sign = ?, fans = ?, attention = ?, archive_count = ?, profile_synced_at = ? WHERE uid = ?`,
+		u.Sign, u.Fans, u.Attention, u.ArchiveCount, time.Now(), u.UID,
+	)
+	return err
+}
+
+const uploaderColumns = `u.uid, u.name, u.face_url, u.face, u.sign, u.fans, u.attention, u.archive_count, u.first_seen_at, u.updated_at, u.profile_synced_at`
+
+func scanUploader(row rowScanner, extra ...any) (*Uploader, error) {
+	var u Uploader
+	var name, faceURL, face, sign sql.NullString
+	var firstSeen, updated, synced sql.NullTime
+	dest := []any{&u.UID, &name, &faceURL, &face, &sign, &u.Fans, &u.Attention, &u.ArchiveCount, &firstSeen, &updated, &synced}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	u.Name = name.String
+	u.FaceURL = faceURL.String
+	u.Face = face.String
+	u.Sign = sign.String
+	u.FirstSeenAt = firstSeen.Time
+	u.UpdatedAt = updated.Time
+	u.ProfileSynced = synced.Time
+	return &u, nil
+}
+
+// 查询单个 UP 主
+func (db *DB) GetUploader(uid int64) (*Uploader, error) {
+	row := db.conn.QueryRow(`SELECT `+uploaderColumns+` FROM uploader u WHERE u.uid = ?`, uid)
+	return scanUploader(row)
+}
+
+// 查询 UP 主的昵称历史，按首次出现时间排序
+func (db *DB) ListUploaderNames(uid int64) ([]UploaderName, error) {
+	rows, err := db.conn.Query(
+		`SELECT name, first_seen_at FROM uploader_name_history WHERE uid = ? ORDER BY first_seen_at ASC`, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := make([]UploaderName, 0)
+	for rows.Next() {
+		var n UploaderName
+		var seen sql.NullTime
+		if err := rows.Scan(&n.Name, &seen); err != nil {
+			return nil, err
+		}
+		n.FirstSeenAt = seen.Time
+		names = append(names, n)
+	}
+	return names, rows.Err()
+}
+
+var uploaderSortColumns = map[string]string{
+	"uid":              "u.uid",
+	"name":             "COALESCE(u.name, '')",
+	"video_count":      "video_count",
+	"downloaded_bytes": "downloaded_bytes",
+	"fans":             "u.fans",
+}
+
+// 分页查询 UP 主及其视频数量、已下载数量与已下载字节数
+func (db *DB) ListUploaders(page, pageSize int, sortBy string, desc bool) ([]*UploaderStats, int, error) {
+	if pageSize <= 0 || pageSize > MaxPageSize {
+		return nil, 0, ErrInvalidPageSize
+	}
+	if page < 1 {
+		page = 1
+	}
+	if sortBy == "" {
+		sortBy = "video_count"
+	}
+	sortExpr, ok := uploaderSortColumns[sortBy]
+	if !ok {
+		return nil, 0, ErrInvalidSort
+	}
+	order := "ASC"
+	if desc {
+		order = "DESC"
+	}
+
+	var total int
+	if err := db.conn.QueryRow(`SELECT COUNT(*) FROM uploader`).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := fmt.Sprintf(`
+SELECT %s,
+    COUNT(v.id) AS video_count,
+    COALESCE(SUM(v.is_downloaded), 0) AS downloaded_count,
+    COALESCE(SUM(CASE WHEN v.is_downloaded = 1 THEN v.file_size ELSE 0 END), 0) AS downloaded_bytes
+FROM uploader u
+LEFT JOIN video v ON v.uploader_uid = u.uid
+GROUP BY u.uid
+ORDER BY %s %s, u.uid ASC
+LIMIT ? OFFSET ?`, uploaderColumns, sortExpr, order)
+	rows, err := db.conn.Query(query, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	list := make([]*UploaderStats, 0, pageSize)
+	for rows.Next() {
+		var s UploaderStats
+		u, err := scanUploader(rows, &s.VideoCount, &s.DownloadedCount, &s.DownloadedBytes)
+		if err != nil {
+			return nil, 0, err
+		}
+		s.Uploader = *u
+		list = append(list, &s)
+	}
+	return list, total, rows.Err()
+}
+
+// 查询单个 UP 主的本地统计
+func (db *DB) GetUploaderStats(uid int64) (*UploaderStats, error) {
+	row := db.conn.QueryRow(`
+SELECT `+uploaderColumns+`,
+    COUNT(v.id),
+    COALESCE(SUM(v.is_downloaded), 0),
+    COALESCE(SUM(CASE WHEN v.is_downloaded = 1 THEN v.file_size ELSE 0 END), 0)
+FROM uploader u
+LEFT JOIN video v ON v.uploader_uid = u.uid
+WHERE u.uid = ?
+GROUP BY u.uid`, uid)
+	var s UploaderStats
+	u, err := scanUploader(row, &s.VideoCount, &s.DownloadedCount, &s.DownloadedBytes)
+	if err != nil {
+		return nil, err
+	}
+	s.Uploader = *u
+	return &s, nil
+}
@@ -0,0 +1,48 @@
+package db
+
+import "time"
+
+// 本地文件的校验结果
+const (
+	VerifyOK      = "ok"
+	VerifyCorrupt = "corrupt"
+	VerifyMissing = "missing"
+)
+
+// 记录一次校验结果，hash 为空时保留原有的哈希
+func (db *DB) SetVideoVerification(bvid, hash, status, verifyErr string) error {
+	_, err := db.conn.Exec(`
+UPDATE video SET file_hash = CASE WHEN ? = '' THEN file_hash ELSE ? END,
+    verify_status = ?, verify_error = ?, verified_at = ?
+WHERE bvid = ?`, hash, hash, status, verifyErr, time.Now(), bvid)
+	return err
+}
+
+// 本地文件丢失时清除下载标记，视频会在下次同步时重新加入下载队列
+func (db *DB) ResetVideoFile(bvid string) error {
+	_, err := db.conn.Exec(`
+UPDATE video SET is_downloaded = 0, file_path = '', file_size = 0, file_hash = '',
+    verify_status = ?, verify_error = '文件不存在', verified_at = ?
+WHERE bvid = ?`, VerifyMissing, time.Now(), bvid)
+	return err
+}
+
+// 文件被移动或改名后更新记录的路径，保留原有的哈希与校验结果
+func (db *DB) UpdateVideoFilePath(bvid, path string, size int64) error {
+	_, err := db.conn.Exec(`UPDATE video SET file_path = ?, file_size = ? WHERE bvid = ?`, path, size, bvid)
+	return err
+}
+
+// 已下载视频占用的空间，favlistID 为 0 时统计全部收藏夹
+func (db *DB) DownloadedBytes(favlistID int64) (int64, error) {
+	query := `SELECT COALESCE(SUM(file_size), 0) FROM video WHERE is_downloaded = 1`
+	var args []any
+	// 同一视频在多个收藏夹中时计入每个收藏夹
+	if favlistID != 0 {
+		query += ` AND bvid IN (SELECT bvid FROM favlist_video WHERE favlist_id = ?)`
+		args = append(args, favlistID)
+	}
+	var total int64
+	err := db.conn.QueryRow(query, args...).Scan(&total)
+	return total, err
+}
@@ -0,0 +1,305 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 单次查询允许的最大分页大小
+const MaxPageSize = 1000
+
+var (
+	ErrInvalidPageSize = fmt.Errorf("分页大小必须在 1 到 %d 之间", MaxPageSize)
+	ErrInvalidSort     = errors.New("不支持的排序字段")
+	ErrInvalidCursor   = errors.New("无效的分页游标")
+)
+
+// 可排序字段与对应的 SQL 表达式。NULL 统一折叠为零值，保证游标比较稳定
+var videoSortColumns = map[string]string{
+	"id":         "id",
+	"created_at": "COALESCE(created_at, '')",
+	"pubdate":    "COALESCE(pubdate, '')",
+	"fav_time":   "COALESCE(fav_time, '')",
+	"duration":   "COALESCE(duration, 0)",
+	"title":      "COALESCE(title, '')",
+	"favlist":    "COALESCE(favlist_id, 0)",
+	"uploader":   "COALESCE(uploader_name, '')",
+	"downloaded": "is_downloaded",
+	"invalid":    "is_invalid",
+	"removed":    "is_removed",
+	"removed_at": "COALESCE(removed_at, '')",
+}
+
+// VideoFilter 描述视频列表的筛选、排序和分页条件，零值字段表示不限制
+type VideoFilter struct {
+	FavlistID    int64
+	UploaderUID  int64
+	IsDownloaded *bool
+	IsInvalid    *bool
+	IsRemoved    *bool
+	MinDuration  int
+	MaxDuration  int
+	PubdateFrom  time.Time
+	PubdateTo    time.Time
+	FavTimeFrom  time.Time
+	FavTimeTo    time.Time
+	Tag          string // 按TAG名称筛选，需要已归档元数据
+	Tid          int    // 按分区筛选
+	Copyright    int    // 1：原创，2：转载
+	VerifyStatus string // 按校验结果筛选
+
+	SortBy string // 见 videoSortColumns，默认 created_at
+	Desc   bool
+
+	Page     int
+	PageSize int
+	Cursor   string // 非空时使用游标分页，忽略 Page
+}
+
+type VideoList struct {
+	Videos     []*Video
+	Total      int
+	NextCursor string
+}
+
+const videoColumns = `id, bvid, title, cover, cover_url, created_at, pubdate, fav_time, duration, page_count, desc, uploader_name, uploader_uid, uploader_face, last_checked_at, favlist_id, is_downloaded, is_invalid, is_removed, file_path, file_size, file_hash, verify_status, verify_error, verified_at, removed_at, deleted_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanVideo(row rowScanner) (*Video, error) {
+	var v Video
+	var pubdate, favTime sql.NullTime
+	var isDownloaded, isInvalid, isRemoved int
+	var filePath, coverURL, fileHash, verifyStatus, verifyError sql.NullString
+	var fileSize sql.NullInt64
+	var verifiedAt, removedAt, deletedAt sql.NullTime
+	err := row.Scan(
+		&v.ID, &v.BVID, &v.Title, &v.Cover, &coverURL, &v.CreatedAt, &pubdate, &favTime, &v.Duration, &v.PageCount, &v.Desc,
+		&v.UploaderName, &v.UploaderUID, &v.UploaderFace, &v.LastCheckedAt, &v.FavlistID,
+		&isDownloaded, &isInvalid, &isRemoved, &filePath, &fileSize,
+		&fileHash, &verifyStatus, &verifyError, &verifiedAt, &removedAt, &deletedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	v.CoverURL = coverURL.String
+	v.FilePath = filePath.String
+	v.FileSize = fileSize.Int64
+	v.FileHash = fileHash.String
+	v.VerifyStatus = verifyStatus.String
+	v.VerifyError = verifyError.String
+	v.VerifiedAt = verifiedAt.Time
+	v.RemovedAt = removedAt.Time
+	v.DeletedAt = deletedAt.Time
+	v.Pubdate = pubdate.Time
+	v.FavTime = favTime.Time
+	v.IsDownloaded = isDownloaded != 0
+	v.IsInvalid = isInvalid != 0
+	v.IsRemoved = isRemoved != 0
+	return &v, nil
+}
+
+// ListVideos 按条件查询视频，同时返回满足条件的总数
+func (db *DB) ListVideos(f VideoFilter) (*VideoList, error) {
+	if f.PageSize <= 0 || f.PageSize > MaxPageSize {
+		return nil, ErrInvalidPageSize
+	}
+	if f.Page < 1 {
+		f.Page = 1
+	}
+	if f.SortBy == "" {
+		f.SortBy = "created_at"
+	}
+	sortExpr, ok := videoSortColumns[f.SortBy]
+	if !ok {
+		return nil, ErrInvalidSort
+	}
+
+	where, args := f.conditions()
+
+	var total int
+	if err := db.conn.QueryRow(`SELECT COUNT(*) FROM video`+where, args...).Scan(&total); err != nil {
+		return nil, err
+	}
+
+	order := "ASC"
+	cmp := ">"
+	if f.Desc {
+		order = "DESC"
+		cmp = "<"
+	}
+
+	offset := (f.Page - 1) * f.PageSize
+	if f.Cursor != "" {
+		after, err := decodeCursor(f.Cursor, f.SortBy, f.Desc)
+		if err != nil {
+			return nil, err
+		}
+		// 与游标中记录的排序值比较，游标行之后被修改或删除都不影响翻页
+		cond := fmt.Sprintf("(%s, id) %s (?, ?)", sortExpr, cmp)
+		if where == "" {
+			where = " WHERE " + cond
+		} else {
+			where += " AND " + cond
+		}
+		args = append(args, after.value, after.id)
+		offset = 0
+	}
+
+	// 额外查询排序值，写入下一页的游标
+	query := fmt.Sprintf(`SELECT %s, %s FROM video%s ORDER BY %s %s, id %s LIMIT ? OFFSET ?`,
+		videoColumns, sortExpr, where, sortExpr, order, order)
+	rows, err := db.conn.Query(query, append(args, f.PageSize, offset)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := &VideoList{Videos: make([]*Video, 0, f.PageSize), Total: total}
+	var sortValue any
+	for rows.Next() {
+		v, err := scanVideo(withExtra{rows, []any{&sortValue}})
+		if err != nil {
+			return nil, err
+		}
+		result.Videos = append(result.Videos, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(result.Videos) == f.PageSize {
+		last := result.Videos[len(result.Videos)-1]
+		result.NextCursor = encodeCursor(f.SortBy, f.Desc, sortValue, last.ID)
+	}
+	return result, nil
+}
+
+func (f *VideoFilter) conditions() (string, []any) {
+	var conds []string
+	var args []any
+	add := func(cond string, arg any) {
+		conds = append(conds, cond)
+		args = append(args, arg)
+	}
+
+	// 按对应关系筛选，同一视频在多个收藏夹中时每个收藏夹都能查到
+	if f.FavlistID != 0 {
+		add("bvid IN (SELECT bvid FROM favlist_video WHERE favlist_id = ?)", f.FavlistID)
+	}
+	if f.UploaderUID != 0 {
+		add("uploader_uid = ?", f.UploaderUID)
+	}
+	if f.IsDownloaded != nil {
+		add("is_downloaded = ?", boolToInt(*f.IsDownloaded))
+	}
+	if f.IsInvalid != nil {
+		add("is_invalid = ?", boolToInt(*f.IsInvalid))
+	}
+	if f.IsRemoved != nil {
+		add("is_removed = ?", boolToInt(*f.IsRemoved))
+	}
+	if f.MinDuration > 0 {
+		add("duration >= ?", f.MinDuration)
+	}
+	if f.MaxDuration > 0 {
+		add("duration <= ?", f.MaxDuration)
+	}
+	// 数据库中的时间以本地时区的文本存储，比较前统一转换
+	if !f.PubdateFrom.IsZero() {
+		add("pubdate >= ?", f.PubdateFrom.Local())
+	}
+	if !f.PubdateTo.IsZero() {
+		add("pubdate <= ?", f.PubdateTo.Local())
+	}
+	if !f.FavTimeFrom.IsZero() {
+		add("fav_time >= ?", f.FavTimeFrom.Local())
+	}
+	if !f.FavTimeTo.IsZero() {
+		add("fav_time <= ?", f.FavTimeTo.Local())
+	}
+
+	if f.VerifyStatus != "" {
+		add("verify_status = ?", f.VerifyStatus)
+	}
+
+	if f.Tag != "" {
+		add("bvid IN (SELECT bvid FROM video_tag WHERE tag_name = ?)", f.Tag)
+	}
+	if f.Tid != 0 {
+		add("bvid IN (SELECT bvid FROM video_meta WHERE tid = ?)", f.Tid)
+	}
+	if f.Copyright != 0 {
+		add("bvid IN (SELECT bvid FROM video_meta WHERE copyright = ?)", f.Copyright)
+	}
+
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// 在 scanVideo 的列之后读取查询中额外的列
+type withExtra struct {
+	row   rowScanner
+	extra []any
+}
+
+func (w withExtra) Scan(dest ...any) error {
+	return w.row.Scan(append(dest, w.extra...)...)
+}
+
+type cursor struct {
+	value any // 最后一行的排序值，int64 或 string
+	id    int64
+}
+
+// 游标记录排序方式、最后一行的排序值和 id，排序方式不一致的游标视为无效。
+// 排序值带上类型前缀（i 为整数，s 为文本），放在最后以允许其中包含冒号
+func encodeCursor(sortBy string, desc bool, value any, id int64) string {
+	var v string
+	switch value := value.(type) {
+	case int64:
+		v = "i" + strconv.FormatInt(value, 10)
+	case []byte:
+		v = "s" + string(value)
+	default:
+		v = "s" + fmt.Sprint(value)
+	}
+	raw := fmt.Sprintf("%s:%t:%d:%s", sortBy, desc, id, v)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(c, sortBy string, desc bool) (cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(c)
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+	parts := strings.SplitN(string(raw), ":", 4)
+	if len(parts) != 4 || parts[0] != sortBy || parts[1] != strconv.FormatBool(desc) || parts[3] == "" {
+		return cursor{}, ErrInvalidCursor
+	}
+	id, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+	result := cursor{id: id}
+	switch v := parts[3]; v[0] {
+	case 'i':
+		if result.value, err = strconv.ParseInt(v[1:], 10, 64); err != nil {
+			return cursor{}, ErrInvalidCursor
+		}
+	case 's':
+		result.value = v[1:]
+	default:
+		return cursor{}, ErrInvalidCursor
+	}
+	return result, nil
+}
@@ -0,0 +1,41 @@
+// Package disk 查询下载目录所在磁盘的空间
+package disk
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Usage 为磁盘空间，单位为字节
+type Usage struct {
+	Total uint64
+	Free  uint64 // 当前用户可用的空间
+	Used  uint64
+}
+
+// UsedPercent 返回已用空间的百分比
+func (u Usage) UsedPercent() float64 {
+	if u.Total == 0 {
+		return 0
+	}
+	return float64(u.Used) / float64(u.Total) * 100
+}
+
+// GetUsage 查询路径所在磁盘的空间，路径尚未创建时使用最近的已存在的上级目录
+func GetUsage(path string) (Usage, error) {
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return Usage{}, err
+	}
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	return usage(dir)
+}
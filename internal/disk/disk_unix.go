@@ -0,0 +1,18 @@
+//go:build !windows
+
+package disk
+
+import "syscall"
+
+func usage(dir string) (Usage, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return Usage{}, err
+	}
+	bsize := uint64(st.Bsize)
+	total := uint64(st.Blocks) * bsize
+	free := uint64(st.Bavail) * bsize
+	// 已用空间不包含仅 root 可用的保留块
+	used := total - uint64(st.Bfree)*bsize
+	return Usage{Total: total, Free: free, Used: used}, nil
+}
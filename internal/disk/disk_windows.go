@@ -0,0 +1,17 @@
+//go:build windows
+
+package disk
+
+import "golang.org/x/sys/windows"
+
+func usage(dir string) (Usage, error) {
+	p, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return Usage{}, err
+	}
+	var free, total, totalFree uint64
+	if err := windows.GetDiskFreeSpaceEx(p, &free, &total, &totalFree); err != nil {
+		return Usage{}, err
+	}
+	return Usage{Total: total, Free: free, Used: total - totalFree}, nil
+}
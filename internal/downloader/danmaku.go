@@ -0,0 +1,151 @@
+package downloader
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/CuteReimu/bilibili/v2"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/danmaku"
+	"go.uber.org/zap"
+)
+
+const (
+	danmakuXMLURL = "https://comment.bilibili.com/%d.xml"
+	danmakuSegURL = "https://api.bilibili.com/x/v2/dm/web/seg.so?type=1&oid=%d&segment_index=%d"
+)
+
+// 下载视频所有分P的弹幕，单个分P失败不影响其他分P，也不影响视频本身的下载结果
+func (m *Downloader) downloadDanmaku(ctx context.Context, task *Task, pages []bilibili.VideoPage) {
+	m.setDanmakuStatus(task.ID, StatusDownloading)
+
+	status := StatusCompleted
+	for _, p := range pages {
+		count, err := m.downloadPageDanmaku(ctx, task.BVID, p)
+		pageStatus := StatusCompleted
+		if err != nil {
+			pageStatus = StatusFailed
+			status = StatusFailed
+			m.logger.Warn("下载弹幕失败",
+				zap.String("bvid", task.BVID),
+				zap.Int("page", p.Page),
+				zap.Error(err),
+			)
+		}
+		if m.db != nil {
+			if err := m.db.UpdatePageDanmaku(task.BVID, p.Page, int64(p.Cid), string(pageStatus), count); err != nil {
+				m.logger.Error("更新弹幕状态失败", zap.Error(err))
+			}
+		}
+	}
+
+	m.setDanmakuStatus(task.ID, status)
+}
+
+// 保存原始弹幕文件并按配置转换为 ASS，返回弹幕条数
+func (m *Downloader) downloadPageDanmaku(ctx context.Context, bvid string, p bilibili.VideoPage) (int, error) {
+	cfg := m.cfg.Download.Danmaku
+	base := m.pageBasePath(bvid, p.Page)
+	if err := os.MkdirAll(filepath.Dir(base), 0755); err != nil {
+		return 0, fmt.Errorf("创建下载目录失败: %w", err)
+	}
+
+	var fromProto, fromXML []danmaku.Comment
+	if slices.Contains(cfg.Formats, "protobuf") {
+		segments := int(time.Duration(p.Duration)*time.Second/danmaku.SegmentDuration) + 1
+		for i := 1; i <= segments; i++ {
+			data, err := m.fetchDanmaku(ctx, fmt.Sprintf(danmakuSegURL, p.Cid, i))
+			if err != nil {
+				return 0, fmt.Errorf("获取弹幕分段 %d 失败: %w", i, err)
+			}
+			if err := os.WriteFile(base+".danmaku.seg"+strconv.Itoa(i)+".pb", data, 0644); err != nil {
+				return 0, fmt.Errorf("写入弹幕文件失败: %w", err)
+			}
+			comments, err := danmaku.DecodeSegment(data)
+			if err != nil {
+				return 0, err
+			}
+			fromProto = append(fromProto, comments...)
+		}
+	}
+	if slices.Contains(cfg.Formats, "xml") {
+		data, err := m.fetchDanmaku(ctx, fmt.Sprintf(danmakuXMLURL, p.Cid))
+		if err != nil {
+			return 0, fmt.Errorf("获取XML弹幕失败: %w", err)
+		}
+		if err := os.WriteFile(base+".danmaku.xml", data, 0644); err != nil {
+			return 0, fmt.Errorf("写入弹幕文件失败: %w", err)
+		}
+		if fromXML, err = danmaku.ParseXML(bytes.NewReader(data)); err != nil {
+			return 0, err
+		}
+	}
+
+	// protobuf 分段包含的字段更完整，优先保留
+	comments := danmaku.Merge(fromProto, fromXML)
+	if !cfg.ASS.Enabled {
+		return len(comments), nil
+	}
+
+	f, err := os.Create(base + ".ass")
+	if err != nil {
+		return len(comments), fmt.Errorf("创建ASS文件失败: %w", err)
+	}
+	defer f.Close()
+	_, err = danmaku.WriteASS(f, comments, danmaku.ASSOptions{
+		Width:          cfg.ASS.Width,
+		Height:         cfg.ASS.Height,
+		FontName:       cfg.ASS.FontName,
+		FontSize:       cfg.ASS.FontSize,
+		Opacity:        cfg.ASS.Opacity,
+		ScrollDuration: cfg.ASS.ScrollDuration,
+		FixedDuration:  cfg.ASS.FixedDuration,
+		DisplayArea:    cfg.ASS.DisplayArea,
+	})
+	if err != nil {
+		return len(comments), fmt.Errorf("写入ASS文件失败: %w", err)
+	}
+	return len(comments), nil
+}
+
+// 弹幕接口直接返回 deflate 压缩的内容，需要手动解压
+func (m *Downloader) fetchDanmaku(ctx context.Context, url string) ([]byte, error) {
+	resp, err := m.bilibiliClient.Resty().R().SetContext(ctx).Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() != 200 {
+		return nil, fmt.Errorf("状态码: %d", resp.StatusCode())
+	}
+	body := resp.Body()
+	if resp.Header().Get("Content-Encoding") == "deflate" {
+		return io.ReadAll(flate.NewReader(bytes.NewReader(body)))
+	}
+	return body, nil
+}
+
+// 分P文件的公共路径前缀：P1 与视频文件同名，其余分P追加 _p{n}
+func (m *Downloader) pageBasePath(bvid string, page int) string {
+	name := bvid
+	if page > 1 {
+		name = bvid + "_p" + strconv.Itoa(page)
+	}
+	return filepath.Join(filepath.Dir(m.videoPath(bvid)), name)
+}
+
+func (m *Downloader) setDanmakuStatus(taskID string, status TaskStatus) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if task, exists := m.tasks[taskID]; exists {
+		task.DanmakuStatus = status
+		task.UpdatedAt = time.Now()
+	}
+}
@@ -3,20 +3,33 @@ package downloader
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/CuteReimu/bilibili/v2"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/apicache"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/bandwidth"
 	"github.com/panedioic/bilibili-favlist-syncer/internal/config"
 	"github.com/panedioic/bilibili-favlist-syncer/internal/db"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/media"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/storage"
 	"github.com/panedioic/bilibili-favlist-syncer/utils"
 	"go.uber.org/zap"
 )
 
+// 视频流地址接口
+const playURLAPI = "https://api.bilibili.com/x/player/wbi/playurl"
+
 type TaskStatus string
 
 const (
@@ -37,6 +50,8 @@ type Task struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Error     string
+	// 弹幕下载状态，未启用弹幕下载时为空
+	DanmakuStatus TaskStatus
 }
 
 type Downloader struct {
@@ -45,33 +60,79 @@ type Downloader struct {
 	queue          chan *Task
 	ctx            context.Context
 	cancel         context.CancelFunc
+	stopping       chan struct{} // 关闭时关闭该通道，worker 不再领取新任务
+	stopOnce       sync.Once
 	cfg            *config.Config
 	logger         utils.Logger
 	workerWg       sync.WaitGroup
-	bilibiliClient *bilibili.Client
+	workersMu      sync.Mutex
+	workers        []chan struct{} // 每个 worker 的退出通道，缩小工作池时关闭
+	bilibiliClient *apicache.Client
 	db             *db.DB
+	storage        storage.Storage
+	limiter        *bandwidth.Limiter
+	hosts          *hostScores
+	httpClient     *http.Client // 视频流下载使用的客户端，走共享的代理配置
+	// 可用空间低于水位线时暂停
+	spacePaused atomic.Bool
 }
 
-func NewDownloader(cfg *config.Config, logger utils.Logger, client *bilibili.Client, database *db.DB) *Downloader {
+func NewDownloader(cfg *config.Config, logger utils.Logger, client *apicache.Client, database *db.DB, st storage.Storage, httpClient *http.Client) *Downloader {
 	ctx, cancel := context.WithCancel(context.Background())
 	m := &Downloader{
 		tasks:          make(map[string]*Task),
 		queue:          make(chan *Task, 1000),
 		ctx:            ctx,
 		cancel:         cancel,
+		stopping:       make(chan struct{}),
 		cfg:            cfg,
 		logger:         logger,
 		bilibiliClient: client,
 		db:             database,
+		storage:        st,
+		limiter:        bandwidth.New(cfg.Download.RateLimit),
+		hosts:          newHostScores(),
+		httpClient:     httpClient,
 	}
 
 	// 启动工作池
-	for i := 0; i < cfg.Download.Concurrent; i++ {
+	m.Resize(cfg.Download.Concurrent)
+
+	return m
+}
+
+// Resize 调整并发下载数。缩小时多出的 worker 完成当前任务后退出
+func (m *Downloader) Resize(n int) {
+	m.workersMu.Lock()
+	defer m.workersMu.Unlock()
+	select {
+	case <-m.stopping:
+		return
+	default:
+	}
+	for len(m.workers) < n {
+		quit := make(chan struct{})
+		m.workers = append(m.workers, quit)
 		m.workerWg.Add(1)
-		go m.worker(i)
+		go m.worker(quit)
+	}
+	for len(m.workers) > n && len(m.workers) > 0 {
+		last := len(m.workers) - 1
+		close(m.workers[last])
+		m.workers = m.workers[:last]
 	}
+}
 
-	return m
+// Workers 返回当前的并发下载数
+func (m *Downloader) Workers() int {
+	m.workersMu.Lock()
+	defer m.workersMu.Unlock()
+	return len(m.workers)
+}
+
+// Limiter 返回下载限速器，可在运行时调整限速
+func (m *Downloader) Limiter() *bandwidth.Limiter {
+	return m.limiter
 }
 
 func (m *Downloader) AddTask(bvid, title string) string {
@@ -111,7 +172,7 @@ func (m *Downloader) AddTask(bvid, title string) string {
 	return task.ID
 }
 
-func (m *Downloader) worker(_ int) {
+func (m *Downloader) worker(quit <-chan struct{}) {
 	defer func() {
 		if r := recover(); r != nil {
 			m.logger.Error("worker panic", zap.Any("recover", r))
@@ -119,12 +180,34 @@ func (m *Downloader) worker(_ int) {
 		m.workerWg.Done()
 	}()
 	for {
+		// 空间不足时任务留在队列中等待
+		if !m.waitForSpace(quit) {
+			return
+		}
+		// 关闭时队列中剩余的任务保留给下次启动
+		select {
+		case <-m.stopping:
+			return
+		case <-quit:
+			return
+		default:
+		}
 		select {
-		case <-m.ctx.Done():
+		case <-m.stopping:
+			return
+		case <-quit:
 			return
 		case task := <-m.queue:
 			m.processTask(task)
-			time.Sleep(10 * time.Second) // 模拟下载间隔
+			if interval := m.limiter.TaskInterval(); interval > 0 {
+				select {
+				case <-m.stopping:
+					return
+				case <-quit:
+					return
+				case <-time.After(interval):
+				}
+			}
 		}
 	}
 }
@@ -132,8 +215,22 @@ func (m *Downloader) worker(_ int) {
 func (m *Downloader) processTask(task *Task) {
 	m.updateTaskStatus(task.ID, StatusDownloading, 0)
 
+	// 任务内的所有请求都随该 context 取消，关闭时正在进行的传输会立即中断
+	ctx, cancel := m.taskContext()
+	defer cancel()
+
+	// 已达到配额时不再请求下载地址
+	if err := m.checkQuota(task.BVID, 0); err != nil {
+		m.failTask(task, err)
+		return
+	}
+
+	if err := m.archiveMetadata(ctx, task.BVID); err != nil {
+		m.logger.Warn("归档视频元数据失败", zap.String("bvid", task.BVID), zap.Error(err))
+	}
+
 	// 暂时只处理P1
-	videoInfo, err := m.bilibiliClient.GetVideoPageList(bilibili.VideoParam{
+	videoInfo, err := m.bilibiliClient.GetVideoPageListContext(ctx, bilibili.VideoParam{
 		Bvid: task.BVID,
 	})
 	if err != nil {
@@ -147,36 +244,91 @@ func (m *Downloader) processTask(task *Task) {
 		fmt.Println("No video pages found")
 		return
 	}
-	videoStream, err := m.bilibiliClient.GetVideoStream(bilibili.GetVideoStreamParam{
-		Bvid: task.BVID,
-		Cid:  cid,
-	})
+	videoStream, err := m.getVideoStream(ctx, task.BVID, cid)
 	if err != nil {
-		fmt.Println("Error:", err)
+		m.failTask(task, fmt.Errorf("获取下载地址失败: %w", err))
+		return
+	}
+	if len(videoStream.Durl) == 0 {
+		m.failTask(task, errNoMirror)
 		return
 	}
 
-	// 执行下载
-	err = m.downloadWithRetry(task, videoStream.Durl[0].Url)
+	size := int64(videoStream.Durl[0].Size)
+	if err := m.checkQuota(task.BVID, size); err != nil {
+		m.failTask(task, err)
+		return
+	}
+	if err := m.checkSpace(size); err != nil {
+		m.failTask(task, err)
+		return
+	}
+
+	// 执行下载，下载后按所下载分段的时长校验文件。主地址出错时切换到备用地址
+	src := m.newStreamSource(task.BVID, cid, videoStream.Durl[0])
+	hash, err := m.downloadWithRetry(ctx, task, src, streamDuration(videoStream))
 	if err != nil {
 		m.failTask(task, err)
 		return
 	}
 
-	m.completeTask(task)
+	if m.cfg.Download.Danmaku.Enabled {
+		m.downloadDanmaku(ctx, task, videoInfo)
+	}
+	if m.cfg.Download.Subtitle.Enabled {
+		m.downloadSubtitles(ctx, task, videoInfo)
+	}
+
+	m.completeTask(task, hash)
+	m.publish(task.BVID)
+}
+
+// 获取视频流地址。签名由客户端的传输层统一添加
+func (m *Downloader) getVideoStream(ctx context.Context, bvid string, cid int) (*bilibili.GetVideoStreamResult, error) {
+	var stream bilibili.GetVideoStreamResult
+	params := map[string]string{"bvid": bvid, "cid": strconv.Itoa(cid)}
+	if err := m.bilibiliClient.GetJSON(ctx, playURLAPI, params, &stream); err != nil {
+		return nil, err
+	}
+	return &stream, nil
+}
+
+// 实际下载的第一个分段的时长（秒）。分P时长包含全部分段，试看流也短于分P时长，不能用于校验。
+// 分段未给出时长时，只有一个分段的流使用整个流的时长，否则返回 0 跳过时长校验
+func streamDuration(stream *bilibili.GetVideoStreamResult) int {
+	if ms := stream.Durl[0].Length; ms > 0 {
+		return (ms + 500) / 1000
+	}
+	if len(stream.Durl) == 1 {
+		return (stream.Timelength + 500) / 1000
+	}
+	return 0
+}
+
+// 单个任务的 context，配置了 download.timeout 时限制任务总耗时
+func (m *Downloader) taskContext() (context.Context, context.CancelFunc) {
+	if timeout := m.cfg.Download.Timeout; timeout > 0 {
+		return context.WithTimeout(m.ctx, timeout)
+	}
+	return context.WithCancel(m.ctx)
 }
 
-func (m *Downloader) downloadWithRetry(task *Task, url string) error {
+// 下载并校验，返回文件的 sha256。校验失败与下载失败一样会重试
+func (m *Downloader) downloadWithRetry(ctx context.Context, task *Task, src *streamSource, expectedDuration int) (string, error) {
 	for attempt := 1; attempt <= m.cfg.Download.Retry.MaxAttempts; attempt++ {
-		select {
-		case <-m.ctx.Done():
-			return context.Canceled
-		default:
+		if err := ctx.Err(); err != nil {
+			return "", err
 		}
 
-		err := m.downloadChunk(task, url)
+		hash, err := m.downloadChunk(ctx, task, src)
 		if err == nil {
-			return nil
+			err = m.verifyFile(m.videoPath(task.BVID), expectedDuration)
+		}
+		if err == nil {
+			return hash, nil
+		}
+		if errors.Is(err, ErrInsufficientSpace) || ctx.Err() != nil {
+			return "", err
 		}
 
 		m.logger.Warn("下载失败，准备重试",
@@ -186,13 +338,29 @@ func (m *Downloader) downloadWithRetry(task *Task, url string) error {
 		)
 
 		if attempt < m.cfg.Download.Retry.MaxAttempts {
-			time.Sleep(m.cfg.Download.Retry.Backoff)
+			select {
+			case <-ctx.Done():
+				return "", ctx.Err()
+			case <-time.After(m.cfg.Download.Retry.Backoff):
+			}
 		}
 	}
-	return fmt.Errorf("达到最大重试次数 (%d)", m.cfg.Download.Retry.MaxAttempts)
+	return "", fmt.Errorf("达到最大重试次数 (%d)", m.cfg.Download.Retry.MaxAttempts)
 }
 
-func (m *Downloader) downloadChunk(task *Task, url string) error {
+// 检查容器结构与时长
+func (m *Downloader) verifyFile(path string, expectedDuration int) error {
+	info, err := media.Probe(path)
+	if err != nil {
+		return fmt.Errorf("文件校验失败: %w", err)
+	}
+	if err := media.CheckDuration(info, expectedDuration); err != nil {
+		return fmt.Errorf("文件校验失败: %w", err)
+	}
+	return nil
+}
+
+func (m *Downloader) downloadChunk(ctx context.Context, task *Task, src *streamSource) (string, error) {
 	// 模拟下载，等待5秒
 	// time.Sleep(5 * time.Second)
 	// m.updateTaskProgress(task.ID, 100)
@@ -200,52 +368,96 @@ func (m *Downloader) downloadChunk(task *Task, url string) error {
 	// return nil // 提前返回，不进行实际下载
 
 	// 创建保存文件路径
-	saveDir := m.cfg.Download.BaseDir
-	if saveDir == "" {
-		saveDir = "./downloads"
+	filename := m.videoPath(task.BVID)
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return "", fmt.Errorf("创建下载目录失败: %w", err)
+	}
+
+	// 服务器支持 Range 时按区间下载，中断后可以续传；大文件再拆分为多个连接
+	total, err := m.probeRange(ctx, src)
+	switch {
+	case err == nil:
+		connections := 1
+		if seg := m.cfg.Download.Segment; total >= int64(seg.MinSize)<<20 {
+			connections = seg.Connections
+		}
+		return m.downloadSegments(ctx, task, src, filename, total, connections)
+	case ctx.Err() != nil:
+		return "", ctx.Err()
+	case !errors.Is(err, errRangeUnsupported):
+		m.logger.Warn("探测 Range 支持失败，使用单连接下载", zap.String("task_id", task.ID), zap.Error(err))
+	}
+	return m.downloadStream(ctx, task, src, filename)
+}
+
+// 单连接下载，失败后由下一次重试换用其他节点。服务器不支持 Range，无法续传
+func (m *Downloader) downloadStream(ctx context.Context, task *Task, src *streamSource, filename string) (string, error) {
+	url, err := src.pick(ctx)
+	if err != nil {
+		return "", err
 	}
-	if err := os.MkdirAll(saveDir, 0755); err != nil {
-		return fmt.Errorf("创建下载目录失败: %w", err)
+	start := time.Now()
+	hash, downloaded, err := m.streamFrom(ctx, task, url, filename)
+	if !errors.Is(err, ErrInsufficientSpace) {
+		src.report(url, downloaded, time.Since(start), err)
 	}
-	filename := fmt.Sprintf("%s/%s.flv", saveDir, task.BVID)
+	return hash, err
+}
 
-	// 创建文件
-	file, err := os.Create(filename)
+func (m *Downloader) streamFrom(ctx context.Context, task *Task, url, filename string) (string, int64, error) {
+	// 先写入临时文件，完成后再重命名
+	part := partPath(filename)
+	file, err := os.Create(part)
 	if err != nil {
-		return fmt.Errorf("创建文件失败: %w", err)
+		return "", 0, fmt.Errorf("创建文件失败: %w", err)
 	}
-	defer file.Close()
+	completed := false
+	defer func() {
+		file.Close()
+		if !completed {
+			os.Remove(part)
+		}
+	}()
 
-	// 发起带Header的下载请求
-	req, err := http.NewRequest("GET", url, nil)
+	// 发起带Header的下载请求，长时间收不到数据时放弃该节点
+	watch := m.newStallWatch(ctx)
+	defer watch.stop()
+	req, err := m.newRequest(watch.ctx, url)
 	if err != nil {
-		return fmt.Errorf("创建请求失败: %w", err)
+		return "", 0, fmt.Errorf("创建请求失败: %w", err)
 	}
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
-	req.Header.Set("Referer", "https://www.bilibili.com/")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := m.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("下载请求失败: %w", err)
+		return "", 0, fmt.Errorf("下载请求失败: %w", watch.wrap(ctx, err))
 	}
 	defer resp.Body.Close()
+	watch.touch()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("下载失败，状态码: %d", resp.StatusCode)
+		return "", 0, &statusError{code: resp.StatusCode}
+	}
+	if err := checkContentType(resp); err != nil {
+		return "", 0, err
 	}
 
 	// 获取内容长度用于进度显示
 	contentLength := resp.ContentLength
+	if err := m.checkSpace(contentLength); err != nil {
+		return "", 0, err
+	}
 	var downloaded int64 = 0
 	buf := make([]byte, 32*1024) // 32KB缓冲区
+	hasher := sha256.New()
+	body := m.limiter.Reader(ctx, watch.reader(resp.Body))
 
 	for {
-		n, readErr := resp.Body.Read(buf)
+		n, readErr := body.Read(buf)
 		if n > 0 {
 			if _, writeErr := file.Write(buf[:n]); writeErr != nil {
-				return fmt.Errorf("写入文件失败: %w", writeErr)
+				return "", downloaded, fmt.Errorf("写入文件失败: %w", writeErr)
 			}
+			hasher.Write(buf[:n])
 			downloaded += int64(n)
 			if contentLength > 0 {
 				progress := float64(downloaded) / float64(contentLength) * 100
@@ -256,13 +468,24 @@ func (m *Downloader) downloadChunk(task *Task, url string) error {
 			break
 		}
 		if readErr != nil {
-			return fmt.Errorf("下载中断: %w", readErr)
+			return "", downloaded, fmt.Errorf("下载中断: %w", watch.wrap(ctx, readErr))
 		}
 	}
 
+	if contentLength > 0 && downloaded != contentLength {
+		return "", downloaded, fmt.Errorf("下载不完整: %d/%d 字节", downloaded, contentLength)
+	}
+	if err := file.Close(); err != nil {
+		return "", downloaded, fmt.Errorf("写入文件失败: %w", err)
+	}
+	if err := os.Rename(part, filename); err != nil {
+		return "", downloaded, fmt.Errorf("重命名文件失败: %w", err)
+	}
+	completed = true
+
 	// 最终进度设为100%
 	m.updateTaskProgress(task.ID, 100)
-	return nil
+	return hex.EncodeToString(hasher.Sum(nil)), downloaded, nil
 }
 
 func (m *Downloader) GetTask(taskID string) (*Task, bool) {
@@ -287,13 +510,6 @@ func (m *Downloader) ListTasks() []*Task {
 	return tasks
 }
 
-func (m *Downloader) Shutdown() {
-	m.logger.Info("正在关闭下载管理器...")
-	m.cancel()
-	m.workerWg.Wait()
-	close(m.queue)
-}
-
 // 内部状态更新方法
 func (m *Downloader) updateTaskStatus(taskID string, status TaskStatus, progress float64) {
 	m.mu.Lock()
@@ -316,7 +532,7 @@ func (m *Downloader) updateTaskProgress(taskID string, progress float64) {
 	}
 }
 
-func (m *Downloader) completeTask(task *Task) {
+func (m *Downloader) completeTask(task *Task, hash string) {
 	m.updateTaskStatus(task.ID, StatusCompleted, 100)
 	m.logger.Info("任务下载完成",
 		zap.String("task_id", task.ID),
@@ -324,7 +540,12 @@ func (m *Downloader) completeTask(task *Task) {
 		zap.String("title", task.Title),
 	)
 	if m.db != nil {
-		err := m.db.UpdateVideoDownloaded(task.BVID, true)
+		path := m.videoPath(task.BVID)
+		var size int64
+		if fi, err := os.Stat(path); err == nil {
+			size = fi.Size()
+		}
+		err := m.db.SetVideoFile(task.BVID, path, size, hash)
 		if err != nil {
 			m.logger.Error("更新数据库失败", zap.Error(err))
 		}
@@ -342,6 +563,12 @@ func (m *Downloader) completeTask(task *Task) {
 }
 
 func (m *Downloader) failTask(task *Task, err error) {
+	// 关闭导致的中断不算失败，已下载的部分留给下次续传
+	if m.ctx.Err() != nil && errors.Is(err, context.Canceled) {
+		m.updateTaskStatus(task.ID, StatusCanceled, task.Progress)
+		m.logger.Warn("下载已中断", zap.String("task_id", task.ID), zap.String("bvid", task.BVID))
+		return
+	}
 	m.updateTaskStatus(task.ID, StatusFailed, task.Progress)
 	task.Error = err.Error()
 	m.logger.Error("任务下载失败",
@@ -378,6 +605,15 @@ func (m *Downloader) ListActiveTasks() []*Task {
 	return activeTasks
 }
 
+// 视频文件的保存路径
+func (m *Downloader) videoPath(bvid string) string {
+	saveDir := m.cfg.Download.BaseDir
+	if saveDir == "" {
+		saveDir = "./downloads"
+	}
+	return filepath.Join(saveDir, bvid+".flv")
+}
+
 // 辅助函数
 func generateTaskID(bvid string) string {
 	return fmt.Sprintf("task_%s_%d", bvid, time.Now().UnixNano())
@@ -394,5 +630,7 @@ func copyTask(t *Task) *Task {
 		CreatedAt: t.CreatedAt,
 		UpdatedAt: t.UpdatedAt,
 		Error:     t.Error,
+
+		DanmakuStatus: t.DanmakuStatus,
 	}
 }
@@ -0,0 +1,118 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/CuteReimu/bilibili/v2"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/db"
+	"go.uber.org/zap"
+)
+
+// 与媒体文件一同导出的元数据文件内容
+type metadataExport struct {
+	BVID       string               `json:"bvid"`
+	ExportedAt time.Time            `json:"exported_at"`
+	Info       *bilibili.VideoInfo  `json:"info"`
+	Tags       []bilibili.VideoTag  `json:"tags"`
+	Pages      []bilibili.VideoPage `json:"pages"`
+	Stat       bilibili.VideoStat   `json:"stat"`
+}
+
+// 获取视频详情与TAG，写入数据库并导出到媒体文件旁边。
+// 元数据只是附加内容，调用方应只记录错误而不中断下载
+func (m *Downloader) archiveMetadata(ctx context.Context, bvid string) error {
+	// 统计数据快照需要实时数值，视频详情不使用缓存
+	info, err := m.bilibiliClient.FetchVideoInfo(ctx, bilibili.VideoParam{Bvid: bvid})
+	if err != nil {
+		return fmt.Errorf("获取视频详情失败: %w", err)
+	}
+	tags, err := m.bilibiliClient.GetVideoTagsContext(ctx, bilibili.VideoParam{Bvid: bvid})
+	if err != nil {
+		// TAG接口失败不影响其余元数据
+		m.logger.Warn("获取视频TAG失败", zap.String("bvid", bvid), zap.Error(err))
+	}
+
+	now := time.Now()
+	raw, _ := json.Marshal(info)
+	archive := &db.VideoArchive{
+		Meta: &db.VideoMeta{
+			BVID:      bvid,
+			AID:       int64(info.Aid),
+			Tid:       info.Tid,
+			Tname:     info.Tname,
+			Copyright: info.Copyright,
+			Pubdate:   time.Unix(int64(info.Pubdate), 0),
+			Ctime:     time.Unix(int64(info.Ctime), 0),
+			State:     info.State,
+			Dynamic:   info.Dynamic,
+			Raw:       string(raw),
+			FetchedAt: now,
+		},
+		Stat: &db.VideoStat{
+			BVID:       bvid,
+			View:       info.Stat.View,
+			Danmaku:    info.Stat.Danmaku,
+			Reply:      info.Stat.Reply,
+			Favorite:   info.Stat.Favorite,
+			Coin:       info.Stat.Coin,
+			Share:      info.Stat.Share,
+			Like:       info.Stat.Like,
+			CapturedAt: now,
+		},
+	}
+	for _, t := range tags {
+		archive.Tags = append(archive.Tags, db.VideoTag{TagID: int64(t.TagId), TagName: t.TagName})
+	}
+	for _, p := range info.Pages {
+		archive.Pages = append(archive.Pages, db.VideoPage{
+			BVID:     bvid,
+			Page:     p.Page,
+			CID:      int64(p.Cid),
+			Part:     p.Part,
+			Duration: p.Duration,
+			Width:    p.Dimension.Width,
+			Height:   p.Dimension.Height,
+		})
+	}
+
+	if m.db != nil {
+		if err := m.db.SaveVideoArchive(archive); err != nil {
+			return fmt.Errorf("保存视频元数据失败: %w", err)
+		}
+	}
+
+	return m.exportMetadata(&metadataExport{
+		BVID:       bvid,
+		ExportedAt: now,
+		Info:       info,
+		Tags:       tags,
+		Pages:      info.Pages,
+		Stat:       info.Stat,
+	})
+}
+
+// 写入 <bvid>.info.json，先写临时文件再重命名，避免留下半截文件
+func (m *Downloader) exportMetadata(e *metadataExport) error {
+	path := m.metadataPath(e.BVID)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("创建下载目录失败: %w", err)
+	}
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("写入元数据文件失败: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+func (m *Downloader) metadataPath(bvid string) string {
+	return filepath.Join(filepath.Dir(m.videoPath(bvid)), bvid+".info.json")
+}
@@ -0,0 +1,312 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/CuteReimu/bilibili/v2"
+	"go.uber.org/zap"
+)
+
+const (
+	// 没有测速记录的节点按该速度估计(字节/秒)
+	defaultHostSpeed = 1 << 20
+	// 最近失败过的节点在该时间内降低优先级
+	hostFailureCooldown = time.Minute
+	// 两次重新获取下载地址的最小间隔
+	streamRefreshInterval = 30 * time.Second
+	// 下载地址在 deadline 前该时间内视为已过期
+	streamExpiryMargin = time.Minute
+)
+
+var (
+	errNoMirror = errors.New("没有可用的下载地址")
+	errStalled  = errors.New("下载停滞")
+
+	errResponseTimeout = errors.New("等待响应超时")
+)
+
+// HTTP 状态错误，403/404/410 说明该地址已失效
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("下载失败，状态码: %d", e.code)
+}
+
+func isDeadURL(err error) bool {
+	var se *statusError
+	if !errors.As(err, &se) {
+		return false
+	}
+	return se.code == http.StatusForbidden || se.code == http.StatusNotFound || se.code == http.StatusGone
+}
+
+// 各 CDN 节点的下载表现，在所有任务之间共享
+type hostScores struct {
+	mu    sync.Mutex
+	hosts map[string]*hostStat
+	now   func() time.Time
+}
+
+type hostStat struct {
+	speed    float64 // 指数加权平均速度(字节/秒)
+	failures int     // 连续失败次数
+	lastFail time.Time
+}
+
+func newHostScores() *hostScores {
+	return &hostScores{hosts: make(map[string]*hostStat), now: time.Now}
+}
+
+func (h *hostScores) record(host string, bytes int64, elapsed time.Duration, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	stat := h.hosts[host]
+	if stat == nil {
+		stat = &hostStat{}
+		h.hosts[host] = stat
+	}
+	// 传输量太小时速度不准确
+	if bytes >= 256<<10 && elapsed > 0 {
+		speed := float64(bytes) / elapsed.Seconds()
+		if stat.speed == 0 {
+			stat.speed = speed
+		} else {
+			stat.speed = stat.speed*0.7 + speed*0.3
+		}
+	}
+	if err != nil {
+		stat.failures++
+		stat.lastFail = h.now()
+	} else {
+		stat.failures = 0
+	}
+}
+
+func (h *hostScores) score(host string) float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	stat := h.hosts[host]
+	if stat == nil {
+		return defaultHostSpeed
+	}
+	score := stat.speed
+	if score == 0 {
+		score = defaultHostSpeed
+	}
+	score /= float64(int(1) << min(stat.failures, 10))
+	if h.now().Sub(stat.lastFail) < hostFailureCooldown {
+		score *= 0.1
+	}
+	return score
+}
+
+// streamSource 为一个视频的主地址与备用地址，按节点评分选择下载地址。
+// 地址过期或全部失效时通过 GetVideoStream 重新获取
+type streamSource struct {
+	m    *Downloader
+	bvid string
+	cid  int
+
+	mu        sync.Mutex
+	urls      []string
+	dead      map[string]bool
+	refreshed time.Time
+}
+
+func (m *Downloader) newStreamSource(bvid string, cid int, durl bilibili.Durl) *streamSource {
+	s := &streamSource{m: m, bvid: bvid, cid: cid, refreshed: time.Now()}
+	s.setURLs(durl)
+	return s
+}
+
+func (s *streamSource) setURLs(durl bilibili.Durl) {
+	s.urls = append([]string{durl.Url}, durl.BackupUrl...)
+	s.dead = make(map[string]bool)
+}
+
+// count 返回地址数量
+func (s *streamSource) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.urls)
+}
+
+// pick 返回当前评分最高的可用地址，评分相同时优先使用主地址。
+// 需要重新获取地址时使用任务的 ctx，任务取消或超时后不再等待
+func (s *streamSource) pick(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if best := s.bestLocked(); best != "" {
+		return best, nil
+	}
+	if err := s.refreshLocked(ctx); err != nil {
+		return "", err
+	}
+	if best := s.bestLocked(); best != "" {
+		return best, nil
+	}
+	return "", errNoMirror
+}
+
+func (s *streamSource) bestLocked() string {
+	var best string
+	var bestScore float64
+	now := s.m.hosts.now()
+	for _, u := range s.urls {
+		if u == "" || s.dead[u] || urlExpired(u, now) {
+			continue
+		}
+		if score := s.m.hosts.score(hostOf(u)); best == "" || score > bestScore {
+			best, bestScore = u, score
+		}
+	}
+	return best
+}
+
+func (s *streamSource) refreshLocked(ctx context.Context) error {
+	if s.m.bilibiliClient == nil {
+		return errNoMirror
+	}
+	if time.Since(s.refreshed) < streamRefreshInterval {
+		return fmt.Errorf("%w，稍后重新获取", errNoMirror)
+	}
+	s.refreshed = time.Now()
+	stream, err := s.m.getVideoStream(ctx, s.bvid, s.cid)
+	if err != nil {
+		return fmt.Errorf("重新获取下载地址失败: %w", err)
+	}
+	if len(stream.Durl) == 0 {
+		return errNoMirror
+	}
+	s.setURLs(stream.Durl[0])
+	s.m.logger.Info("已重新获取下载地址", zap.String("bvid", s.bvid), zap.Int("mirrors", len(s.urls)))
+	return nil
+}
+
+// report 记录一次请求的结果，失效的地址不再使用
+func (s *streamSource) report(u string, bytes int64, elapsed time.Duration, err error) {
+	// 任务取消或超时不是节点的问题
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+	s.m.hosts.record(hostOf(u), bytes, elapsed, err)
+	if err == nil {
+		return
+	}
+	if isDeadURL(err) {
+		s.mu.Lock()
+		s.dead[u] = true
+		s.mu.Unlock()
+	}
+	s.m.logger.Warn("下载节点出错，切换节点",
+		zap.String("bvid", s.bvid),
+		zap.String("host", hostOf(u)),
+		zap.Error(err),
+	)
+}
+
+func hostOf(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return u
+	}
+	return parsed.Host
+}
+
+// B 站下载地址通过 deadline 参数标记过期时间
+func urlExpired(u string, now time.Time) bool {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return false
+	}
+	deadline, err := strconv.ParseInt(parsed.Query().Get("deadline"), 10, 64)
+	if err != nil || deadline <= 0 {
+		return false
+	}
+	return now.Add(streamExpiryMargin).Unix() >= deadline
+}
+
+// stallWatch 为单个请求设置两段超时：等待响应头不超过 download.response_timeout，
+// 开始传输后连续 download.stall_timeout 收不到数据时取消请求
+type stallWatch struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	timer    *time.Timer
+	idle     time.Duration
+	started  atomic.Bool
+	timedOut atomic.Bool
+}
+
+func (m *Downloader) newStallWatch(parent context.Context) *stallWatch {
+	ctx, cancel := context.WithCancel(parent)
+	w := &stallWatch{ctx: ctx, cancel: cancel, idle: m.cfg.Download.StallTimeout}
+	first := m.cfg.Download.ResponseTimeout
+	if first <= 0 {
+		first = w.idle
+	}
+	if first > 0 {
+		w.timer = time.AfterFunc(first, func() {
+			w.timedOut.Store(true)
+			cancel()
+		})
+	}
+	return w
+}
+
+// touch 在收到响应头或数据时调用，重新开始计算空闲时间
+func (w *stallWatch) touch() {
+	w.started.Store(true)
+	if w.timer == nil {
+		return
+	}
+	if w.idle > 0 {
+		w.timer.Reset(w.idle)
+	} else {
+		w.timer.Stop()
+	}
+}
+
+func (w *stallWatch) stop() {
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.cancel()
+}
+
+// wrap 将超时导致的取消转换为对应的错误，外部取消保持原样
+func (w *stallWatch) wrap(parent context.Context, err error) error {
+	if err == nil || parent.Err() != nil || !w.timedOut.Load() {
+		return err
+	}
+	if w.started.Load() {
+		return errStalled
+	}
+	return errResponseTimeout
+}
+
+// reader 在每次读到数据时重置计时
+func (w *stallWatch) reader(r io.Reader) io.Reader {
+	return readerFunc(func(p []byte) (int, error) {
+		n, err := r.Read(p)
+		if n > 0 {
+			w.touch()
+		}
+		return n, err
+	})
+}
+
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) { return f(p) }
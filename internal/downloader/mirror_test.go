@@ -0,0 +1,128 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/CuteReimu/bilibili/v2"
+	"github.com/panedioic/bilibili-favlist-syncer/utils"
+)
+
+var t0 = time.Unix(1700000000, 0)
+
+func TestHostScores(t *testing.T) {
+	now := t0
+	h := newHostScores()
+	h.now = func() time.Time { return now }
+	failed := errors.New("连接被重置")
+
+	check := func(name, host string, want float64) {
+		t.Helper()
+		if got := h.score(host); math.Abs(got-want) > 1e-6 {
+			t.Errorf("%s: score = %v, want %v", name, got, want)
+		}
+	}
+
+	check("没有记录时使用默认速度", "a.example", defaultHostSpeed)
+	h.record("a.example", 512<<10, time.Second, nil)
+	check("第一次测速", "a.example", 512<<10)
+	h.record("a.example", 1<<20, time.Second, nil)
+	speed := (512<<10)*0.7 + (1<<20)*0.3
+	check("按指数加权平均", "a.example", speed)
+	h.record("a.example", 100<<10, time.Millisecond, nil)
+	check("传输量太小时不更新速度", "a.example", speed)
+	h.record("a.example", 0, 0, failed)
+	check("失败后减半并在冷却期内降低优先级", "a.example", speed/2*0.1)
+	now = now.Add(hostFailureCooldown)
+	check("冷却期结束", "a.example", speed/2)
+	h.record("a.example", 0, 0, nil)
+	check("成功后清除失败次数", "a.example", speed)
+
+	// 连续失败的惩罚有上限，冷却期按最后一次失败计算
+	for range 20 {
+		h.record("b.example", 0, 0, failed)
+	}
+	check("连续失败", "b.example", defaultHostSpeed/1024*0.1)
+	now = now.Add(hostFailureCooldown - time.Second)
+	check("冷却期内", "b.example", defaultHostSpeed/1024*0.1)
+	now = now.Add(time.Second)
+	check("连续失败后冷却期结束", "b.example", defaultHostSpeed/1024)
+}
+
+func newTestSource(t *testing.T, now *time.Time, durl bilibili.Durl) *streamSource {
+	t.Helper()
+	hosts := newHostScores()
+	hosts.now = func() time.Time { return *now }
+	m := &Downloader{hosts: hosts, logger: utils.NewLogger("error")}
+	return m.newStreamSource("BV1xx411c7mD", 1, durl)
+}
+
+func TestStreamSourcePick(t *testing.T) {
+	now := t0
+	deadline := t0.Add(time.Hour).Unix()
+	mirror := func(host string) string {
+		return fmt.Sprintf("https://%s/v.flv?deadline=%d", host, deadline)
+	}
+	s := newTestSource(t, &now, bilibili.Durl{Url: mirror("main"), BackupUrl: []string{mirror("b1"), mirror("b2")}})
+	ctx := context.Background()
+
+	pick := func(want string) {
+		t.Helper()
+		got, err := s.pick(ctx)
+		if err != nil || got != want {
+			t.Errorf("pick = %q, %v, want %q", got, err, want)
+		}
+	}
+
+	// 评分相同时使用主地址
+	pick(mirror("main"))
+
+	// 测速更快的备用节点优先
+	s.report(mirror("b2"), 4<<20, time.Second, nil)
+	pick(mirror("b2"))
+
+	// 任务取消不计入节点的失败
+	s.report(mirror("b2"), 0, 0, context.Canceled)
+	pick(mirror("b2"))
+
+	// 普通错误降低评分，403 说明地址已失效
+	s.report(mirror("b2"), 0, 0, errors.New("连接被重置"))
+	pick(mirror("main"))
+	s.report(mirror("main"), 0, 0, &statusError{code: 403})
+	pick(mirror("b1"))
+
+	// 冷却期后恢复评分，失效的地址不再使用
+	now = now.Add(hostFailureCooldown)
+	pick(mirror("b2"))
+
+	// 临近过期的地址视为不可用，没有接口客户端时无法重新获取
+	now = time.Unix(deadline, 0).Add(-streamExpiryMargin)
+	if _, err := s.pick(ctx); !errors.Is(err, errNoMirror) {
+		t.Errorf("pick = %v, want errNoMirror", err)
+	}
+}
+
+func TestURLExpired(t *testing.T) {
+	deadline := t0.Add(time.Hour).Unix()
+	u := fmt.Sprintf("https://cdn.example/v.flv?deadline=%d", deadline)
+	tests := []struct {
+		url  string
+		now  time.Time
+		want bool
+	}{
+		{u, t0, false},
+		{u, time.Unix(deadline, 0).Add(-streamExpiryMargin - time.Second), false},
+		{u, time.Unix(deadline, 0).Add(-streamExpiryMargin), true},
+		{"https://cdn.example/v.flv", t0, false},
+		{"https://cdn.example/v.flv?deadline=abc", t0, false},
+	}
+	for _, tt := range tests {
+		if got := urlExpired(tt.url, tt.now); got != tt.want {
+			t.Errorf("urlExpired(%q, %v) = %v, want %v", tt.url, tt.now.Unix(), got, tt.want)
+		}
+	}
+}
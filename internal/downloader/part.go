@@ -0,0 +1,95 @@
+package downloader
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// 未完成的下载写入 {文件名}.part，分段进度保存在 {文件名}.part.json，
+// 下次下载同一文件且大小一致时从记录的位置继续
+type partState struct {
+	Total    int64          `json:"total"`
+	Segments []segmentState `json:"segments"`
+}
+
+type segmentState struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+	Next  int64 `json:"next"`
+}
+
+func partPath(filename string) string {
+	return filename + ".part"
+}
+
+func partStatePath(part string) string {
+	return part + ".json"
+}
+
+// 读取续传记录，记录不存在或与文件不一致时返回 nil
+func loadPartState(part string, total int64) []*segment {
+	data, err := os.ReadFile(partStatePath(part))
+	if err != nil {
+		return nil
+	}
+	var state partState
+	if err := json.Unmarshal(data, &state); err != nil || state.Total != total || len(state.Segments) == 0 {
+		return nil
+	}
+	if fi, err := os.Stat(part); err != nil || fi.Size() != total {
+		return nil
+	}
+
+	segments := make([]*segment, 0, len(state.Segments))
+	var expect int64
+	for _, s := range state.Segments {
+		// 区间必须首尾相接覆盖整个文件
+		if s.Start != expect || s.End < s.Start || s.Next < s.Start || s.Next > s.End+1 {
+			return nil
+		}
+		segments = append(segments, newSegment(s.Start, s.End, s.Next))
+		expect = s.End + 1
+	}
+	if expect != total {
+		return nil
+	}
+	return segments
+}
+
+func newPartState(total int64, segments []*segment) partState {
+	state := partState{Total: total, Segments: make([]segmentState, 0, len(segments))}
+	for _, s := range segments {
+		state.Segments = append(state.Segments, segmentState{Start: s.start, End: s.end, Next: s.next.Load()})
+	}
+	return state
+}
+
+func (state partState) save(part string) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := partStatePath(part) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, partStatePath(part))
+}
+
+func savePartState(part string, total int64, segments []*segment) error {
+	return newPartState(total, segments).save(part)
+}
+
+// 下载过程中定期保存续传进度。先记下各分段的位置再同步文件，
+// 保证记录的位置之前的数据都已落盘
+func checkpointPartState(file *os.File, part string, total int64, segments []*segment) error {
+	state := newPartState(total, segments)
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	return state.save(part)
+}
+
+func removePartState(part string) {
+	os.Remove(partStatePath(part))
+}
@@ -0,0 +1,141 @@
+package downloader
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/panedioic/bilibili-favlist-syncer/internal/storage"
+	"go.uber.org/zap"
+)
+
+// 每轮重新上传的视频数
+const uploadRetryBatchSize = 50
+
+// publish 将视频及弹幕、字幕、元数据等同名文件写入存储后端。
+// 远程存储且不保留本地文件时，全部上传成功后才删除本地副本。
+// 上传失败的视频记录到数据库，由 RunUploadRetry 定期重试
+func (m *Downloader) publish(bvid string) error {
+	if m.storage == nil {
+		return nil
+	}
+	err := m.upload(bvid)
+	if m.db == nil {
+		return err
+	}
+	if err != nil {
+		if dbErr := m.db.SavePendingUpload(bvid, err.Error()); dbErr != nil {
+			m.logger.Warn("记录上传失败的视频失败", zap.String("bvid", bvid), zap.Error(dbErr))
+		}
+		return err
+	}
+	if dbErr := m.db.DeletePendingUpload(bvid); dbErr != nil {
+		m.logger.Warn("清除上传记录失败", zap.String("bvid", bvid), zap.Error(dbErr))
+	}
+	return nil
+}
+
+func (m *Downloader) upload(bvid string) error {
+	baseDir := filepath.Dir(m.videoPath(bvid))
+	files, err := filepath.Glob(filepath.Join(baseDir, bvid+"*"))
+	if err != nil {
+		m.logger.Error("查找待上传文件失败", zap.String("bvid", bvid), zap.Error(err))
+		return err
+	}
+
+	var uploaded []string
+	for _, file := range files {
+		name := strings.TrimPrefix(filepath.Base(file), bvid)
+		// 跳过未完成的临时文件与续传记录，以及前缀相同的其他视频
+		if strings.Contains(name, ".part") || (name != "" && name[0] != '.' && name[0] != '_') {
+			continue
+		}
+		key, err := storage.KeyFor(storage.BaseDir(m.cfg), file)
+		if err != nil {
+			// 保存目录不在 download.base_dir 下，无法换算为存储中的路径
+			m.logger.Warn("文件不在下载目录中，跳过上传",
+				zap.String("bvid", bvid),
+				zap.String("path", file),
+				zap.String("base_dir", storage.BaseDir(m.cfg)),
+			)
+			continue
+		}
+		if err := storage.Upload(m.ctx, m.storage, key, file, m.cfg.Storage.Retry); err != nil {
+			m.logger.Error("上传到存储失败，保留本地文件",
+				zap.String("bvid", bvid),
+				zap.String("key", key),
+				zap.Error(err),
+			)
+			return err
+		}
+		uploaded = append(uploaded, file)
+	}
+
+	if m.storage.Type() == storage.TypeLocal || m.cfg.Storage.KeepLocal {
+		return nil
+	}
+	for _, file := range uploaded {
+		if err := os.Remove(file); err != nil {
+			m.logger.Warn("删除本地文件失败", zap.String("path", file), zap.Error(err))
+		}
+	}
+	m.logger.Info("已上传到存储", zap.String("bvid", bvid), zap.String("storage", m.storage.Type()), zap.Int("files", len(uploaded)))
+	return nil
+}
+
+// RunUploadRetry 按 storage.retry_interval 定期重新上传之前失败的视频，本地存储或间隔为 0 时直接返回
+func (m *Downloader) RunUploadRetry(ctx context.Context) {
+	interval := m.cfg.Storage.RetryInterval
+	if m.storage == nil || m.storage.Type() == storage.TypeLocal || m.db == nil || interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.RetryUploads(ctx)
+		}
+	}
+}
+
+// RetryUploads 重新上传一批之前失败的视频，返回成功数量
+func (m *Downloader) RetryUploads(ctx context.Context) int {
+	bvids, err := m.db.ListPendingUploads(uploadRetryBatchSize)
+	if err != nil {
+		m.logger.Warn("查询待上传视频失败", zap.Error(err))
+		return 0
+	}
+	done := 0
+	for _, bvid := range bvids {
+		if ctx.Err() != nil {
+			break
+		}
+		// 视频记录已删除或本地文件已被清理时不再重试
+		v, err := m.db.GetVideoByBVID(bvid)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && !v.IsDownloaded) {
+			if err := m.db.DeletePendingUpload(bvid); err != nil {
+				m.logger.Warn("清除上传记录失败", zap.String("bvid", bvid), zap.Error(err))
+			}
+			continue
+		}
+		if err != nil {
+			m.logger.Warn("查询视频失败", zap.String("bvid", bvid), zap.Error(err))
+			continue
+		}
+		if m.publish(bvid) == nil {
+			done++
+		}
+	}
+	if len(bvids) > 0 {
+		m.logger.Info("重新上传完成", zap.Int("total", len(bvids)), zap.Int("success", done))
+	}
+	return done
+}
@@ -0,0 +1,379 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/panedioic/bilibili-favlist-syncer/internal/bandwidth"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/media"
+	"go.uber.org/zap"
+)
+
+// 进度更新的最小间隔，避免多个连接频繁加锁
+const progressInterval = 500 * time.Millisecond
+
+// 下载过程中保存续传进度的间隔，进程意外退出时最多损失这段时间的进度
+const partStateInterval = 10 * time.Second
+
+var errRangeUnsupported = errors.New("服务器不支持 Range 请求")
+
+// segment 为文件中的一个字节区间 [start, end]，next 为下一个待写入的位置。
+// next 只由下载该区间的协程写入，保存续传进度时会被并发读取
+type segment struct {
+	start int64
+	end   int64
+	next  atomic.Int64
+}
+
+func newSegment(start, end, next int64) *segment {
+	seg := &segment{start: start, end: end}
+	seg.next.Store(next)
+	return seg
+}
+
+// 创建带 B 站所需请求头的下载请求
+func (m *Downloader) newRequest(ctx context.Context, url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
+	req.Header.Set("Referer", "https://www.bilibili.com/")
+	return req, nil
+}
+
+// 鉴权失败或链接过期时 CDN 可能返回 200 的错误页面
+func checkContentType(resp *http.Response) error {
+	if ct := resp.Header.Get("Content-Type"); strings.HasPrefix(ct, "text/") || strings.Contains(ct, "json") {
+		return fmt.Errorf("下载失败，响应类型: %s", ct)
+	}
+	return nil
+}
+
+// 请求第一个字节，服务器返回 206 时从 Content-Range 中得到文件总大小。
+// 节点出错时换用其他节点，不支持 Range 时返回 errRangeUnsupported
+func (m *Downloader) probeRange(ctx context.Context, src *streamSource) (int64, error) {
+	var lastErr error
+	for range src.count() {
+		url, err := src.pick(ctx)
+		if err != nil {
+			return 0, err
+		}
+		total, err := m.probeURL(ctx, url)
+		if err == nil || errors.Is(err, errRangeUnsupported) || ctx.Err() != nil {
+			return total, err
+		}
+		src.report(url, 0, 0, err)
+		lastErr = err
+	}
+	return 0, lastErr
+}
+
+func (m *Downloader) probeURL(ctx context.Context, url string) (int64, error) {
+	watch := m.newStallWatch(ctx)
+	defer watch.stop()
+	req, err := m.newRequest(watch.ctx, url)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", "bytes=0-0")
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return 0, watch.wrap(ctx, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return 0, &statusError{code: resp.StatusCode}
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, errRangeUnsupported
+	}
+	if err := checkContentType(resp); err != nil {
+		return 0, err
+	}
+	start, _, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+	if !ok || start != 0 || total <= 0 {
+		return 0, errRangeUnsupported
+	}
+	return total, nil
+}
+
+// 将文件拆分为多个区间并行下载，直接写入各自的位置。
+// 单个区间失败时换用其他节点，从已写入的位置继续，重试次数与整体下载相同。
+// 中断时保留 .part 文件与分段进度，下次从断点续传
+func (m *Downloader) downloadSegments(ctx context.Context, task *Task, src *streamSource, filename string, total int64, connections int) (string, error) {
+	part := partPath(filename)
+	segments := loadPartState(part, total)
+	var file *os.File
+	var err error
+	if segments != nil {
+		file, err = os.OpenFile(part, os.O_RDWR, 0644)
+	} else {
+		segments = splitSegments(total, connections)
+		file, err = os.Create(part)
+	}
+	if err != nil {
+		return "", fmt.Errorf("创建文件失败: %w", err)
+	}
+	defer file.Close()
+
+	var done int64
+	for _, seg := range segments {
+		done += seg.next.Load() - seg.start
+	}
+	if err := m.checkSpace(total - done); err != nil {
+		return "", err
+	}
+	if done == 0 {
+		if err := file.Truncate(total); err != nil {
+			return "", fmt.Errorf("预分配文件失败: %w", err)
+		}
+	}
+	m.logger.Info("分段下载",
+		zap.String("task_id", task.ID),
+		zap.Int64("size", total),
+		zap.Int64("resumed", done),
+		zap.Int("segments", len(segments)),
+	)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	limiter := m.limiter.Task()
+	progress := &segmentProgress{m: m, taskID: task.ID, total: total}
+	progress.downloaded.Store(done)
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	for _, seg := range segments {
+		if seg.next.Load() > seg.end {
+			continue
+		}
+		wg.Add(1)
+		go func(seg *segment) {
+			defer wg.Done()
+			if err := m.fetchSegment(ctx, src, file, seg, limiter, progress); err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(seg)
+	}
+	checkpointDone := make(chan struct{})
+	go m.checkpointSegments(ctx, checkpointDone, file, part, total, segments)
+	wg.Wait()
+	cancel()
+	<-checkpointDone
+	if firstErr != nil {
+		if err := savePartState(part, total, segments); err != nil {
+			m.logger.Warn("保存续传进度失败", zap.String("path", part), zap.Error(err))
+		}
+		return "", firstErr
+	}
+
+	if downloaded := progress.downloaded.Load(); downloaded != total {
+		return "", fmt.Errorf("下载不完整: %d/%d 字节", downloaded, total)
+	}
+	if err := file.Sync(); err != nil {
+		return "", fmt.Errorf("写入文件失败: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("写入文件失败: %w", err)
+	}
+	if err := os.Rename(part, filename); err != nil {
+		return "", fmt.Errorf("重命名文件失败: %w", err)
+	}
+	removePartState(part)
+	m.updateTaskProgress(task.ID, 100)
+
+	hash, err := media.HashFile(filename)
+	if err != nil {
+		return "", fmt.Errorf("计算文件哈希失败: %w", err)
+	}
+	return hash, nil
+}
+
+// 定期保存续传进度，直到 ctx 取消
+func (m *Downloader) checkpointSegments(ctx context.Context, done chan<- struct{}, file *os.File, part string, total int64, segments []*segment) {
+	defer close(done)
+	ticker := time.NewTicker(partStateInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := checkpointPartState(file, part, total, segments); err != nil {
+				m.logger.Warn("保存续传进度失败", zap.String("path", part), zap.Error(err))
+			}
+		}
+	}
+}
+
+func (m *Downloader) fetchSegment(ctx context.Context, src *streamSource, file *os.File, seg *segment, limiter *bandwidth.Task, progress *segmentProgress) error {
+	maxAttempts := max(m.cfg.Download.Retry.MaxAttempts, 1)
+	var lastErr error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		url, err := src.pick(ctx)
+		if err != nil {
+			return err
+		}
+		from, start := seg.next.Load(), time.Now()
+		lastErr = m.fetchRange(ctx, url, file, seg, limiter, progress)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		src.report(url, seg.next.Load()-from, time.Since(start), lastErr)
+		if lastErr == nil {
+			return nil
+		}
+		if errors.Is(lastErr, errRangeUnsupported) {
+			return lastErr
+		}
+		m.logger.Warn("分段下载中断，准备续传",
+			zap.Int64("start", seg.start),
+			zap.Int64("next", seg.next.Load()),
+			zap.Int64("end", seg.end),
+			zap.Int("attempt", attempt),
+			zap.Error(lastErr),
+		)
+		if attempt < maxAttempts {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(m.cfg.Download.Retry.Backoff):
+			}
+		}
+	}
+	return fmt.Errorf("分段 %d-%d 下载失败: %w", seg.start, seg.end, lastErr)
+}
+
+// 下载区间中尚未写入的部分
+func (m *Downloader) fetchRange(ctx context.Context, url string, file *os.File, seg *segment, limiter *bandwidth.Task, progress *segmentProgress) error {
+	watch := m.newStallWatch(ctx)
+	defer watch.stop()
+	req, err := m.newRequest(watch.ctx, url)
+	if err != nil {
+		return err
+	}
+	next := seg.next.Load()
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", next, seg.end))
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("下载请求失败: %w", watch.wrap(ctx, err))
+	}
+	defer resp.Body.Close()
+	watch.touch()
+
+	if resp.StatusCode >= 400 {
+		return &statusError{code: resp.StatusCode}
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("%w，状态码: %d", errRangeUnsupported, resp.StatusCode)
+	}
+	if err := checkContentType(resp); err != nil {
+		return err
+	}
+	if start, _, _, ok := parseContentRange(resp.Header.Get("Content-Range")); !ok || start != next {
+		return fmt.Errorf("%w，Content-Range: %s", errRangeUnsupported, resp.Header.Get("Content-Range"))
+	}
+
+	body := limiter.Reader(ctx, watch.reader(resp.Body))
+	buf := make([]byte, 32*1024)
+	for next <= seg.end {
+		want := min(int64(len(buf)), seg.end-next+1)
+		n, readErr := body.Read(buf[:want])
+		if n > 0 {
+			if _, err := file.WriteAt(buf[:n], next); err != nil {
+				return fmt.Errorf("写入文件失败: %w", err)
+			}
+			next += int64(n)
+			seg.next.Store(next)
+			progress.add(int64(n))
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return fmt.Errorf("下载中断: %w", watch.wrap(ctx, readErr))
+		}
+	}
+	if next <= seg.end {
+		return fmt.Errorf("分段不完整: %d/%d 字节", next-seg.start, seg.end-seg.start+1)
+	}
+	return nil
+}
+
+// 按连接数均分文件，返回的区间首尾相接覆盖整个文件
+func splitSegments(total int64, connections int) []*segment {
+	connections = max(connections, 1)
+	size := (total + int64(connections) - 1) / int64(connections)
+	segments := make([]*segment, 0, connections)
+	for start := int64(0); start < total; start += size {
+		end := min(start+size, total) - 1
+		segments = append(segments, newSegment(start, end, start))
+	}
+	return segments
+}
+
+// 解析 "bytes start-end/total"，total 为 * 时返回 -1
+func parseContentRange(header string) (start, end, total int64, ok bool) {
+	spec, found := strings.CutPrefix(header, "bytes ")
+	if !found {
+		return 0, 0, 0, false
+	}
+	rangePart, totalPart, found := strings.Cut(spec, "/")
+	if !found {
+		return 0, 0, 0, false
+	}
+	startStr, endStr, found := strings.Cut(rangePart, "-")
+	if !found {
+		return 0, 0, 0, false
+	}
+	var err error
+	if start, err = strconv.ParseInt(startStr, 10, 64); err != nil {
+		return 0, 0, 0, false
+	}
+	if end, err = strconv.ParseInt(endStr, 10, 64); err != nil {
+		return 0, 0, 0, false
+	}
+	total = -1
+	if totalPart != "*" {
+		if total, err = strconv.ParseInt(totalPart, 10, 64); err != nil {
+			return 0, 0, 0, false
+		}
+	}
+	return start, end, total, true
+}
+
+// 汇总各分段的进度写入 Task.Progress
+type segmentProgress struct {
+	m          *Downloader
+	taskID     string
+	total      int64
+	downloaded atomic.Int64
+	reported   atomic.Int64 // 上次更新进度的时间
+}
+
+func (p *segmentProgress) add(n int64) {
+	downloaded := p.downloaded.Add(n)
+	now := time.Now().UnixNano()
+	last := p.reported.Load()
+	if now-last < int64(progressInterval) || !p.reported.CompareAndSwap(last, now) {
+		return
+	}
+	p.m.updateTaskProgress(p.taskID, float64(downloaded)/float64(p.total)*100)
+}
@@ -0,0 +1,124 @@
+package downloader
+
+import (
+	"context"
+	"time"
+
+	"github.com/panedioic/bilibili-favlist-syncer/internal/db"
+	"go.uber.org/zap"
+)
+
+// 超时中断下载后等待任务退出的时间。任务在退出前更新状态并写入数据库，
+// 调用方在 Shutdown 返回后才能关闭数据库
+const shutdownGrace = 5 * time.Second
+
+// ShutdownReport 为关闭下载器的结果
+type ShutdownReport struct {
+	TimedOut    bool    // 超时前未能等到所有任务结束
+	Interrupted []*Task // 被中断的任务，已下载的部分保留在 .part 文件中用于续传
+	Queued      []*Task // 尚未开始的任务
+	Persisted   int     // 写入数据库、下次启动时恢复的任务数
+}
+
+// Shutdown 停止领取新任务，等待正在下载的任务在 ctx 结束前完成。
+// 超时后中断传输，并最多再等待 shutdownGrace 让任务退出；仍在下载的任务按被中断处理。
+// 最后将未完成的任务写入数据库，下次启动时由 RestoreQueue 恢复
+func (m *Downloader) Shutdown(ctx context.Context) *ShutdownReport {
+	m.logger.Info("正在关闭下载管理器...")
+	m.stopOnce.Do(func() { close(m.stopping) })
+
+	report := &ShutdownReport{}
+	done := make(chan struct{})
+	go func() {
+		m.workerWg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		report.TimedOut = true
+		m.logger.Warn("等待下载任务超时，中断正在进行的下载")
+	}
+	m.cancel()
+	if report.TimedOut {
+		select {
+		case <-done:
+		case <-time.After(shutdownGrace):
+			m.logger.Warn("下载任务未能在中断后及时退出", zap.Duration("grace", shutdownGrace))
+		}
+	}
+
+	m.mu.RLock()
+	for _, t := range m.tasks {
+		switch t.Status {
+		case StatusQueued:
+			report.Queued = append(report.Queued, copyTask(t))
+		case StatusCanceled, StatusDownloading:
+			report.Interrupted = append(report.Interrupted, copyTask(t))
+		}
+	}
+	m.mu.RUnlock()
+
+	if m.db != nil {
+		items := make([]db.QueuedDownload, 0, len(report.Interrupted)+len(report.Queued))
+		for _, t := range append(report.Interrupted, report.Queued...) {
+			items = append(items, db.QueuedDownload{
+				BVID:      t.BVID,
+				Title:     t.Title,
+				Status:    string(t.Status),
+				Progress:  t.Progress,
+				CreatedAt: t.CreatedAt,
+			})
+		}
+		if err := m.db.SaveDownloadQueue(items); err != nil {
+			m.logger.Error("保存下载队列失败", zap.Error(err))
+		} else {
+			report.Persisted = len(items)
+		}
+	}
+
+	for _, t := range report.Interrupted {
+		m.logger.Warn("下载被中断，下次启动时续传",
+			zap.String("bvid", t.BVID),
+			zap.Float64("progress", t.Progress),
+		)
+	}
+	m.logger.Info("下载管理器已关闭",
+		zap.Bool("timed_out", report.TimedOut),
+		zap.Int("interrupted", len(report.Interrupted)),
+		zap.Int("queued", len(report.Queued)),
+		zap.Int("persisted", report.Persisted),
+	)
+	return report
+}
+
+// RestoreQueue 将上次关闭时保存的任务重新加入队列，返回恢复的任务数。
+// 期间已下载完成或被清理规则删除的视频不再恢复
+func (m *Downloader) RestoreQueue() (int, error) {
+	if m.db == nil {
+		return 0, nil
+	}
+	items, err := m.db.ListDownloadQueue()
+	if err != nil {
+		return 0, err
+	}
+
+	restored := 0
+	for _, q := range items {
+		if v, err := m.db.GetVideoByBVID(q.BVID); err == nil && v != nil && (v.IsDownloaded || !v.DeletedAt.IsZero()) {
+			continue
+		}
+		if m.GetActiveTaskByBVID(q.BVID) != nil {
+			continue
+		}
+		m.AddTask(q.BVID, q.Title)
+		restored++
+	}
+	if err := m.db.ClearDownloadQueue(); err != nil {
+		return restored, err
+	}
+	if restored > 0 {
+		m.logger.Info("已恢复上次未完成的下载任务", zap.Int("count", restored))
+	}
+	return restored, nil
+}
@@ -0,0 +1,124 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/panedioic/bilibili-favlist-syncer/internal/disk"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrInsufficientSpace = errors.New("磁盘空间不足")
+	ErrQuotaExceeded     = errors.New("超出存储配额")
+)
+
+// 下载目录，未配置时与 videoPath 保持一致
+func (m *Downloader) baseDir() string {
+	if m.cfg.Download.BaseDir == "" {
+		return "./downloads"
+	}
+	return m.cfg.Download.BaseDir
+}
+
+// SpacePaused 返回是否因可用空间不足而暂停下载
+func (m *Downloader) SpacePaused() bool {
+	return m.spacePaused.Load()
+}
+
+// 可用空间低于水位线时阻塞，直到空间恢复、下载器关闭或 worker 被移除。返回 false 表示 worker 应退出
+func (m *Downloader) waitForSpace(quit <-chan struct{}) bool {
+	watermark := uint64(m.cfg.Download.Disk.LowWatermark) << 20
+	if watermark == 0 {
+		return true
+	}
+	interval := m.cfg.Download.Disk.CheckInterval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	for {
+		usage, err := disk.GetUsage(m.baseDir())
+		if err != nil {
+			// 无法获取时不阻塞下载，写入失败时仍会报错
+			m.logger.Warn("获取磁盘空间失败", zap.Error(err))
+			return true
+		}
+		if usage.Free >= watermark {
+			if m.spacePaused.CompareAndSwap(true, false) {
+				m.logger.Info("磁盘空间已恢复，继续下载", zap.Uint64("free", usage.Free))
+			}
+			return true
+		}
+		if m.spacePaused.CompareAndSwap(false, true) {
+			m.logger.Warn("磁盘可用空间低于水位线，暂停下载",
+				zap.Uint64("free", usage.Free),
+				zap.Uint64("low_watermark", watermark),
+			)
+		}
+
+		select {
+		case <-m.stopping:
+			return false
+		case <-quit:
+			return false
+		case <-time.After(interval):
+		}
+	}
+}
+
+// 检查可用空间能否容纳 size 字节与配置的余量，size 未知时只检查余量
+func (m *Downloader) checkSpace(size int64) error {
+	usage, err := disk.GetUsage(m.baseDir())
+	if err != nil {
+		m.logger.Warn("获取磁盘空间失败", zap.Error(err))
+		return nil
+	}
+	need := uint64(max(size, 0)) + uint64(m.cfg.Download.Disk.Margin)<<20
+	if usage.Free < need {
+		return fmt.Errorf("%w: 需要 %d 字节，可用 %d 字节", ErrInsufficientSpace, need, usage.Free)
+	}
+	return nil
+}
+
+// 检查下载 size 字节后是否超出全局或视频所在收藏夹的配额
+func (m *Downloader) checkQuota(bvid string, size int64) error {
+	quota := m.cfg.Download.Quota
+	if m.db == nil {
+		return nil
+	}
+
+	if limit := int64(quota.MaxSize) << 20; limit > 0 {
+		used, err := m.db.DownloadedBytes(0)
+		if err != nil {
+			return err
+		}
+		if used+size > limit {
+			return fmt.Errorf("%w: 已使用 %d 字节，上限 %d 字节", ErrQuotaExceeded, used, limit)
+		}
+	}
+
+	if len(quota.Favlists) == 0 {
+		return nil
+	}
+	// 视频计入所在的每个收藏夹，任一收藏夹超出配额都不下载
+	favlists, err := m.db.ListVideoFavlists(bvid)
+	if err != nil {
+		return err
+	}
+	for _, favlistID := range favlists {
+		limit := int64(quota.FavlistMaxSize(favlistID)) << 20
+		if limit <= 0 {
+			continue
+		}
+		used, err := m.db.DownloadedBytes(favlistID)
+		if err != nil {
+			return err
+		}
+		if used+size > limit {
+			return fmt.Errorf("%w: 收藏夹 %d 已使用 %d 字节，上限 %d 字节", ErrQuotaExceeded, favlistID, used, limit)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CuteReimu/bilibili/v2"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/db"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/subtitle"
+	"go.uber.org/zap"
+)
+
+const playerInfoURL = "https://api.bilibili.com/x/player/v2"
+
+// 播放器信息接口中的字幕列表
+type playerInfo struct {
+	Subtitle struct {
+		Subtitles []subtitleTrack `json:"subtitles"`
+	} `json:"subtitle"`
+}
+
+type subtitleTrack struct {
+	ID          int64  `json:"id"`
+	Lan         string `json:"lan"`
+	LanDoc      string `json:"lan_doc"`
+	SubtitleURL string `json:"subtitle_url"`
+	Type        int    `json:"type"` // 0：CC字幕，1：AI字幕
+}
+
+func (t *subtitleTrack) isAI() bool {
+	return t.Type == 1 || strings.HasPrefix(t.Lan, "ai-")
+}
+
+// 下载视频所有分P的字幕，失败只记录日志
+func (m *Downloader) downloadSubtitles(ctx context.Context, task *Task, pages []bilibili.VideoPage) {
+	for _, p := range pages {
+		if err := m.downloadPageSubtitles(ctx, task.BVID, p); err != nil {
+			m.logger.Warn("下载字幕失败",
+				zap.String("bvid", task.BVID),
+				zap.Int("page", p.Page),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+func (m *Downloader) downloadPageSubtitles(ctx context.Context, bvid string, p bilibili.VideoPage) error {
+	cfg := m.cfg.Download.Subtitle
+
+	var info playerInfo
+	err := m.bilibiliClient.GetJSON(ctx, playerInfoURL, map[string]string{
+		"bvid": bvid,
+		"cid":  strconv.Itoa(p.Cid),
+	}, &info)
+	if err != nil {
+		return fmt.Errorf("获取字幕列表失败: %w", err)
+	}
+
+	base := m.pageBasePath(bvid, p.Page)
+	for _, track := range info.Subtitle.Subtitles {
+		if track.SubtitleURL == "" {
+			continue
+		}
+		if track.isAI() && !cfg.IncludeAI {
+			continue
+		}
+		if len(cfg.Languages) > 0 && !slices.Contains(cfg.Languages, track.Lan) {
+			continue
+		}
+
+		url := track.SubtitleURL
+		if strings.HasPrefix(url, "//") {
+			url = "https:" + url
+		}
+		resp, err := m.bilibiliClient.Resty().R().SetContext(ctx).Get(url)
+		if err != nil {
+			return fmt.Errorf("下载字幕 %s 失败: %w", track.Lan, err)
+		}
+		if resp.StatusCode() != 200 {
+			return fmt.Errorf("下载字幕 %s 失败，状态码: %d", track.Lan, resp.StatusCode())
+		}
+		data := resp.Body()
+
+		path := base + "." + track.Lan
+		if err := os.WriteFile(path+".json", data, 0644); err != nil {
+			return fmt.Errorf("写入字幕文件失败: %w", err)
+		}
+		formats := []string{"json"}
+
+		doc, err := subtitle.Parse(data)
+		if err != nil {
+			return err
+		}
+		for _, format := range cfg.Formats {
+			var buf bytes.Buffer
+			switch format {
+			case "srt":
+				err = subtitle.WriteSRT(&buf, doc)
+			case "vtt":
+				err = subtitle.WriteVTT(&buf, doc)
+			default:
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(path+"."+format, buf.Bytes(), 0644); err != nil {
+				return fmt.Errorf("写入字幕文件失败: %w", err)
+			}
+			formats = append(formats, format)
+		}
+
+		if m.db != nil {
+			err := m.db.SaveVideoSubtitle(&db.VideoSubtitle{
+				BVID:      bvid,
+				Page:      p.Page,
+				CID:       int64(p.Cid),
+				Lan:       track.Lan,
+				LanDoc:    track.LanDoc,
+				IsAI:      track.isAI(),
+				Path:      path,
+				Formats:   formats,
+				FetchedAt: time.Now(),
+			})
+			if err != nil {
+				return fmt.Errorf("保存字幕记录失败: %w", err)
+			}
+		}
+	}
+	return nil
+}
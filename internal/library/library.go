@@ -0,0 +1,119 @@
+// Package library 维护本地视频库与数据库记录的一致性
+package library
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+
+	"github.com/panedioic/bilibili-favlist-syncer/internal/config"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/db"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/storage"
+	"github.com/panedioic/bilibili-favlist-syncer/utils"
+	"go.uber.org/zap"
+)
+
+type Library struct {
+	cfg    *config.Config
+	logger utils.Logger
+	db     *db.DB
+	st     storage.Storage
+
+	// 后台任务使用的 context，Run 退出时取消并等待后台任务结束
+	ctx    context.Context
+	cancel context.CancelFunc
+	jobs   sync.WaitGroup
+
+	mu            sync.Mutex
+	job           string // 正在执行的任务，校验与整理不能同时进行
+	lastVerify    *VerifyReport
+	lastReconcile *ReconcileReport
+}
+
+// 任务名称
+const (
+	JobVerify    = "verify"
+	JobReconcile = "reconcile"
+)
+
+var (
+	ErrBusy   = errors.New("视频库任务正在进行")
+	ErrClosed = errors.New("视频库已关闭")
+)
+
+func New(cfg *config.Config, logger utils.Logger, database *db.DB, st storage.Storage) *Library {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Library{
+		cfg:    cfg,
+		logger: logger,
+		db:     database,
+		st:     st,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+func (l *Library) begin(job string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.job != "" {
+		return ErrBusy
+	}
+	l.job = job
+	return nil
+}
+
+func (l *Library) end() {
+	l.mu.Lock()
+	l.job = ""
+	l.mu.Unlock()
+}
+
+// 取消后台任务并等待其结束，之后不再接受新的后台任务
+func (l *Library) close() {
+	l.mu.Lock()
+	l.cancel()
+	l.mu.Unlock()
+	l.jobs.Wait()
+}
+
+// 返回正在执行的任务名称，空闲时为空
+func (l *Library) RunningJob() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.job
+}
+
+func (l *Library) videoPath(v *db.Video) string {
+	return VideoPath(l.cfg, v)
+}
+
+// VideoPath 返回视频文件的本地路径，早期记录没有 file_path 时使用默认命名
+func VideoPath(cfg *config.Config, v *db.Video) string {
+	if v.FilePath != "" {
+		return v.FilePath
+	}
+	saveDir := cfg.Download.BaseDir
+	if saveDir == "" {
+		saveDir = "./downloads"
+	}
+	return filepath.Join(saveDir, v.BVID+".flv")
+}
+
+// 本地文件不存在时，查询远程存储中是否有对应对象。本地存储或路径不在下载目录中时返回
+// storage.ErrNotExist；其余错误说明远程存储暂时不可用，无法确定对象是否存在
+func (l *Library) remoteStat(ctx context.Context, path string) (*storage.ObjectInfo, error) {
+	if l.st == nil || l.st.Type() == storage.TypeLocal {
+		return nil, storage.ErrNotExist
+	}
+	key, err := storage.KeyFor(storage.BaseDir(l.cfg), path)
+	if err != nil {
+		return nil, storage.ErrNotExist
+	}
+	info, err := l.st.Stat(ctx, key)
+	if err != nil && !errors.Is(err, storage.ErrNotExist) {
+		l.logger.Warn("查询远程存储失败", zap.String("key", key), zap.Error(err))
+	}
+	return info, err
+}
@@ -0,0 +1,305 @@
+package library
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/panedioic/bilibili-favlist-syncer/internal/db"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/media"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/storage"
+	"go.uber.org/zap"
+)
+
+// 整理时对单个视频执行的操作
+const (
+	ActionReset     = "reset"     // 文件丢失，清除下载标记
+	ActionRelink    = "relink"    // 文件被移动或改名，更新路径
+	ActionAdopt     = "adopt"     // 目录中已有文件，标记为已下载
+	ActionRejected  = "rejected"  // 目录中的文件未通过校验，未采用
+	ActionUntracked = "untracked" // 无法对应到数据库中的视频
+	ActionSkipped   = "skipped"   // 远程存储不可用，无法确认文件是否存在
+)
+
+var (
+	bvidPattern     = regexp.MustCompile(`BV[0-9A-Za-z]{10}`)
+	videoExtensions = map[string]bool{".flv": true, ".mp4": true, ".mkv": true}
+)
+
+// ReconcileReport 为一次整理的结果
+type ReconcileReport struct {
+	StartedAt  time.Time
+	FinishedAt time.Time
+	DryRun     bool
+	Scanned    int // 扫描到的视频文件数
+	Matched    int // 记录与文件一致的视频数
+	Reset      int
+	Relinked   int
+	Adopted    int
+	Rejected   int
+	Untracked  int
+	Skipped    int
+	Items      []ReconcileItem
+}
+
+type ReconcileItem struct {
+	BVID   string
+	Path   string
+	Action string
+	Detail string
+}
+
+// ReconcileOptions 中 DryRun 为 true 时只生成报告，不修改数据库
+type ReconcileOptions struct {
+	DryRun bool
+}
+
+// Reconcile 扫描下载目录，按记录的路径或文件名中的 BV 号与数据库比对：
+// 文件丢失的视频清除下载标记，被移动的文件更新路径，目录中已有但未标记的文件通过校验后采用
+func (l *Library) Reconcile(ctx context.Context, opts ReconcileOptions) (*ReconcileReport, error) {
+	if err := l.begin(JobReconcile); err != nil {
+		return nil, err
+	}
+	defer l.end()
+
+	report, err := l.reconcile(ctx, opts)
+	if report != nil {
+		l.mu.Lock()
+		l.lastReconcile = report
+		l.mu.Unlock()
+	}
+	return report, err
+}
+
+// 返回上一次的整理结果
+func (l *Library) LastReconcile() *ReconcileReport {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lastReconcile
+}
+
+// Run 按 schedule.reconcile_interval 定期整理视频库，间隔为 0 时不定期整理。
+// ctx 结束时取消后台校验，等待其结束后返回
+func (l *Library) Run(ctx context.Context) {
+	defer l.close()
+	interval := l.cfg.Schedule.ReconcileInterval
+	if interval <= 0 {
+		<-ctx.Done()
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := l.Reconcile(ctx, ReconcileOptions{}); err != nil && err != ErrBusy {
+				l.logger.Error("整理视频库失败", zap.Error(err))
+			}
+		}
+	}
+}
+
+// 磁盘上的视频文件
+type diskFile struct {
+	path    string
+	size    int64
+	bvid    string
+	matched bool
+}
+
+func (l *Library) reconcile(ctx context.Context, opts ReconcileOptions) (*ReconcileReport, error) {
+	report := &ReconcileReport{StartedAt: time.Now(), DryRun: opts.DryRun, Items: make([]ReconcileItem, 0)}
+
+	files, err := l.scanDisk()
+	if err != nil {
+		return nil, err
+	}
+	report.Scanned = len(files)
+
+	byPath := make(map[string]*diskFile, len(files))
+	byBVID := make(map[string][]*diskFile)
+	for _, f := range files {
+		byPath[f.path] = f
+		if f.bvid != "" {
+			byBVID[f.bvid] = append(byBVID[f.bvid], f)
+		}
+	}
+
+	filter := db.VideoFilter{SortBy: "id", PageSize: 200}
+	for {
+		list, err := l.db.ListVideos(filter)
+		if err != nil {
+			return report, err
+		}
+		for _, v := range list.Videos {
+			if err := ctx.Err(); err != nil {
+				report.FinishedAt = time.Now()
+				return report, err
+			}
+			l.reconcileVideo(ctx, v, byPath, byBVID, opts, report)
+		}
+		if list.NextCursor == "" {
+			break
+		}
+		filter.Cursor = list.NextCursor
+	}
+
+	for _, f := range files {
+		if f.matched {
+			continue
+		}
+		detail := "文件名中没有BV号"
+		if f.bvid != "" {
+			detail = "数据库中没有该视频"
+		}
+		report.Untracked++
+		report.Items = append(report.Items, ReconcileItem{BVID: f.bvid, Path: f.path, Action: ActionUntracked, Detail: detail})
+	}
+
+	report.FinishedAt = time.Now()
+	l.logger.Info("视频库整理完成",
+		zap.Bool("dry_run", opts.DryRun),
+		zap.Int("scanned", report.Scanned),
+		zap.Int("reset", report.Reset),
+		zap.Int("relinked", report.Relinked),
+		zap.Int("adopted", report.Adopted),
+		zap.Int("untracked", report.Untracked),
+		zap.Int("skipped", report.Skipped),
+	)
+	return report, nil
+}
+
+func (l *Library) reconcileVideo(ctx context.Context, v *db.Video, byPath map[string]*diskFile, byBVID map[string][]*diskFile, opts ReconcileOptions, report *ReconcileReport) {
+	recorded := absPath(l.videoPath(v))
+
+	// 优先使用记录的路径，其次按 BV 号查找
+	f := byPath[recorded]
+	if f == nil {
+		for _, candidate := range byBVID[v.BVID] {
+			if !candidate.matched {
+				f = candidate
+				break
+			}
+		}
+	}
+	if f == nil && v.IsDownloaded {
+		// 记录的路径可能在下载目录之外，或者只保存在远程存储中
+		if fi, err := os.Stat(recorded); err == nil && !fi.IsDir() {
+			report.Matched++
+			return
+		}
+		_, err := l.remoteStat(ctx, l.videoPath(v))
+		if err == nil {
+			report.Matched++
+			return
+		}
+		// 远程存储暂时不可用时不能据此清除下载标记
+		if !errors.Is(err, storage.ErrNotExist) {
+			report.Skipped++
+			report.Items = append(report.Items, ReconcileItem{BVID: v.BVID, Path: recorded, Action: ActionSkipped, Detail: err.Error()})
+			return
+		}
+	}
+	if f != nil {
+		f.matched = true
+	}
+
+	var err error
+	switch {
+	case v.IsDownloaded && f == nil:
+		report.Reset++
+		report.Items = append(report.Items, ReconcileItem{BVID: v.BVID, Path: recorded, Action: ActionReset, Detail: "文件不存在"})
+		if !opts.DryRun {
+			err = l.db.ResetVideoFile(v.BVID)
+		}
+	case v.IsDownloaded && f.path == recorded:
+		report.Matched++
+	case v.IsDownloaded:
+		report.Relinked++
+		report.Items = append(report.Items, ReconcileItem{BVID: v.BVID, Path: f.path, Action: ActionRelink, Detail: "原路径: " + recorded})
+		if !opts.DryRun {
+			err = l.db.UpdateVideoFilePath(v.BVID, f.path, f.size)
+		}
+	case f != nil:
+		// 未标记为已下载的文件可能是中断的下载，需要通过校验才能采用
+		if checkErr := l.checkOrphan(v, f.path); checkErr != nil {
+			report.Rejected++
+			report.Items = append(report.Items, ReconcileItem{BVID: v.BVID, Path: f.path, Action: ActionRejected, Detail: checkErr.Error()})
+			return
+		}
+		report.Adopted++
+		report.Items = append(report.Items, ReconcileItem{BVID: v.BVID, Path: f.path, Action: ActionAdopt})
+		if !opts.DryRun {
+			var hash string
+			if hash, err = media.HashFile(f.path); err == nil {
+				err = l.db.SetVideoFile(v.BVID, f.path, f.size, hash)
+			}
+		}
+	}
+	if err != nil {
+		l.logger.Warn("更新视频文件记录失败", zap.String("bvid", v.BVID), zap.Error(err))
+	}
+}
+
+func (l *Library) checkOrphan(v *db.Video, path string) error {
+	info, err := media.Probe(path)
+	if err != nil {
+		return err
+	}
+	return media.CheckDuration(info, l.expectedDuration(v))
+}
+
+// 遍历下载目录中的视频文件，跳过未完成的下载与资源目录
+func (l *Library) scanDisk() ([]*diskFile, error) {
+	root := l.cfg.Download.BaseDir
+	if root == "" {
+		root = "./downloads"
+	}
+	// 目录不存在时（例如外置存储未挂载）不能据此清除下载标记
+	if fi, err := os.Stat(root); err != nil || !fi.IsDir() {
+		return nil, fmt.Errorf("下载目录不可用: %s", root)
+	}
+
+	var files []*diskFile
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && (d.Name() == "assets" || strings.HasPrefix(d.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !videoExtensions[strings.ToLower(filepath.Ext(path))] {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, &diskFile{
+			path: absPath(path),
+			size: fi.Size(),
+			bvid: bvidPattern.FindString(d.Name()),
+		})
+		return nil
+	})
+	return files, err
+}
+
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
@@ -0,0 +1,215 @@
+package library
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/panedioic/bilibili-favlist-syncer/internal/db"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/media"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/storage"
+	"go.uber.org/zap"
+)
+
+// VerifyReport 为一次全库校验的结果
+type VerifyReport struct {
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Checked    int
+	OK         int
+	Corrupt    int
+	Missing    int
+	Skipped    int // 远程存储不可用，未能校验
+	Problems   []VerifyProblem
+}
+
+type VerifyProblem struct {
+	BVID   string
+	Title  string
+	Path   string
+	Status string
+	Error  string
+}
+
+// VerifyOptions 控制校验范围。Rehash 为 true 时重新计算哈希并与记录比较，耗时较长
+type VerifyOptions struct {
+	Rehash bool
+}
+
+// VerifyAll 逐个检查已下载视频的本地文件，标记缺失或损坏的文件
+func (l *Library) VerifyAll(ctx context.Context, opts VerifyOptions) (*VerifyReport, error) {
+	if err := l.begin(JobVerify); err != nil {
+		return nil, err
+	}
+	defer l.end()
+	return l.verify(ctx, opts)
+}
+
+// StartVerify 在后台执行全库校验。校验在 Run 退出时取消，Run 返回前等待其结束
+func (l *Library) StartVerify(opts VerifyOptions) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ctx.Err() != nil {
+		return ErrClosed
+	}
+	if l.job != "" {
+		return ErrBusy
+	}
+	l.job = JobVerify
+
+	l.jobs.Add(1)
+	go func() {
+		defer l.jobs.Done()
+		defer l.end()
+		if _, err := l.verify(l.ctx, opts); err != nil && !errors.Is(err, context.Canceled) {
+			l.logger.Error("视频库校验失败", zap.Error(err))
+		}
+	}()
+	return nil
+}
+
+func (l *Library) verify(ctx context.Context, opts VerifyOptions) (*VerifyReport, error) {
+	report, err := l.verifyAll(ctx, opts)
+	if report != nil {
+		l.mu.Lock()
+		l.lastVerify = report
+		l.mu.Unlock()
+	}
+	return report, err
+}
+
+// 返回上一次的校验结果
+func (l *Library) LastVerify() *VerifyReport {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lastVerify
+}
+
+func (l *Library) verifyAll(ctx context.Context, opts VerifyOptions) (*VerifyReport, error) {
+	report := &VerifyReport{StartedAt: time.Now(), Problems: make([]VerifyProblem, 0)}
+	downloaded := true
+	filter := db.VideoFilter{IsDownloaded: &downloaded, SortBy: "id", PageSize: 200}
+
+	for {
+		list, err := l.db.ListVideos(filter)
+		if err != nil {
+			return report, err
+		}
+		for _, v := range list.Videos {
+			if err := ctx.Err(); err != nil {
+				report.FinishedAt = time.Now()
+				return report, err
+			}
+			l.verifyVideo(ctx, v, opts, report)
+		}
+		if list.NextCursor == "" {
+			break
+		}
+		filter.Cursor = list.NextCursor
+	}
+
+	report.FinishedAt = time.Now()
+	l.logger.Info("视频库校验完成",
+		zap.Int("checked", report.Checked),
+		zap.Int("ok", report.OK),
+		zap.Int("corrupt", report.Corrupt),
+		zap.Int("missing", report.Missing),
+		zap.Int("skipped", report.Skipped),
+	)
+	return report, nil
+}
+
+func (l *Library) verifyVideo(ctx context.Context, v *db.Video, opts VerifyOptions, report *VerifyReport) {
+	report.Checked++
+	path := l.videoPath(v)
+	status, hash, verifyErr := l.checkFile(ctx, v, path, opts)
+	if status == verifyUnknown {
+		report.Skipped++
+		return
+	}
+
+	if err := l.db.SetVideoVerification(v.BVID, hash, status, verifyErr); err != nil {
+		l.logger.Warn("写入校验结果失败", zap.String("bvid", v.BVID), zap.Error(err))
+	}
+
+	switch status {
+	case db.VerifyOK:
+		report.OK++
+		return
+	case db.VerifyMissing:
+		report.Missing++
+	default:
+		report.Corrupt++
+	}
+	report.Problems = append(report.Problems, VerifyProblem{
+		BVID:   v.BVID,
+		Title:  v.Title,
+		Path:   path,
+		Status: status,
+		Error:  verifyErr,
+	})
+	l.logger.Warn("视频文件校验未通过", zap.String("bvid", v.BVID), zap.String("status", status), zap.String("error", verifyErr))
+}
+
+// 远程存储不可用时 checkFile 返回的状态，不写入数据库
+const verifyUnknown = ""
+
+// 返回校验状态、新计算出的哈希（未计算时为空）和错误说明
+func (l *Library) checkFile(ctx context.Context, v *db.Video, path string, opts VerifyOptions) (string, string, string) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// 已上传到远程存储且未保留本地副本时只能比对大小
+			info, err := l.remoteStat(ctx, path)
+			switch {
+			case err == nil:
+				if v.FileSize > 0 && info.Size != v.FileSize {
+					return db.VerifyCorrupt, "", fmt.Sprintf("远程文件大小不符: %d/%d 字节", info.Size, v.FileSize)
+				}
+				return db.VerifyOK, "", ""
+			case !errors.Is(err, storage.ErrNotExist):
+				// 无法确认文件是否存在，不改变校验状态
+				return verifyUnknown, "", err.Error()
+			}
+			return db.VerifyMissing, "", "文件不存在"
+		}
+		return db.VerifyCorrupt, "", err.Error()
+	}
+	if v.FileSize > 0 && fi.Size() != v.FileSize {
+		return db.VerifyCorrupt, "", fmt.Sprintf("文件大小不符: %d/%d 字节", fi.Size(), v.FileSize)
+	}
+
+	info, err := media.Probe(path)
+	if err != nil {
+		return db.VerifyCorrupt, "", err.Error()
+	}
+	if err := media.CheckDuration(info, l.expectedDuration(v)); err != nil {
+		return db.VerifyCorrupt, "", err.Error()
+	}
+
+	// 没有记录哈希的旧文件在首次校验时补齐
+	if !opts.Rehash && v.FileHash != "" {
+		return db.VerifyOK, "", ""
+	}
+	hash, err := media.HashFile(path)
+	if err != nil {
+		return db.VerifyCorrupt, "", err.Error()
+	}
+	if v.FileHash != "" && hash != v.FileHash {
+		return db.VerifyCorrupt, "", "文件哈希与下载时不一致"
+	}
+	return db.VerifyOK, hash, ""
+}
+
+// 目前只下载P1，优先使用归档的分P时长；单P视频可直接使用视频时长
+func (l *Library) expectedDuration(v *db.Video) int {
+	if pages, err := l.db.ListVideoPages(v.BVID); err == nil && len(pages) > 0 && pages[0].Page == 1 {
+		return pages[0].Duration
+	}
+	if v.PageCount <= 1 {
+		return v.Duration
+	}
+	return 0
+}
@@ -0,0 +1,140 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+var errAMF = errors.New("无效的 AMF 数据")
+
+// 从 onMetaData 脚本中读取 duration，解析失败时返回 0
+func metadataDuration(data []byte) float64 {
+	d := &amfDecoder{buf: data}
+	name, err := d.value()
+	if err != nil || name != "onMetaData" {
+		return 0
+	}
+	meta, err := d.value()
+	if err != nil {
+		return 0
+	}
+	props, ok := meta.(map[string]any)
+	if !ok {
+		return 0
+	}
+	duration, _ := props["duration"].(float64)
+	return duration
+}
+
+// 只支持 FLV 元数据中常见的 AMF0 类型
+type amfDecoder struct {
+	buf []byte
+	pos int
+}
+
+func (d *amfDecoder) read(n int) ([]byte, error) {
+	if n < 0 || d.pos+n > len(d.buf) {
+		return nil, errAMF
+	}
+	b := d.buf[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *amfDecoder) string(long bool) (string, error) {
+	var n int
+	if long {
+		b, err := d.read(4)
+		if err != nil {
+			return "", err
+		}
+		n = int(binary.BigEndian.Uint32(b))
+	} else {
+		b, err := d.read(2)
+		if err != nil {
+			return "", err
+		}
+		n = int(binary.BigEndian.Uint16(b))
+	}
+	b, err := d.read(n)
+	return string(b), err
+}
+
+func (d *amfDecoder) value() (any, error) {
+	marker, err := d.read(1)
+	if err != nil {
+		return nil, err
+	}
+	switch marker[0] {
+	case 0x00: // number
+		b, err := d.read(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	case 0x01: // boolean
+		b, err := d.read(1)
+		if err != nil {
+			return nil, err
+		}
+		return b[0] != 0, nil
+	case 0x02: // string
+		return d.string(false)
+	case 0x0c: // long string
+		return d.string(true)
+	case 0x05, 0x06: // null, undefined
+		return nil, nil
+	case 0x03: // object
+		return d.properties()
+	case 0x08: // ECMA array，前 4 字节为近似数量，仍以结束标记为准
+		if _, err := d.read(4); err != nil {
+			return nil, err
+		}
+		return d.properties()
+	case 0x0a: // strict array
+		b, err := d.read(4)
+		if err != nil {
+			return nil, err
+		}
+		n := int(binary.BigEndian.Uint32(b))
+		list := make([]any, 0, min(n, 1024))
+		for i := 0; i < n; i++ {
+			v, err := d.value()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	case 0x0b: // date
+		_, err := d.read(10)
+		return nil, err
+	}
+	return nil, errAMF
+}
+
+func (d *amfDecoder) properties() (map[string]any, error) {
+	props := make(map[string]any)
+	for {
+		key, err := d.string(false)
+		if err != nil {
+			return nil, err
+		}
+		if key == "" {
+			end, err := d.read(1)
+			if err != nil {
+				return nil, err
+			}
+			if end[0] == 0x09 {
+				return props, nil
+			}
+			return nil, errAMF
+		}
+		v, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		props[key] = v
+	}
+}
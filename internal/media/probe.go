@@ -0,0 +1,238 @@
+// Package media 对下载完成的视频文件做容器级别的检查，
+// 只解析校验所需的最少结构：文件头、时长以及文件末尾是否完整
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+const (
+	FormatFLV = "flv"
+	FormatMP4 = "mp4"
+)
+
+var (
+	ErrUnknownFormat = errors.New("无法识别的视频格式")
+	ErrTruncated     = errors.New("视频文件不完整")
+)
+
+// Info 为探测得到的容器信息
+type Info struct {
+	Format   string
+	Duration float64 // 秒，无法获取时为 0
+	Size     int64
+}
+
+// Probe 读取文件头判断容器格式，并检查文件结构是否完整
+func Probe(path string) (*Info, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	head := make([]byte, 12)
+	if _, err := io.ReadFull(f, head); err != nil {
+		return nil, ErrTruncated
+	}
+
+	var info *Info
+	switch {
+	case bytes.HasPrefix(head, []byte("FLV")):
+		info, err = probeFLV(f, fi.Size())
+	case bytes.Equal(head[4:8], []byte("ftyp")):
+		info, err = probeMP4(f, fi.Size())
+	default:
+		return nil, ErrUnknownFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	info.Size = fi.Size()
+	return info, nil
+}
+
+// CheckDuration 比较探测到的时长与预期时长（秒），允许少量误差。
+// 任一时长未知时不做比较
+func CheckDuration(info *Info, expected int) error {
+	if info.Duration <= 0 || expected <= 0 {
+		return nil
+	}
+	tolerance := math.Max(2, float64(expected)*0.01)
+	if math.Abs(info.Duration-float64(expected)) > tolerance {
+		return fmt.Errorf("时长不符: 文件 %.1fs, 预期 %ds", info.Duration, expected)
+	}
+	return nil
+}
+
+// FLV：9 字节文件头，之后为 PreviousTagSize(4) + Tag 交替排列。
+// 文件末尾的 PreviousTagSize 必须指向一个合法的 Tag，否则视为被截断
+func probeFLV(r io.ReadSeeker, size int64) (*Info, error) {
+	header := make([]byte, 9)
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, ErrTruncated
+	}
+	dataOffset := int64(binary.BigEndian.Uint32(header[5:9]))
+	if dataOffset < 9 || dataOffset+4 > size {
+		return nil, ErrTruncated
+	}
+
+	info := &Info{Format: FormatFLV}
+
+	// 第一个 Tag 通常是 onMetaData 脚本
+	tagHeader := make([]byte, 11)
+	if _, err := r.Seek(dataOffset+4, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(r, tagHeader); err == nil && tagHeader[0] == 18 {
+		dataSize := int64(tagHeader[1])<<16 | int64(tagHeader[2])<<8 | int64(tagHeader[3])
+		if dataSize > 0 && dataSize < 1<<20 {
+			data := make([]byte, dataSize)
+			if _, err := io.ReadFull(r, data); err == nil {
+				info.Duration = metadataDuration(data)
+			}
+		}
+	}
+
+	// 校验最后一个 Tag
+	if size < dataOffset+4+11+4 {
+		return nil, ErrTruncated
+	}
+	tail := make([]byte, 4)
+	if _, err := r.Seek(size-4, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(r, tail); err != nil {
+		return nil, ErrTruncated
+	}
+	lastSize := int64(binary.BigEndian.Uint32(tail))
+	lastStart := size - 4 - lastSize
+	if lastSize < 11 || lastStart < dataOffset+4 {
+		return nil, ErrTruncated
+	}
+	if _, err := r.Seek(lastStart, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(r, tagHeader); err != nil {
+		return nil, ErrTruncated
+	}
+	tagType := tagHeader[0] & 0x1f
+	dataSize := int64(tagHeader[1])<<16 | int64(tagHeader[2])<<8 | int64(tagHeader[3])
+	if (tagType != 8 && tagType != 9 && tagType != 18) || dataSize+11 != lastSize {
+		return nil, ErrTruncated
+	}
+
+	// 没有元数据时使用最后一个 Tag 的时间戳
+	if info.Duration == 0 {
+		ts := uint32(tagHeader[7])<<24 | uint32(tagHeader[4])<<16 | uint32(tagHeader[5])<<8 | uint32(tagHeader[6])
+		info.Duration = float64(ts) / 1000
+	}
+	return info, nil
+}
+
+// MP4：顶层 box 的大小之和必须恰好等于文件大小，时长取自 moov/mvhd
+func probeMP4(r io.ReadSeeker, size int64) (*Info, error) {
+	info := &Info{Format: FormatMP4}
+	var hasMoov bool
+
+	var offset int64
+	header := make([]byte, 16)
+	for offset < size {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(r, header[:8]); err != nil {
+			return nil, ErrTruncated
+		}
+		boxSize := int64(binary.BigEndian.Uint32(header[:4]))
+		boxType := string(header[4:8])
+		headerSize := int64(8)
+		switch boxSize {
+		case 0:
+			boxSize = size - offset
+		case 1:
+			if _, err := io.ReadFull(r, header[8:16]); err != nil {
+				return nil, ErrTruncated
+			}
+			boxSize = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerSize = 16
+		}
+		if boxSize < headerSize || offset+boxSize > size {
+			return nil, ErrTruncated
+		}
+
+		if boxType == "moov" {
+			hasMoov = true
+			d, err := mvhdDuration(r, offset+headerSize, offset+boxSize)
+			if err != nil {
+				return nil, err
+			}
+			info.Duration = d
+		}
+		offset += boxSize
+	}
+	if !hasMoov {
+		return nil, ErrTruncated
+	}
+	return info, nil
+}
+
+func mvhdDuration(r io.ReadSeeker, start, end int64) (float64, error) {
+	header := make([]byte, 8)
+	for offset := start; offset+8 <= end; {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return 0, err
+		}
+		if _, err := io.ReadFull(r, header); err != nil {
+			return 0, ErrTruncated
+		}
+		boxSize := int64(binary.BigEndian.Uint32(header[:4]))
+		if boxSize < 8 || offset+boxSize > end {
+			return 0, ErrTruncated
+		}
+		if string(header[4:8]) != "mvhd" {
+			offset += boxSize
+			continue
+		}
+
+		// version 0 的 mvhd 至少 20 字节，version 1 至少 32 字节
+		if boxSize < 8+20 {
+			return 0, ErrTruncated
+		}
+		body := make([]byte, min(boxSize-8, 32))
+		if _, err := io.ReadFull(r, body); err != nil {
+			return 0, ErrTruncated
+		}
+		var timescale uint32
+		var duration uint64
+		if body[0] == 1 {
+			if len(body) < 32 {
+				return 0, ErrTruncated
+			}
+			timescale = binary.BigEndian.Uint32(body[20:24])
+			duration = binary.BigEndian.Uint64(body[24:32])
+		} else {
+			timescale = binary.BigEndian.Uint32(body[12:16])
+			duration = uint64(binary.BigEndian.Uint32(body[16:20]))
+		}
+		if timescale == 0 {
+			return 0, nil
+		}
+		return float64(duration) / float64(timescale), nil
+	}
+	return 0, nil
+}
@@ -0,0 +1,243 @@
+// Package retention 按 schedule.cleanup 中的规则删除本地视频文件
+package retention
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/panedioic/bilibili-favlist-syncer/internal/config"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/db"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/library"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/storage"
+	"github.com/panedioic/bilibili-favlist-syncer/utils"
+	"go.uber.org/zap"
+)
+
+// 删除原因
+const (
+	ReasonRemoved = "removed" // 移出收藏夹超过保留天数
+	ReasonQuota   = "quota"   // 收藏夹超过存储上限
+)
+
+var (
+	ErrRunning  = errors.New("清理任务正在进行")
+	ErrDisabled = errors.New("未启用清理规则 (schedule.cleanup.enabled)")
+)
+
+// Candidate 为一个待删除的视频
+type Candidate struct {
+	Video  *db.Video
+	Reason string
+}
+
+// Plan 为一次清理的预览
+type Plan struct {
+	GeneratedAt time.Time
+	Candidates  []Candidate
+	TotalSize   int64
+}
+
+type Manager struct {
+	cfg    *config.Config
+	logger utils.Logger
+	db     *db.DB
+	st     storage.Storage
+
+	mu      sync.Mutex
+	running bool
+}
+
+func NewManager(cfg *config.Config, logger utils.Logger, database *db.DB, st storage.Storage) *Manager {
+	return &Manager{
+		cfg:    cfg,
+		logger: logger,
+		db:     database,
+		st:     st,
+	}
+}
+
+// Run 按 schedule.cleanup.interval 定期清理，未启用时直接返回
+func (m *Manager) Run(ctx context.Context) {
+	cleanup := m.cfg.Schedule.Cleanup
+	if !cleanup.Enabled || cleanup.Interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(cleanup.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := m.Execute(ctx); err != nil && !errors.Is(err, ErrRunning) {
+				m.logger.Error("清理视频失败", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Preview 计算当前规则下会被删除的视频，不做任何修改
+func (m *Manager) Preview() (*Plan, error) {
+	favlists, err := m.db.ListFavlists()
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{GeneratedAt: time.Now(), Candidates: make([]Candidate, 0)}
+	// 同一视频在多个收藏夹中时只删除一次
+	selected := make(map[int64]bool)
+	for _, f := range favlists {
+		rule := m.cfg.Schedule.Cleanup.RuleFor(f.ID)
+		videos, err := m.downloadedVideos(f.ID)
+		if err != nil {
+			return nil, err
+		}
+		shared, err := m.db.ListSharedVideos(f.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range planFavlist(videos, shared, rule, plan.GeneratedAt) {
+			if selected[c.Video.ID] {
+				continue
+			}
+			selected[c.Video.ID] = true
+			plan.Candidates = append(plan.Candidates, c)
+			plan.TotalSize += c.Video.FileSize
+		}
+	}
+	return plan, nil
+}
+
+// Execute 按当前规则删除文件并写入清理记录，返回实际执行的计划。未启用清理时返回 ErrDisabled
+func (m *Manager) Execute(ctx context.Context) (*Plan, error) {
+	if !m.cfg.Schedule.Cleanup.Enabled {
+		return nil, ErrDisabled
+	}
+	m.mu.Lock()
+	if m.running {
+		m.mu.Unlock()
+		return nil, ErrRunning
+	}
+	m.running = true
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		m.running = false
+		m.mu.Unlock()
+	}()
+
+	plan, err := m.Preview()
+	if err != nil {
+		return nil, err
+	}
+
+	done := &Plan{GeneratedAt: plan.GeneratedAt, Candidates: make([]Candidate, 0, len(plan.Candidates))}
+	for _, c := range plan.Candidates {
+		if err := ctx.Err(); err != nil {
+			return done, err
+		}
+		if err := m.remove(ctx, c); err != nil {
+			m.logger.Warn("删除视频文件失败", zap.String("bvid", c.Video.BVID), zap.Error(err))
+			continue
+		}
+		done.Candidates = append(done.Candidates, c)
+		done.TotalSize += c.Video.FileSize
+	}
+	if len(done.Candidates) > 0 {
+		m.logger.Info("清理视频完成", zap.Int("count", len(done.Candidates)), zap.Int64("bytes", done.TotalSize))
+	}
+	return done, nil
+}
+
+// 只删除视频文件，弹幕、字幕与元数据体积很小，保留作为存档
+func (m *Manager) remove(ctx context.Context, c Candidate) error {
+	path := library.VideoPath(m.cfg, c.Video)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	// 本地存储中对象就是上面的文件
+	if m.st != nil && m.st.Type() != storage.TypeLocal {
+		if key, err := storage.KeyFor(storage.BaseDir(m.cfg), path); err == nil {
+			if err := m.st.Delete(ctx, key); err != nil {
+				return err
+			}
+		}
+	}
+	return m.db.MarkVideoDeleted(c.Video, path, c.Reason)
+}
+
+// 收藏夹中已下载的视频，按收藏时间从早到晚排列
+func (m *Manager) downloadedVideos(favlistID int64) ([]*db.Video, error) {
+	downloaded := true
+	filter := db.VideoFilter{FavlistID: favlistID, IsDownloaded: &downloaded, SortBy: "fav_time", PageSize: 500}
+
+	var videos []*db.Video
+	for {
+		list, err := m.db.ListVideos(filter)
+		if err != nil {
+			return nil, err
+		}
+		videos = append(videos, list.Videos...)
+		if list.NextCursor == "" {
+			return videos, nil
+		}
+		filter.Cursor = list.NextCursor
+	}
+}
+
+// 对单个收藏夹应用规则。先删除移出超过保留天数的视频，
+// 仍超出存储上限时优先删除已移出的视频，再从最早收藏的开始删除。
+// shared 中的视频仍在其他收藏夹中，不会因为本收藏夹超出上限而被删除
+func planFavlist(videos []*db.Video, shared map[string]bool, rule config.CleanupRule, now time.Time) []Candidate {
+	var candidates []Candidate
+	selected := make(map[int64]bool)
+	protected := func(v *db.Video) bool {
+		return rule.KeepInvalid && v.IsInvalid
+	}
+
+	var total int64
+	for _, v := range videos {
+		total += v.FileSize
+	}
+
+	if rule.KeepDays > 0 {
+		keep := time.Duration(rule.KeepDays) * 24 * time.Hour
+		for _, v := range videos {
+			if !v.IsRemoved || v.RemovedAt.IsZero() || protected(v) || now.Sub(v.RemovedAt) < keep {
+				continue
+			}
+			candidates = append(candidates, Candidate{Video: v, Reason: ReasonRemoved})
+			selected[v.ID] = true
+			total -= v.FileSize
+		}
+	}
+
+	limit := int64(rule.MaxSize) << 20
+	if limit <= 0 || total <= limit {
+		return candidates
+	}
+
+	ordered := make([]*db.Video, 0, len(videos))
+	for _, v := range videos {
+		if !selected[v.ID] && !protected(v) && !shared[v.BVID] {
+			ordered = append(ordered, v)
+		}
+	}
+	// videos 已按收藏时间排序，稳定排序保留这一顺序
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].IsRemoved && !ordered[j].IsRemoved
+	})
+	for _, v := range ordered {
+		if total <= limit {
+			break
+		}
+		candidates = append(candidates, Candidate{Video: v, Reason: ReasonQuota})
+		total -= v.FileSize
+	}
+	return candidates
+}
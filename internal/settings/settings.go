@@ -0,0 +1,129 @@
+// Package settings 持有运行中的配置。配置文件变更或通过接口修改后重新校验，
+// 把可以在运行时生效的变更通知给各个模块，需要重启的变更直接拒绝
+package settings
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/panedioic/bilibili-favlist-syncer/internal/config"
+	"github.com/panedioic/bilibili-favlist-syncer/utils"
+	"go.uber.org/zap"
+)
+
+// ErrInvalid 表示新的配置格式错误或未通过校验
+var ErrInvalid = errors.New("配置无效")
+
+// RestartRequiredError 表示变更中包含需要重启才能生效的配置项，整个变更未应用
+type RestartRequiredError struct {
+	Paths []string
+}
+
+func (e *RestartRequiredError) Error() string {
+	return fmt.Sprintf("以下配置项需要重启才能生效，本次变更未应用: %s", strings.Join(e.Paths, ", "))
+}
+
+type Manager struct {
+	path   string // 配置文件路径，接口修改的配置写回该文件
+	logger utils.Logger
+
+	applyMu     sync.Mutex // 保证变更按顺序应用，回调中可以调用 Current
+	mu          sync.RWMutex
+	current     *config.Config
+	subscribers []func(cfg *config.Config, changed []string)
+}
+
+func NewManager(path string, cfg *config.Config, logger utils.Logger) *Manager {
+	return &Manager{path: path, current: cfg, logger: logger}
+}
+
+// Current 返回当前生效的配置。返回的配置不会再被修改，变更时整体替换
+func (m *Manager) Current() *config.Config {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.current
+}
+
+// Subscribe 注册配置变更的回调，回调按注册顺序执行，changed 为变更的配置项
+func (m *Manager) Subscribe(fn func(cfg *config.Config, changed []string)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subscribers = append(m.subscribers, fn)
+}
+
+// Apply 校验并应用新的配置，返回变更的配置项。
+// 变更中包含需要重启的配置项时返回 *RestartRequiredError
+func (m *Manager) Apply(next *config.Config) ([]string, error) {
+	m.applyMu.Lock()
+	defer m.applyMu.Unlock()
+	return m.apply(next, false)
+}
+
+// Update 把部分更新合并到当前配置，校验通过后写回配置文件并应用，返回变更的配置项。
+// patch 的键与配置文件一致，例如 {"download": {"concurrent": 5}}
+func (m *Manager) Update(patch map[string]any) ([]string, error) {
+	m.applyMu.Lock()
+	defer m.applyMu.Unlock()
+	next, err := config.Merge(m.Current(), patch)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+	return m.apply(next, true)
+}
+
+func (m *Manager) apply(next *config.Config, persist bool) ([]string, error) {
+	if err := next.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+	changed := config.Diff(m.Current(), next)
+	if len(changed) == 0 {
+		return nil, nil
+	}
+	if paths := config.RestartRequired(changed); len(paths) > 0 {
+		return nil, &RestartRequiredError{Paths: paths}
+	}
+	// 先写回文件，写入失败时不应用。文件变更触发的重新加载随后比较时没有差异
+	if persist && m.path != "" {
+		if err := config.Save(m.path, next, changed); err != nil {
+			return nil, err
+		}
+	}
+
+	m.mu.Lock()
+	m.current = next
+	subscribers := m.subscribers
+	m.mu.Unlock()
+	for _, fn := range subscribers {
+		fn(next, changed)
+	}
+	m.logger.Info("配置已更新", zap.Strings("changed", changed))
+	return changed, nil
+}
+
+// Schema 返回配置文件的 JSON Schema，配置项说明取自配置文件中的注释
+func (m *Manager) Schema() map[string]any {
+	var descriptions map[string]string
+	if data, err := os.ReadFile(m.path); err == nil {
+		if descriptions, err = config.Descriptions(data); err != nil {
+			m.logger.Warn("解析配置文件注释失败", zap.String("path", m.path), zap.Error(err))
+		}
+	}
+	return config.Schema(descriptions)
+}
+
+// Watch 监听配置文件，文件变更后自动应用
+func (m *Manager) Watch() error {
+	path := m.path
+	return config.Watch(path, func(cfg *config.Config, err error) {
+		if err != nil {
+			m.logger.Error("重新加载配置失败，继续使用当前配置", zap.String("path", path), zap.Error(err))
+			return
+		}
+		if _, err := m.Apply(cfg); err != nil {
+			m.logger.Error("配置文件变更未生效", zap.String("path", path), zap.Error(err))
+		}
+	})
+}
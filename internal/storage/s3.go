@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/panedioic/bilibili-favlist-syncer/internal/config"
+)
+
+// S3 兼容的对象存储，单次 PUT 上传，适用于 5GB 以内的文件
+type S3 struct {
+	endpoint  *url.URL
+	bucket    string
+	prefix    string
+	pathStyle bool
+	signer    *signer
+	client    *http.Client
+}
+
+func NewS3(cfg config.S3Config, client *http.Client) (*S3, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, errors.New("S3 存储需要配置 endpoint 与 bucket")
+	}
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("无效的 S3 endpoint: %s", cfg.Endpoint)
+	}
+	region := cfg.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	return &S3{
+		endpoint:  endpoint,
+		bucket:    cfg.Bucket,
+		prefix:    strings.Trim(cfg.Prefix, "/"),
+		pathStyle: cfg.PathStyle,
+		signer: &signer{
+			accessKey: cfg.AccessKey,
+			secretKey: cfg.SecretKey,
+			region:    region,
+			service:   "s3",
+		},
+		client: client,
+	}, nil
+}
+
+func (s *S3) Type() string { return TypeS3 }
+
+func (s *S3) objectURL(key string) *url.URL {
+	if s.prefix != "" {
+		key = s.prefix + "/" + key
+	}
+	u := *s.endpoint
+	if s.pathStyle {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.bucket + "/" + key
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + key
+	}
+	// 让 EscapedPath 对特殊字符统一编码
+	u.RawPath = ""
+	return &u
+}
+
+func (s *S3) do(ctx context.Context, method, key string, body io.Reader, size int64, payloadHash string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key).String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.ContentLength = size
+		req.Header.Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+	s.signer.sign(req, payloadHash, time.Now())
+	// Content-Length 由 http.Client 写入
+	req.Header.Del("Content-Length")
+	return s.client.Do(req)
+}
+
+// 流式上传时计算 MD5，并与返回的 ETag 比较
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	hash := md5.New()
+	resp, err := s.do(ctx, http.MethodPut, key, io.TeeReader(r, hash), size, unsignedPayload, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := checkS3Response(resp); err != nil {
+		return err
+	}
+
+	etag := strings.Trim(resp.Header.Get("ETag"), `"`)
+	if sum := hex.EncodeToString(hash.Sum(nil)); etag != "" && !strings.Contains(etag, "-") && !strings.EqualFold(etag, sum) {
+		return fmt.Errorf("上传内容校验失败: ETag %s, MD5 %s", etag, sum)
+	}
+	return nil
+}
+
+func (s *S3) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	resp, err := s.do(ctx, http.MethodHead, key, nil, 0, emptyPayloadHash, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := checkS3Response(resp); err != nil {
+		return nil, err
+	}
+	info := &ObjectInfo{
+		Key:  key,
+		Size: resp.ContentLength,
+		ETag: strings.Trim(resp.Header.Get("ETag"), `"`),
+	}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.ModTime = t
+	}
+	return info, nil
+}
+
+func (s *S3) OpenRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	header := http.Header{}
+	if r := rangeHeader(offset, length); r != "" {
+		header.Set("Range", r)
+	}
+	resp, err := s.do(ctx, http.MethodGet, key, nil, 0, emptyPayloadHash, header)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkS3Response(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, 0, emptyPayloadHash, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := checkS3Response(resp); err != nil && !errors.Is(err, ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func checkS3Response(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotExist
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("S3 请求失败，状态码: %d %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+// 生成 Range 请求头，length 不大于 0 时读到末尾，从头读到尾时返回空
+func rangeHeader(offset, length int64) string {
+	switch {
+	case length > 0:
+		return fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+	case offset > 0:
+		return fmt.Sprintf("bytes=%d-", offset)
+	}
+	return ""
+}
@@ -0,0 +1,90 @@
+// Package storage 抽象视频、封面与元数据的存储位置。
+// 下载目录始终作为本地暂存区，完成的文件再写入配置的存储后端
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/panedioic/bilibili-favlist-syncer/internal/config"
+)
+
+// 存储类型
+const (
+	TypeLocal  = "local"
+	TypeS3     = "s3"
+	TypeWebDAV = "webdav"
+)
+
+var (
+	ErrNotExist   = errors.New("对象不存在")
+	ErrInvalidKey = errors.New("无效的对象路径")
+)
+
+// ObjectInfo 为存储中对象的基本信息
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+	ETag    string
+	SHA256  string // 后端提供的内容 SHA-256（十六进制小写），不提供时为空
+}
+
+// Storage 为存储后端。key 使用 / 分隔，相对于存储根目录
+type Storage interface {
+	// Put 以流的方式写入对象，size 为内容长度
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	// OpenRange 从 offset 开始读取对象，length 不大于 0 时读到末尾
+	OpenRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	Type() string
+}
+
+// New 按配置创建存储后端，本地存储的根目录为下载目录。
+// client 用于远程存储的请求，应使用共享的传输层并设置 storage.timeout
+func New(cfg *config.Config, client *http.Client) (Storage, error) {
+	switch cfg.Storage.Type {
+	case "", TypeLocal:
+		return NewLocal(BaseDir(cfg)), nil
+	case TypeS3:
+		return NewS3(cfg.Storage.S3, client)
+	case TypeWebDAV:
+		return NewWebDAV(cfg.Storage.WebDAV, client)
+	}
+	return nil, fmt.Errorf("不支持的存储类型: %s", cfg.Storage.Type)
+}
+
+// BaseDir 返回下载目录，未配置时使用 ./downloads
+func BaseDir(cfg *config.Config) string {
+	if cfg.Download.BaseDir == "" {
+		return "./downloads"
+	}
+	return cfg.Download.BaseDir
+}
+
+// KeyFor 将下载目录中的本地路径转换为对象 key
+func KeyFor(baseDir, localPath string) (string, error) {
+	rel, err := filepath.Rel(baseDir, localPath)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", ErrInvalidKey
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// CleanKey 校验并规范化来自请求的 key，拒绝跳出根目录的路径
+func CleanKey(key string) (string, error) {
+	key = strings.ReplaceAll(key, "\\", "/")
+	cleaned := path.Clean("/" + key)
+	if cleaned == "/" {
+		return "", ErrInvalidKey
+	}
+	return strings.TrimPrefix(cleaned, "/"), nil
+}
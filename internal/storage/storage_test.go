@@ -0,0 +1,312 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/panedioic/bilibili-favlist-syncer/internal/config"
+	"golang.org/x/net/webdav"
+)
+
+// 每个后端都要通过的基本操作：写入、查询、按范围读取与删除
+func testBackend(t *testing.T, st Storage) {
+	t.Helper()
+	ctx := context.Background()
+	key := "BV1xx411c7mD/BV1xx411c7mD 测试.flv"
+	content := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+
+	if _, err := st.Stat(ctx, key); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("Stat 不存在的对象: err = %v, want ErrNotExist", err)
+	}
+	if err := st.Put(ctx, key, bytes.NewReader(content), int64(len(content))); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	info, err := st.Stat(ctx, key)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Size != int64(len(content)) {
+		t.Errorf("Stat.Size = %d, want %d", info.Size, len(content))
+	}
+
+	ranges := []struct {
+		name           string
+		offset, length int64
+		want           string
+	}{
+		{"完整读取", 0, -1, string(content)},
+		{"从偏移读到末尾", 30, -1, string(content[30:])},
+		{"length 为 0 时读到末尾", 30, 0, string(content[30:])},
+		{"指定范围", 10, 5, string(content[10:15])},
+	}
+	for _, r := range ranges {
+		body, err := st.OpenRange(ctx, key, r.offset, r.length)
+		if err != nil {
+			t.Fatalf("%s: OpenRange: %v", r.name, err)
+		}
+		got, err := io.ReadAll(body)
+		body.Close()
+		if err != nil {
+			t.Fatalf("%s: 读取: %v", r.name, err)
+		}
+		if string(got) != r.want {
+			t.Errorf("%s: OpenRange(%d, %d) = %q, want %q", r.name, r.offset, r.length, got, r.want)
+		}
+	}
+
+	if err := st.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := st.Stat(ctx, key); !errors.Is(err, ErrNotExist) {
+		t.Errorf("删除后 Stat: err = %v, want ErrNotExist", err)
+	}
+	if err := st.Delete(ctx, key); err != nil {
+		t.Errorf("删除不存在的对象: %v", err)
+	}
+	if _, err := st.OpenRange(ctx, key, 0, -1); !errors.Is(err, ErrNotExist) {
+		t.Errorf("删除后 OpenRange: err = %v, want ErrNotExist", err)
+	}
+}
+
+func TestLocal(t *testing.T) {
+	testBackend(t, NewLocal(t.TempDir()))
+}
+
+func TestS3(t *testing.T) {
+	fake := newFakeS3(t, "bucket")
+	st, err := NewS3(config.S3Config{
+		Endpoint:  fake.URL,
+		Bucket:    "bucket",
+		AccessKey: exampleAccessKey,
+		SecretKey: exampleSecretKey,
+		Prefix:    "/videos/",
+		PathStyle: true,
+	}, &http.Client{Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBackend(t, st)
+
+	// 对象 key 带上前缀
+	if err := st.Put(context.Background(), "a/b.txt", strings.NewReader("x"), 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.objects["/bucket/videos/a/b.txt"]; !ok {
+		t.Errorf("对象路径不含前缀: %v", fake.keys())
+	}
+}
+
+func TestS3RejectsBadSignature(t *testing.T) {
+	fake := newFakeS3(t, "bucket")
+	st, err := NewS3(config.S3Config{
+		Endpoint:  fake.URL,
+		Bucket:    "bucket",
+		AccessKey: exampleAccessKey,
+		SecretKey: "wrong",
+		PathStyle: true,
+	}, &http.Client{Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Put(context.Background(), "a.txt", strings.NewReader("x"), 1); err == nil {
+		t.Fatal("密钥错误时 Put 应当失败")
+	}
+}
+
+func TestWebDAV(t *testing.T) {
+	handler := &webdav.Handler{FileSystem: webdav.NewMemFS(), LockSystem: webdav.NewMemLS()}
+	var username, password string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		if !ok || u != username || p != password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	username, password = "user", "p@ss"
+
+	st, err := NewWebDAV(config.WebDAVConfig{URL: srv.URL + "/dav/", Username: username, Password: password}, &http.Client{Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 根目录需要存在，其下的目录由 Put 逐级创建
+	if err := handler.FileSystem.Mkdir(context.Background(), "/dav", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	testBackend(t, st)
+}
+
+func TestUpload(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	src := filepath.Join(dir, "video.flv")
+	if err := os.WriteFile(src, []byte("video content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	st := NewLocal(t.TempDir())
+	if err := Upload(ctx, st, "BV1/video.flv", src, config.RetryConfig{MaxAttempts: 1}); err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	info, err := st.Stat(ctx, "BV1/video.flv")
+	if err != nil || info.Size != int64(len("video content")) {
+		t.Fatalf("上传后 Stat = %+v, %v", info, err)
+	}
+
+	// 本地存储中目标就是源文件时不做任何操作
+	same := NewLocal(dir)
+	if err := Upload(ctx, same, "video.flv", src, config.RetryConfig{MaxAttempts: 1}); err != nil {
+		t.Fatalf("Upload 到源文件: %v", err)
+	}
+}
+
+// WebDAV 服务端在 OC-Checksum 中返回 SHA-256 时，上传后比对哈希
+func TestUploadVerifiesChecksum(t *testing.T) {
+	ctx := context.Background()
+	src := filepath.Join(t.TempDir(), "video.flv")
+	if err := os.WriteFile(src, []byte("video content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("video content"))
+
+	tests := []struct {
+		name     string
+		checksum string
+		wantErr  bool
+	}{
+		{"不提供校验和时只比对大小", "", false},
+		{"没有 SHA256 时只比对大小", "SHA1:da39a3ee5e6b4b0d3255bfef95601890afd80709", false},
+		{"哈希一致", "SHA1:da39a3ee5e6b4b0d3255bfef95601890afd80709 SHA256:" + strings.ToUpper(hex.EncodeToString(sum[:])), false},
+		{"哈希不一致", "SHA256:" + strings.Repeat("0", 64), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &webdav.Handler{FileSystem: webdav.NewMemFS(), LockSystem: webdav.NewMemLS()}
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodHead && tt.checksum != "" {
+					w.Header().Set("OC-Checksum", tt.checksum)
+				}
+				handler.ServeHTTP(w, r)
+			}))
+			t.Cleanup(srv.Close)
+			st, err := NewWebDAV(config.WebDAVConfig{URL: srv.URL}, srv.Client())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = Upload(ctx, st, "BV1/video.flv", src, config.RetryConfig{MaxAttempts: 1})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Upload = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// 内存中的 S3 兼容服务，用相同的签名算法校验每个请求
+type fakeS3 struct {
+	*httptest.Server
+	signer *signer
+
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newFakeS3(t *testing.T, bucket string) *fakeS3 {
+	f := &fakeS3{
+		signer:  &signer{accessKey: exampleAccessKey, secretKey: exampleSecretKey, region: "us-east-1", service: "s3"},
+		objects: make(map[string][]byte),
+	}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeS3) keys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	keys := make([]string, 0, len(f.objects))
+	for k := range f.objects {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (f *fakeS3) serve(w http.ResponseWriter, r *http.Request) {
+	if err := f.verify(r); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := r.URL.Path
+	switch r.Method {
+	case http.MethodPut:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.objects[key] = body
+		sum := md5.Sum(body)
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	case http.MethodHead, http.MethodGet:
+		body, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		http.ServeContent(w, r, key, time.Time{}, bytes.NewReader(body))
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// 只用 Authorization 中列出的请求头重新签名，与客户端的签名比较
+func (f *fakeS3) verify(r *http.Request) error {
+	auth := r.Header.Get("Authorization")
+	_, rest, ok := strings.Cut(auth, "SignedHeaders=")
+	if !ok {
+		return fmt.Errorf("缺少签名: %q", auth)
+	}
+	signed, _, _ := strings.Cut(rest, ",")
+	date, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+	if err != nil {
+		return err
+	}
+	for _, name := range strings.Split(signed, ";") {
+		if name != "host" {
+			req.Header[http.CanonicalHeaderKey(name)] = r.Header.Values(name)
+		}
+	}
+	f.signer.sign(req, r.Header.Get("X-Amz-Content-Sha256"), date)
+	if want := req.Header.Get("Authorization"); want != auth {
+		return fmt.Errorf("签名不匹配")
+	}
+	return nil
+}
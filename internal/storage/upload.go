@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/panedioic/bilibili-favlist-syncer/internal/config"
+)
+
+// Upload 将本地文件写入存储，失败时按 retry 重试，写入后比对大小确认上传完整；
+// 后端返回内容的 SHA-256 时同时比对哈希。S3 在写入时已按 MD5 校验内容，
+// 标准 WebDAV 不提供校验和，只有 Nextcloud/ownCloud 等返回 OC-Checksum 的服务端能比对哈希。
+// 本地存储且目标就是源文件时不做任何操作
+func Upload(ctx context.Context, st Storage, key, localPath string, retry config.RetryConfig) error {
+	if l, ok := st.(*Local); ok && samePath(l.Path(key), localPath) {
+		return nil
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= max(retry.MaxAttempts, 1); attempt++ {
+		if lastErr = uploadOnce(ctx, st, key, localPath); lastErr == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if attempt < retry.MaxAttempts {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(retry.Backoff):
+			}
+		}
+	}
+	return fmt.Errorf("上传 %s 失败: %w", key, lastErr)
+}
+
+func uploadOnce(ctx context.Context, st Storage, key, localPath string) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	// 上传的同时计算哈希，不需要再读一遍文件
+	h := sha256.New()
+	if err := st.Put(ctx, key, io.TeeReader(f, h), fi.Size()); err != nil {
+		return err
+	}
+	info, err := st.Stat(ctx, key)
+	if err != nil {
+		return fmt.Errorf("上传后校验失败: %w", err)
+	}
+	if info.Size != fi.Size() {
+		return fmt.Errorf("上传后大小不符: %d/%d 字节", info.Size, fi.Size())
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); info.SHA256 != "" && info.SHA256 != sum {
+		return fmt.Errorf("上传后哈希不符: %s/%s", info.SHA256, sum)
+	}
+	return nil
+}
+
+func samePath(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
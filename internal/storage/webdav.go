@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/panedioic/bilibili-favlist-syncer/internal/config"
+)
+
+// WebDAV 存储，写入前逐级创建父目录
+type WebDAV struct {
+	base     *url.URL
+	username string
+	password string
+	client   *http.Client
+}
+
+func NewWebDAV(cfg config.WebDAVConfig, client *http.Client) (*WebDAV, error) {
+	base, err := url.Parse(cfg.URL)
+	if err != nil || base.Host == "" {
+		return nil, fmt.Errorf("无效的 WebDAV 地址: %s", cfg.URL)
+	}
+	base.Path = strings.TrimSuffix(base.Path, "/")
+	return &WebDAV{
+		base:     base,
+		username: cfg.Username,
+		password: cfg.Password,
+		client:   client,
+	}, nil
+}
+
+func (w *WebDAV) Type() string { return TypeWebDAV }
+
+func (w *WebDAV) url(p string) string {
+	u := *w.base
+	u.Path = w.base.Path + "/" + p
+	u.RawPath = ""
+	return u.String()
+}
+
+func (w *WebDAV) do(ctx context.Context, method, p string, body io.Reader, size int64, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, w.url(p), body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	if w.username != "" {
+		req.SetBasicAuth(w.username, w.password)
+	}
+	return w.client.Do(req)
+}
+
+func (w *WebDAV) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	if err := w.mkdirAll(ctx, path.Dir(key)); err != nil {
+		return err
+	}
+	resp, err := w.do(ctx, http.MethodPut, key, r, size, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkWebDAVResponse(resp)
+}
+
+// mkdirAll 逐级 MKCOL，已存在的目录返回 405 视为成功
+func (w *WebDAV) mkdirAll(ctx context.Context, dir string) error {
+	if dir == "." || dir == "/" || dir == "" {
+		return nil
+	}
+	var current string
+	for _, part := range strings.Split(dir, "/") {
+		current = path.Join(current, part)
+		resp, err := w.do(ctx, "MKCOL", current+"/", nil, 0, nil)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusMethodNotAllowed &&
+			(resp.StatusCode < 200 || resp.StatusCode >= 300) {
+			return fmt.Errorf("创建 WebDAV 目录 %s 失败，状态码: %d", current, resp.StatusCode)
+		}
+	}
+	return nil
+}
+
+func (w *WebDAV) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	resp, err := w.do(ctx, http.MethodHead, key, nil, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := checkWebDAVResponse(resp); err != nil {
+		return nil, err
+	}
+	info := &ObjectInfo{Key: key, Size: resp.ContentLength, ETag: strings.Trim(resp.Header.Get("ETag"), `"`)}
+	if info.Size < 0 {
+		info.Size, _ = strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.ModTime = t
+	} else {
+		info.ModTime = time.Time{}
+	}
+	info.SHA256 = ocChecksum(resp.Header.Get("OC-Checksum"), "SHA256")
+	return info, nil
+}
+
+// 标准 WebDAV 没有内容校验和。Nextcloud/ownCloud 在 OC-Checksum 中返回
+// 以空格分隔的 "算法:值"，例如 "SHA1:... MD5:..."，没有对应算法时返回空
+func ocChecksum(header, algorithm string) string {
+	for _, field := range strings.Fields(header) {
+		if name, value, ok := strings.Cut(field, ":"); ok && strings.EqualFold(name, algorithm) {
+			return strings.ToLower(value)
+		}
+	}
+	return ""
+}
+
+func (w *WebDAV) OpenRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	header := http.Header{}
+	if r := rangeHeader(offset, length); r != "" {
+		header.Set("Range", r)
+	}
+	resp, err := w.do(ctx, http.MethodGet, key, nil, 0, header)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkWebDAVResponse(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	// 服务器忽略 Range 时返回完整内容，需要自行跳过
+	if offset > 0 && resp.StatusCode == http.StatusOK {
+		if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		if length > 0 {
+			return struct {
+				io.Reader
+				io.Closer
+			}{io.LimitReader(resp.Body, length), resp.Body}, nil
+		}
+	}
+	return resp.Body, nil
+}
+
+func (w *WebDAV) Delete(ctx context.Context, key string) error {
+	resp, err := w.do(ctx, http.MethodDelete, key, nil, 0, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := checkWebDAVResponse(resp); err != nil && !errors.Is(err, ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func checkWebDAVResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotExist
+	}
+	return fmt.Errorf("WebDAV 请求失败，状态码: %d", resp.StatusCode)
+}
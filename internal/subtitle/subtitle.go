@@ -0,0 +1,71 @@
+// Package subtitle 解析B站CC/AI字幕的JSON格式并转换为 SRT、WebVTT
+package subtitle
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// Line 为字幕中的一句，时间单位为秒
+type Line struct {
+	From    float64 `json:"from"`
+	To      float64 `json:"to"`
+	Content string  `json:"content"`
+}
+
+// Document 为字幕文件的JSON内容，只保留转换需要的字段
+type Document struct {
+	Body []Line `json:"body"`
+}
+
+func Parse(data []byte) (*Document, error) {
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("解析字幕JSON失败: %w", err)
+	}
+	return &doc, nil
+}
+
+// WriteSRT 输出 SubRip 格式
+func WriteSRT(w io.Writer, doc *Document) error {
+	bw := bufio.NewWriter(w)
+	for i, l := range doc.Body {
+		fmt.Fprintf(bw, "%d\n%s --> %s\n%s\n\n", i+1, formatTime(l.From, ","), formatTime(l.To, ","), normalize(l.Content))
+	}
+	return bw.Flush()
+}
+
+// WriteVTT 输出 WebVTT 格式，可直接用于 <track> 标签
+func WriteVTT(w io.Writer, doc *Document) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("WEBVTT\n\n")
+	for _, l := range doc.Body {
+		fmt.Fprintf(bw, "%s --> %s\n%s\n\n", formatTime(l.From, "."), formatTime(l.To, "."), normalize(l.Content))
+	}
+	return bw.Flush()
+}
+
+// 空行在两种格式中都表示一条字幕结束，需要去掉
+func normalize(s string) string {
+	s = strings.ReplaceAll(s, "\r", "")
+	lines := strings.Split(s, "\n")
+	out := lines[:0]
+	for _, l := range lines {
+		if strings.TrimSpace(l) != "" {
+			out = append(out, l)
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+func formatTime(sec float64, sep string) string {
+	if sec < 0 {
+		sec = 0
+	}
+	ms := int64(math.Round(sec * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
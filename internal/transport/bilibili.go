@@ -0,0 +1,42 @@
+package transport
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/CuteReimu/bilibili/v2"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/config"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/wbi"
+)
+
+// NewBilibiliClient 创建使用共享传输层的 B 站客户端，并带上配置中的登录 Cookie 与 User-Agent。
+// 客户端的所有请求都经过共享的限流器，多个收藏夹与下载任务合计不超过 advanced.rate_limit，
+// 并带上 WBI 签名与 buvid 设备 Cookie
+func (f *Factory) NewBilibiliClient(cfg *config.Config) *bilibili.Client {
+	client := bilibili.New()
+	if cfg.Bilibili.UserAgent != "" {
+		client.Resty().SetHeader("User-Agent", cfg.Bilibili.UserAgent)
+	}
+	userAgent := client.Resty().Header.Get("User-Agent")
+
+	// 获取密钥与设备标识的请求同样受限流，但不经过签名
+	keyClient := &http.Client{Transport: &throttledTransport{throttle: f.throttle, next: f.transport}, Timeout: 15 * time.Second}
+	signer := wbi.NewSigner(keyClient, userAgent)
+	device := wbi.NewDevice(keyClient, userAgent, cfg.Bilibili.Cookies.Buvid3, cfg.Bilibili.Cookies.Buvid4)
+	client.Resty().SetTransport(&throttledTransport{
+		throttle: f.throttle,
+		next:     wbi.NewTransport(f.transport, signer, device, f.logger),
+	})
+
+	cookies := map[string]string{
+		"SESSDATA":   cfg.Bilibili.Cookies.SESSDATA,
+		"bili_jct":   cfg.Bilibili.Cookies.BiliJCT,
+		"DedeUserID": cfg.Bilibili.Cookies.DedeUserID,
+	}
+	for name, value := range cookies {
+		if value != "" {
+			client.SetCookie(&http.Cookie{Name: name, Value: value, Path: "/", Domain: ".bilibili.com"})
+		}
+	}
+	return client
+}
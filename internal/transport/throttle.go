@@ -0,0 +1,345 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/panedioic/bilibili-favlist-syncer/internal/config"
+	"github.com/panedioic/bilibili-favlist-syncer/utils"
+	"go.uber.org/zap"
+)
+
+// 普通错误重试间隔的上限
+const maxRetryBackoff = 30 * time.Second
+
+// B 站接口的错误码
+const (
+	codeRiskControl   = -412 // 请求被拦截
+	codeRiskVerify    = -352 // 风控校验失败
+	codeTooFrequent   = -509 // 请求过于频繁
+	codeRequestLimit  = -799 // 请求过于频繁，请稍后再试
+	statusRiskControl = http.StatusPreconditionFailed
+)
+
+// ErrPaused 表示触发风控后所有请求暂停中，且调用方等不到暂停结束
+var ErrPaused = errors.New("触发B站风控，请求已暂停")
+
+// ErrStopped 表示程序正在关闭，不再发出新的请求
+var ErrStopped = errors.New("程序正在关闭，已停止请求B站接口")
+
+// 对一次响应的判断
+type verdict int
+
+const (
+	verdictOK    verdict = iota
+	verdictRetry         // 网络错误、5xx 或请求过于频繁，退避后重试
+	verdictRisk          // 触发风控，所有请求暂停
+)
+
+// Throttle 限制所有 B 站接口请求的速率，识别风控与限流错误码后退避。
+// 触发风控时整个客户端暂停，连续触发时暂停时间翻倍
+type Throttle struct {
+	logger utils.Logger
+	// 关闭时关闭，中断所有等待中的请求。库函数的请求大多没有截止时间，
+	// 风控暂停期间只能由此中断
+	stop     chan struct{}
+	stopOnce sync.Once
+	now      func() time.Time
+
+	mu           sync.Mutex
+	interval     time.Duration // 两次请求的最小间隔，由 advanced.rate_limit 换算
+	retry        config.RetryConfig
+	riskPause    time.Duration
+	maxRiskPause time.Duration
+	next         time.Time // 下一个请求最早可以发出的时间
+	pausedUntil  time.Time
+	strikes      int // 连续触发风控的次数，请求成功后清零
+	riskCount    int
+	lastRisk     time.Time
+}
+
+// ThrottleStatus 为限流器的当前状态
+type ThrottleStatus struct {
+	RateLimit   int
+	Paused      bool
+	PausedUntil time.Time
+	Strikes     int
+	RiskCount   int // 启动以来触发风控的次数
+	LastRisk    time.Time
+}
+
+func NewThrottle(cfg config.AdvancedConfig, logger utils.Logger) *Throttle {
+	t := &Throttle{logger: logger, stop: make(chan struct{}), now: time.Now}
+	t.Update(cfg)
+	return t
+}
+
+// Update 应用新的限流与退避配置，已在暂停中的请求不受影响
+func (t *Throttle) Update(cfg config.AdvancedConfig) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.interval = 0
+	if cfg.RateLimit > 0 {
+		t.interval = time.Second / time.Duration(cfg.RateLimit)
+	}
+	t.retry = cfg.APIRetry
+	t.riskPause = cfg.RiskPause
+	t.maxRiskPause = max(cfg.MaxRiskPause, cfg.RiskPause)
+}
+
+// Stop 中断所有等待中的请求，之后的请求直接返回 ErrStopped
+func (t *Throttle) Stop() {
+	t.stopOnce.Do(func() { close(t.stop) })
+}
+
+func (t *Throttle) Status() ThrottleStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := ThrottleStatus{
+		Strikes:   t.strikes,
+		RiskCount: t.riskCount,
+		LastRisk:  t.lastRisk,
+	}
+	if t.interval > 0 {
+		s.RateLimit = int(time.Second / t.interval)
+	}
+	if t.now().Before(t.pausedUntil) {
+		s.Paused = true
+		s.PausedUntil = t.pausedUntil
+	}
+	return s
+}
+
+// Wait 阻塞到可以发出下一个请求。暂停结束晚于 ctx 的截止时间时直接返回 ErrPaused，
+// 调用 Stop 后返回 ErrStopped
+func (t *Throttle) Wait(ctx context.Context) error {
+	for {
+		t.mu.Lock()
+		now := t.now()
+		if now.Before(t.pausedUntil) {
+			if deadline, ok := ctx.Deadline(); ok && deadline.Before(t.pausedUntil) {
+				until := t.pausedUntil
+				t.mu.Unlock()
+				return fmt.Errorf("%w，恢复时间: %s", ErrPaused, until.Format(time.DateTime))
+			}
+		}
+		slot := now
+		if slot.Before(t.next) {
+			slot = t.next
+		}
+		if slot.Before(t.pausedUntil) {
+			slot = t.pausedUntil
+		}
+		t.next = slot.Add(t.interval)
+		t.mu.Unlock()
+
+		if err := t.sleep(ctx, slot.Sub(now)); err != nil {
+			return err
+		}
+		// 等待期间可能又触发了风控
+		t.mu.Lock()
+		paused := t.now().Before(t.pausedUntil)
+		t.mu.Unlock()
+		if !paused {
+			return nil
+		}
+	}
+}
+
+// 记录一次风控，暂停所有请求
+func (t *Throttle) trip(reason string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	// 暂停期间发出的请求再次失败不重复计数
+	if now.Before(t.pausedUntil) {
+		return
+	}
+	pause := t.riskPause << min(t.strikes, 16)
+	if pause <= 0 || pause > t.maxRiskPause {
+		pause = t.maxRiskPause
+	}
+	pause = jitter(pause)
+	t.strikes++
+	t.riskCount++
+	t.lastRisk = now
+	t.pausedUntil = now.Add(pause)
+	t.logger.Warn("触发B站风控，暂停所有请求",
+		zap.String("reason", reason),
+		zap.Int("strikes", t.strikes),
+		zap.Duration("pause", pause),
+	)
+}
+
+func (t *Throttle) succeed() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.strikes > 0 && !t.now().Before(t.pausedUntil) {
+		t.logger.Info("B站请求已恢复", zap.Int("strikes", t.strikes))
+		t.strikes = 0
+	}
+}
+
+// 第 attempt 次重试前的等待时间，按次数翻倍并加随机抖动
+func (t *Throttle) backoff(attempt int) time.Duration {
+	t.mu.Lock()
+	base := t.retry.Backoff
+	t.mu.Unlock()
+	if base <= 0 {
+		return 0
+	}
+	return jitter(min(base<<min(attempt, 16), maxRetryBackoff))
+}
+
+func (t *Throttle) attempts() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return max(t.retry.MaxAttempts, 1)
+}
+
+// 判断响应是否需要重试或暂停。JSON 响应会被读出后重新放回 Body
+func inspect(resp *http.Response, err error) (verdict, string) {
+	if err != nil {
+		return verdictRetry, err.Error()
+	}
+	switch {
+	case resp.StatusCode == statusRiskControl:
+		return verdictRisk, fmt.Sprintf("状态码: %d", resp.StatusCode)
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return verdictRetry, fmt.Sprintf("状态码: %d", resp.StatusCode)
+	}
+	if !strings.Contains(resp.Header.Get("Content-Type"), "json") {
+		return verdictOK, ""
+	}
+
+	body, readErr := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if readErr != nil {
+		return verdictRetry, readErr.Error()
+	}
+	var result struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &result) != nil {
+		return verdictOK, ""
+	}
+	reason := fmt.Sprintf("错误码: %d, 错误信息: %s", result.Code, result.Message)
+	switch result.Code {
+	case codeRiskControl, codeRiskVerify:
+		return verdictRisk, reason
+	case codeTooFrequent, codeRequestLimit:
+		return verdictRetry, reason
+	}
+	return verdictOK, ""
+}
+
+// 在传输层上应用限流与退避，只用于 B 站接口客户端
+type throttledTransport struct {
+	throttle *Throttle
+	next     http.RoundTripper
+}
+
+func (t *throttledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	attempts := t.throttle.attempts()
+	for attempt := 1; ; attempt++ {
+		if err := t.throttle.Wait(ctx); err != nil {
+			return nil, err
+		}
+		resp, err := t.next.RoundTrip(req)
+		if ctx.Err() != nil {
+			return resp, err
+		}
+
+		v, reason := inspect(resp, err)
+		switch v {
+		case verdictOK:
+			t.throttle.succeed()
+			return resp, nil
+		case verdictRisk:
+			// 风控由全局暂停处理，当前请求不再重试
+			t.throttle.trip(reason)
+			return resp, err
+		}
+
+		// 带请求体但无法重放的请求不重试
+		if attempt >= attempts || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		wait := t.throttle.backoff(attempt - 1)
+		t.throttle.logger.Warn("B站请求失败，准备重试",
+			zap.String("url", req.URL.Redacted()),
+			zap.String("reason", reason),
+			zap.Int("attempt", attempt),
+			zap.Duration("wait", wait),
+		)
+		if err := t.throttle.sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+		if req, err = rewind(req); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// 复制请求并重新生成请求体
+func rewind(req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	clone := req.Clone(req.Context())
+	clone.Body = body
+	return clone, nil
+}
+
+// 等待 d，ctx 结束或调用 Stop 时提前返回
+func (t *Throttle) sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-t.stop:
+		return ErrStopped
+	default:
+	}
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.stop:
+		return ErrStopped
+	case <-timer.C:
+		return nil
+	}
+}
+
+// 在 d 的基础上随机浮动 ±25%，避免多个请求同时恢复
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return d
+	}
+	spread := int64(d) / 2
+	if spread <= 0 {
+		return d
+	}
+	return d - time.Duration(spread/2) + time.Duration(rand.Int64N(spread))
+}
@@ -0,0 +1,175 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/panedioic/bilibili-favlist-syncer/internal/config"
+	"github.com/panedioic/bilibili-favlist-syncer/utils"
+)
+
+var t0 = time.Unix(1700000000, 0)
+
+func newTestThrottle(now *time.Time, cfg config.AdvancedConfig) *Throttle {
+	t := NewThrottle(cfg, utils.NewLogger("error"))
+	t.now = func() time.Time { return *now }
+	return t
+}
+
+// d 加上 ±25% 的抖动后应落在的范围
+func checkJitter(t *testing.T, name string, got, d time.Duration) {
+	t.Helper()
+	if got < d-d/4 || got > d+d/4 {
+		t.Errorf("%s = %v, want %v ±25%%", name, got, d)
+	}
+}
+
+func TestThrottleRiskPause(t *testing.T) {
+	now := t0
+	th := newTestThrottle(&now, config.AdvancedConfig{RiskPause: time.Minute, MaxRiskPause: 5 * time.Minute})
+
+	// 连续触发时暂停时间翻倍，不超过 max_risk_pause
+	for i, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute} {
+		th.trip("-412")
+		s := th.Status()
+		if !s.Paused || s.Strikes != i+1 || s.RiskCount != i+1 || !s.LastRisk.Equal(now) {
+			t.Fatalf("第 %d 次触发后 Status = %+v", i+1, s)
+		}
+		checkJitter(t, "暂停时间", s.PausedUntil.Sub(now), want)
+
+		// 暂停期间再次失败不重复计数
+		th.trip("-352")
+		if got := th.Status(); got.Strikes != i+1 || !got.PausedUntil.Equal(s.PausedUntil) {
+			t.Errorf("暂停期间触发后 Status = %+v", got)
+		}
+		// 暂停期间成功的请求不清除连续次数
+		th.succeed()
+		if got := th.Status(); got.Strikes != i+1 {
+			t.Errorf("暂停期间成功后 Strikes = %d", got.Strikes)
+		}
+		now = s.PausedUntil
+	}
+
+	if s := th.Status(); s.Paused {
+		t.Errorf("暂停结束后 Status = %+v", s)
+	}
+	th.succeed()
+	if s := th.Status(); s.Strikes != 0 || s.RiskCount != 5 {
+		t.Errorf("恢复后 Status = %+v", s)
+	}
+	th.trip("-412")
+	checkJitter(t, "恢复后再次触发的暂停时间", th.Status().PausedUntil.Sub(now), time.Minute)
+}
+
+// ctx 的截止时间使用真实时间，因此时钟从当前时间开始
+func TestThrottleWait(t *testing.T) {
+	now := time.Now()
+	th := newTestThrottle(&now, config.AdvancedConfig{RateLimit: 1000, RiskPause: time.Minute, MaxRiskPause: time.Minute})
+	if s := th.Status(); s.RateLimit != 1000 {
+		t.Errorf("RateLimit = %d, want 1000", s.RateLimit)
+	}
+
+	// 请求按 rate_limit 排队
+	for range 3 {
+		if err := th.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := now.Add(3 * time.Millisecond); !th.next.Equal(want) {
+		t.Errorf("next = %v, want %v", th.next, want)
+	}
+
+	// 暂停结束晚于截止时间时不等待
+	th.trip("-412")
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(time.Second))
+	defer cancel()
+	if err := th.Wait(ctx); !errors.Is(err, ErrPaused) {
+		t.Errorf("暂停中 Wait = %v, want ErrPaused", err)
+	}
+
+	// Stop 后不再发出请求
+	th.Stop()
+	if err := th.Wait(context.Background()); !errors.Is(err, ErrStopped) {
+		t.Errorf("Stop 后 Wait = %v, want ErrStopped", err)
+	}
+}
+
+func TestThrottleBackoff(t *testing.T) {
+	now := t0
+	th := newTestThrottle(&now, config.AdvancedConfig{APIRetry: config.RetryConfig{MaxAttempts: 3, Backoff: time.Second}})
+	for attempt, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		checkJitter(t, "backoff", th.backoff(attempt), want)
+	}
+	// 间隔不超过 maxRetryBackoff
+	checkJitter(t, "backoff(10)", th.backoff(10), maxRetryBackoff)
+
+	th.Update(config.AdvancedConfig{})
+	if got := th.backoff(1); got != 0 {
+		t.Errorf("未配置间隔时 backoff = %v", got)
+	}
+	if got := th.attempts(); got != 1 {
+		t.Errorf("未配置次数时 attempts = %d, want 1", got)
+	}
+}
+
+func TestThrottledTransport(t *testing.T) {
+	// 按请求的序号返回响应，未列出的返回 503
+	responses := map[int32]string{
+		2: `{"code":-509,"message":"请求过于频繁"}`,
+		3: `{"code":0}`,
+		4: `{"code":-412,"message":"请求被拦截"}`,
+	}
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := responses[hits.Add(1)]
+		if !ok {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	now := time.Now()
+	th := newTestThrottle(&now, config.AdvancedConfig{
+		APIRetry:     config.RetryConfig{MaxAttempts: 3},
+		RiskPause:    time.Minute,
+		MaxRiskPause: time.Minute,
+	})
+	client := &http.Client{Transport: &throttledTransport{throttle: th, next: http.DefaultTransport}}
+
+	// 5xx 与请求过于频繁按次数重试
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if hits.Load() != 3 {
+		t.Errorf("hits = %d, want 3", hits.Load())
+	}
+
+	// 风控不重试，之后的请求暂停
+	resp, err = client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if s := th.Status(); hits.Load() != 4 || !s.Paused || s.Strikes != 1 {
+		t.Errorf("hits = %d, Status = %+v", hits.Load(), s)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if _, err := client.Do(req); !errors.Is(err, ErrPaused) {
+		t.Errorf("暂停中请求 = %v, want ErrPaused", err)
+	}
+	if hits.Load() != 4 {
+		t.Errorf("暂停中发出了请求: hits = %d", hits.Load())
+	}
+}
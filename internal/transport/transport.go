@@ -0,0 +1,200 @@
+// Package transport 提供共享的 HTTP 传输层。B 站接口、视频流与图片下载都通过它发出请求，
+// 统一应用 proxy 配置中的 HTTP/HTTPS/SOCKS5 代理和排除列表。B 站接口请求另外经过共享的限流器
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/panedioic/bilibili-favlist-syncer/internal/config"
+	"github.com/panedioic/bilibili-favlist-syncer/utils"
+	"go.uber.org/zap"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// 检查代理连通性时请求的地址
+const healthCheckURL = "https://www.bilibili.com/"
+
+// 支持的代理协议
+var proxySchemes = map[string]bool{"http": true, "https": true, "socks5": true, "socks5h": true}
+
+type Factory struct {
+	cfg       config.ProxyConfig
+	logger    utils.Logger
+	transport *http.Transport
+	proxyFunc func(*url.URL) (*url.URL, error)
+	throttle  *Throttle
+
+	mu     sync.RWMutex
+	health Health
+}
+
+// Health 为最近一次代理检查的结果
+type Health struct {
+	Enabled   bool
+	HTTP      string
+	HTTPS     string
+	OK        bool
+	Latency   time.Duration
+	Error     string
+	CheckedAt time.Time
+}
+
+func New(cfg *config.Config, logger utils.Logger) (*Factory, error) {
+	f := &Factory{cfg: cfg.Proxy, logger: logger, throttle: NewThrottle(cfg.Advanced, logger)}
+	if cfg.Proxy.Enabled {
+		if err := validateProxy(cfg.Proxy.HTTP); err != nil {
+			return nil, fmt.Errorf("proxy.http: %w", err)
+		}
+		if err := validateProxy(cfg.Proxy.HTTPS); err != nil {
+			return nil, fmt.Errorf("proxy.https: %w", err)
+		}
+		// 未单独配置 HTTPS 代理时，HTTPS 请求也使用 HTTP 代理
+		httpsProxy := cfg.Proxy.HTTPS
+		if httpsProxy == "" {
+			httpsProxy = cfg.Proxy.HTTP
+		}
+		f.proxyFunc = (&httpproxy.Config{
+			HTTPProxy:  cfg.Proxy.HTTP,
+			HTTPSProxy: httpsProxy,
+			NoProxy:    strings.Join(cfg.Proxy.Bypass, ","),
+		}).ProxyFunc()
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = f.proxy
+	transport.MaxIdleConnsPerHost = 16
+	f.transport = transport
+
+	f.health = Health{
+		Enabled: cfg.Proxy.Enabled,
+		HTTP:    redact(cfg.Proxy.HTTP),
+		HTTPS:   redact(cfg.Proxy.HTTPS),
+	}
+	return f, nil
+}
+
+func (f *Factory) proxy(req *http.Request) (*url.URL, error) {
+	if f.proxyFunc == nil {
+		return nil, nil
+	}
+	return f.proxyFunc(req.URL)
+}
+
+// Transport 返回共享的传输层，所有客户端复用同一个连接池
+func (f *Factory) Transport() http.RoundTripper {
+	return f.transport
+}
+
+// Client 创建使用共享传输层的客户端，timeout 为 0 表示不限制整体耗时
+func (f *Factory) Client(timeout time.Duration) *http.Client {
+	return &http.Client{Transport: f.transport, Timeout: timeout}
+}
+
+// Throttle 返回 B 站接口请求共享的限流器
+func (f *Factory) Throttle() *Throttle {
+	return f.throttle
+}
+
+// Health 返回最近一次代理检查的结果
+func (f *Factory) Health() Health {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.health
+}
+
+// Run 按 proxy.check_interval 定期检查代理，未启用代理时直接返回
+func (f *Factory) Run(ctx context.Context) {
+	if !f.cfg.Enabled || f.cfg.CheckInterval <= 0 {
+		return
+	}
+	f.Check(ctx)
+	ticker := time.NewTicker(f.cfg.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			f.Check(ctx)
+		}
+	}
+}
+
+// Check 通过代理请求 B 站首页，记录是否可用与耗时
+func (f *Factory) Check(ctx context.Context) Health {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	err := f.probe(ctx)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	wasOK := f.health.OK || f.health.CheckedAt.IsZero()
+	f.health.CheckedAt = time.Now()
+	f.health.Latency = time.Since(start)
+	f.health.OK = err == nil
+	f.health.Error = ""
+	if err != nil {
+		f.health.Error = err.Error()
+		if wasOK {
+			f.logger.Warn("代理不可用", zap.String("proxy", f.health.HTTP), zap.Error(err))
+		}
+	} else if !wasOK {
+		f.logger.Info("代理已恢复", zap.String("proxy", f.health.HTTP))
+	}
+	return f.health
+}
+
+func (f *Factory) probe(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, healthCheckURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := f.Client(0).Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	// 代理自身的错误通过 502/503/407 等状态码返回
+	if resp.StatusCode == http.StatusProxyAuthRequired || resp.StatusCode >= 500 {
+		return fmt.Errorf("状态码: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func validateProxy(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("无效的代理地址: %s", redact(raw))
+	}
+	if !proxySchemes[u.Scheme] {
+		return fmt.Errorf("不支持的代理协议: %s", u.Scheme)
+	}
+	if _, _, err := net.SplitHostPort(u.Host); err != nil {
+		return fmt.Errorf("代理地址缺少端口: %s", redact(raw))
+	}
+	return nil
+}
+
+// 隐藏代理地址中的密码
+func redact(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	}
+	return u.String()
+}
@@ -0,0 +1,101 @@
+package watcher
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/panedioic/bilibili-favlist-syncer/internal/apicache"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/asset"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/db"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/downloader"
+	"github.com/panedioic/bilibili-favlist-syncer/utils"
+	"go.uber.org/zap"
+)
+
+// Manager 管理所有收藏夹的监视器，关闭时统一停止并等待正在进行的同步结束
+type Manager struct {
+	mu      sync.Mutex
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	running map[int64]*Watcher
+
+	downloader     *downloader.Downloader
+	bilibiliClient *apicache.Client
+	interval       time.Duration
+	logger         utils.Logger
+	db             *db.DB
+	assets         *asset.Manager
+}
+
+func NewManager(downloader *downloader.Downloader, bilibiliClient *apicache.Client, interval time.Duration, logger utils.Logger, database *db.DB, assets *asset.Manager) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{
+		ctx:            ctx,
+		cancel:         cancel,
+		running:        make(map[int64]*Watcher),
+		downloader:     downloader,
+		bilibiliClient: bilibiliClient,
+		interval:       interval,
+		logger:         logger,
+		db:             database,
+		assets:         assets,
+	}
+}
+
+// Add 为收藏夹启动监视器。已在运行或管理器已停止时返回 false
+func (m *Manager) Add(favlistID int64) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.ctx.Err() != nil {
+		return false
+	}
+	if _, ok := m.running[favlistID]; ok {
+		return false
+	}
+	w := NewWatcher(m.downloader, m.bilibiliClient, int(favlistID), m.interval, m.logger, m.db, m.assets)
+	m.running[favlistID] = w
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		w.Start(m.ctx)
+	}()
+	return true
+}
+
+// SetInterval 调整所有监视器与之后添加的监视器的同步间隔
+func (m *Manager) SetInterval(interval time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if interval <= 0 || interval == m.interval {
+		return
+	}
+	m.interval = interval
+	for _, w := range m.running {
+		w.SetInterval(interval)
+	}
+	m.logger.Info("已调整收藏夹同步间隔", zap.Duration("interval", interval), zap.Int("watchers", len(m.running)))
+}
+
+// Stop 停止所有监视器并等待它们退出，ctx 结束时不再等待
+func (m *Manager) Stop(ctx context.Context) error {
+	m.mu.Lock()
+	m.cancel()
+	m.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		m.logger.Info("所有收藏夹监视器已停止")
+		return nil
+	case <-ctx.Done():
+		m.logger.Warn("等待收藏夹监视器停止超时", zap.Error(ctx.Err()))
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,106 @@
+package watcher
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/panedioic/bilibili-favlist-syncer/internal/asset"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/db"
+	"go.uber.org/zap"
+)
+
+// 失效视频在收藏夹中显示的标题
+const invalidVideoTitle = "已失效视频"
+
+// 收藏夹接口返回的、需要跟踪变化的视频元数据
+type upstreamMeta struct {
+	Title     string
+	CoverURL  string
+	Desc      string
+	Duration  int
+	PageCount int
+	Invalid   bool
+}
+
+// attr 最低位表示稿件已被删除（1：其他原因删除，9：UP主自己删除）
+func isInvalidMedia(attr int, title string) bool {
+	return attr&1 != 0 || title == invalidVideoTitle
+}
+
+// 对比上游元数据与数据库中的记录，记录发生变化的字段并更新数据库。
+// 视频失效后上游只返回占位信息，此时只标记失效，保留原有元数据
+func (fw *Watcher) syncVideoMetadata(ctx context.Context, old *db.Video, up upstreamMeta) {
+	now := time.Now()
+	updated := *old
+	updated.LastCheckedAt = now
+	var revisions []db.VideoRevision
+	record := func(field, oldValue, newValue string) {
+		revisions = append(revisions, db.VideoRevision{
+			BVID:      old.BVID,
+			Field:     field,
+			OldValue:  oldValue,
+			NewValue:  newValue,
+			ChangedAt: now,
+		})
+	}
+
+	if up.Invalid != old.IsInvalid {
+		record("is_invalid", strconv.FormatBool(old.IsInvalid), strconv.FormatBool(up.Invalid))
+		updated.IsInvalid = up.Invalid
+	}
+
+	if !up.Invalid {
+		if up.Title != old.Title {
+			record("title", old.Title, up.Title)
+			updated.Title = up.Title
+		}
+		if up.Desc != old.Desc {
+			record("desc", old.Desc, up.Desc)
+			updated.Desc = up.Desc
+		}
+		if up.Duration != old.Duration {
+			record("duration", strconv.Itoa(old.Duration), strconv.Itoa(up.Duration))
+			updated.Duration = up.Duration
+		}
+		if up.PageCount != old.PageCount {
+			record("page_count", strconv.Itoa(old.PageCount), strconv.Itoa(up.PageCount))
+			updated.PageCount = up.PageCount
+		}
+		if up.CoverURL != "" && up.CoverURL != old.CoverURL {
+			updated.CoverURL = up.CoverURL
+			// 早期记录没有保存远程地址，首次同步只补齐基线，不算作变更
+			if old.CoverURL != "" {
+				record("cover_url", old.CoverURL, up.CoverURL)
+				// 新封面另存一份，保留旧封面文件
+				if cover, err := fw.assets.Fetch(ctx, asset.KindCover, old.BVID, up.CoverURL); err != nil {
+					fw.logger.Warn("下载新封面失败", zap.String("bvid", old.BVID), zap.Error(err))
+				} else {
+					updated.Cover = cover
+					record("cover", old.Cover, updated.Cover)
+				}
+			}
+		}
+	}
+
+	if len(revisions) == 0 && updated.CoverURL == old.CoverURL {
+		if err := fw.db.TouchVideo(old.ID, now); err != nil {
+			fw.logger.Warn("更新视频检查时间失败", zap.String("bvid", old.BVID), zap.Error(err))
+		}
+		return
+	}
+
+	// 缓存的视频详情已过时，之后的下载与元数据写入重新请求
+	fw.bilibiliClient.Cache().InvalidateVideo(old.BVID)
+
+	if err := fw.db.UpdateVideoMetadata(&updated, revisions); err != nil {
+		fw.logger.Warn("更新视频元数据失败", zap.String("bvid", old.BVID), zap.Error(err))
+		return
+	}
+	for _, r := range revisions {
+		fw.logger.Info("检测到视频元数据变更",
+			zap.String("bvid", old.BVID),
+			zap.String("field", r.Field),
+		)
+	}
+}
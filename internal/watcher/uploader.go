@@ -0,0 +1,59 @@
+package watcher
+
+import (
+	"context"
+	"time"
+
+	"github.com/CuteReimu/bilibili/v2"
+	"go.uber.org/zap"
+)
+
+// UP 主名片信息的刷新间隔
+const uploaderProfileTTL = 24 * time.Hour
+
+// 同步 UP 主信息：更新昵称，头像变化时重新下载到本地，名片信息过期时重新拉取
+func (fw *Watcher) syncUploader(ctx context.Context, uid int64, name, faceURL string) {
+	if uid == 0 {
+		return
+	}
+	if _, done := fw.syncedUploaders[uid]; done {
+		return
+	}
+	fw.syncedUploaders[uid] = struct{}{}
+
+	old, _ := fw.db.GetUploader(uid)
+	if old != nil && (old.Name != name || old.FaceURL != faceURL) {
+		fw.bilibiliClient.Cache().InvalidateUploader(uid)
+	}
+	if err := fw.db.UpsertUploader(uid, name, faceURL); err != nil {
+		fw.logger.Warn("写入UP主信息失败", zap.Int64("uid", uid), zap.Error(err))
+		return
+	}
+
+	if faceURL != "" && (old == nil || old.Face == "" || old.FaceURL != faceURL) {
+		if _, err := fw.assets.FetchFace(ctx, uid, faceURL); err != nil {
+			fw.logger.Warn("下载UP主头像失败", zap.Int64("uid", uid), zap.Error(err))
+		}
+	}
+
+	if old != nil && time.Since(old.ProfileSynced) < uploaderProfileTTL {
+		return
+	}
+	card, err := fw.bilibiliClient.GetUserCard(bilibili.GetUserCardParam{Mid: int(uid)})
+	if err != nil {
+		// 名片信息只是附加数据，失败时保留旧值
+		fw.logger.Warn("获取UP主名片失败", zap.Int64("uid", uid), zap.Error(err))
+		return
+	}
+	old, err = fw.db.GetUploader(uid)
+	if err != nil {
+		return
+	}
+	old.Sign = card.Card.Sign
+	old.Fans = card.Follower
+	old.Attention = card.Card.Attention
+	old.ArchiveCount = card.ArchiveCount
+	if err := fw.db.UpdateUploaderProfile(old); err != nil {
+		fw.logger.Warn("更新UP主名片失败", zap.Int64("uid", uid), zap.Error(err))
+	}
+}
@@ -3,13 +3,11 @@ package watcher
 import (
 	"context"
 	"fmt"
-	"io"
-	"net/http"
-	"os"
-	"path/filepath"
 	"time"
 
 	"github.com/CuteReimu/bilibili/v2"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/apicache"
+	"github.com/panedioic/bilibili-favlist-syncer/internal/asset"
 	"github.com/panedioic/bilibili-favlist-syncer/internal/db"
 	"github.com/panedioic/bilibili-favlist-syncer/internal/downloader"
 	"github.com/panedioic/bilibili-favlist-syncer/utils"
@@ -18,15 +16,20 @@ import (
 
 type Watcher struct {
 	downloader     *downloader.Downloader
-	bilibiliClient *bilibili.Client
+	bilibiliClient *apicache.Client
 	favlistID      int
 	interval       time.Duration
 	logger         utils.Logger
 	knownVideos    map[string]struct{}
 	db             *db.DB // 新增
+	assets         *asset.Manager
+	// 本轮同步中已处理过的UP主，避免同一UP主的多个视频重复请求
+	syncedUploaders map[int64]struct{}
+	// 运行中调整同步间隔
+	reschedule chan time.Duration
 }
 
-func NewWatcher(downloader *downloader.Downloader, bilibiliClient *bilibili.Client, favlistID int, interval time.Duration, logger utils.Logger, database *db.DB) *Watcher {
+func NewWatcher(downloader *downloader.Downloader, bilibiliClient *apicache.Client, favlistID int, interval time.Duration, logger utils.Logger, database *db.DB, assets *asset.Manager) *Watcher {
 	return &Watcher{
 		downloader:     downloader,
 		bilibiliClient: bilibiliClient,
@@ -35,6 +38,8 @@ func NewWatcher(downloader *downloader.Downloader, bilibiliClient *bilibili.Clie
 		logger:         logger,
 		knownVideos:    make(map[string]struct{}),
 		db:             database, // 新增
+		assets:         assets,
+		reschedule:     make(chan time.Duration, 1),
 	}
 }
 
@@ -49,11 +54,29 @@ func (fw *Watcher) Start(ctx context.Context) {
 			return
 		case <-ticker.C:
 			fw.checkForNewVideos(ctx)
+		case interval := <-fw.reschedule:
+			fw.interval = interval
+			ticker.Reset(interval)
 		}
 	}
 }
 
-func (fw *Watcher) checkForNewVideos(_ context.Context) {
+// SetInterval 调整同步间隔，从下一次同步开始生效。只保留最后一次调整
+func (fw *Watcher) SetInterval(interval time.Duration) {
+	for {
+		select {
+		case fw.reschedule <- interval:
+			return
+		default:
+		}
+		select {
+		case <-fw.reschedule:
+		default:
+		}
+	}
+}
+
+func (fw *Watcher) checkForNewVideos(ctx context.Context) {
 	favList, err := fw.bilibiliClient.GetFavourList(bilibili.GetFavourListParam{
 		MediaId: fw.favlistID,
 		Ps:      20,
@@ -64,17 +87,21 @@ func (fw *Watcher) checkForNewVideos(_ context.Context) {
 		return
 	}
 
-	videoNum := favList.Info.MediaCount
-	if videoNum == 0 {
-		return
+	// 同步收藏夹标题与封面，封面变化后由资源补齐任务重新下载
+	if err := fw.db.UpdateFavlistInfo(int64(fw.favlistID), favList.Info.Title, favList.Info.Cover); err != nil {
+		fw.logger.Warn("更新收藏夹信息失败", zap.Int("favlist_id", fw.favlistID), zap.Error(err))
 	}
 
+	videoNum := favList.Info.MediaCount
+
 	pageSize := 20
 	totalPages := (videoNum + pageSize - 1) / pageSize
 
 	// debug
 	// totalPages = 1
 
+	fw.syncedUploaders = make(map[int64]struct{})
+
 	// 获取当前所有活跃任务（下载中/等待中）
 	activeTasks := fw.downloader.ListActiveTasks()
 	activeBVIDs := make(map[string]struct{})
@@ -82,8 +109,21 @@ func (fw *Watcher) checkForNewVideos(_ context.Context) {
 		activeBVIDs[t.BVID] = struct{}{}
 	}
 
+	// 视频在本收藏夹中的状态，只有完整获取了所有分页，才能据此判断哪些视频已被移出收藏夹
+	favlistID := int64(fw.favlistID)
+	states, err := fw.db.ListFavlistVideoStates(favlistID)
+	if err != nil {
+		fw.logger.Warn("查询收藏夹视频失败", zap.Int("favlist_id", fw.favlistID), zap.Error(err))
+		return
+	}
+	seen := make(map[string]struct{}, videoNum)
+	complete := true
+
 	for page := 1; page <= totalPages; page++ {
-		time.Sleep(1 * time.Second) // 避免请求过快
+		// 请求速率由客户端共享的限流器控制，关闭时放弃本轮同步
+		if ctx.Err() != nil {
+			return
+		}
 		fl, err := fw.bilibiliClient.GetFavourList(bilibili.GetFavourListParam{
 			MediaId: fw.favlistID,
 			Ps:      pageSize,
@@ -91,11 +131,26 @@ func (fw *Watcher) checkForNewVideos(_ context.Context) {
 		})
 		if err != nil {
 			fw.logger.Warn("获取收藏夹分页失败", zap.Int("page", page), zap.Error(err))
+			complete = false
 			continue
 		}
 		videos := fl.Medias
 		for _, media := range videos {
 			bvid := media.Bvid
+			seen[bvid] = struct{}{}
+			fw.syncUploader(ctx, int64(media.Upper.Mid), media.Upper.Name, media.Upper.Face)
+
+			invalid := isInvalidMedia(media.Attr, media.Title)
+
+			// 新加入或重新加入本收藏夹，先更新对应关系，被清理后重新加入的视频随之恢复下载
+			if removed, ok := states[bvid]; !ok || removed {
+				if ok {
+					fw.logger.Info("视频重新加入收藏夹", zap.String("bvid", bvid), zap.Int("favlist_id", fw.favlistID))
+				}
+				if err := fw.db.SetVideoRemoved(favlistID, bvid, false); err != nil {
+					fw.logger.Warn("更新视频移除状态失败", zap.String("bvid", bvid), zap.Error(err))
+				}
+			}
 
 			videoInDB, err := fw.db.GetVideoByBVID(bvid)
 			if err != nil || videoInDB == nil {
@@ -103,31 +158,14 @@ func (fw *Watcher) checkForNewVideos(_ context.Context) {
 				fw.logger.Info("发现新视频，添加下载任务", zap.String("bvid", bvid))
 				fw.downloader.AddTask(bvid, media.Title)
 
-				// 下载封面到本地
-				coverUrl := media.Cover
-				coverPath := filepath.Join("downloads", "covers", bvid+".jpg")
-				localCoverPath := ""
-				if err := os.MkdirAll(filepath.Dir(coverPath), 0755); err == nil {
-					resp, err := http.Get(coverUrl)
-					if err == nil && resp.StatusCode == 200 {
-						defer resp.Body.Close()
-						out, err := os.Create(coverPath)
-						if err == nil {
-							_, err = io.Copy(out, resp.Body)
-							out.Close()
-							if err == nil {
-								localCoverPath = "/" + coverPath // 供前端访问
-							}
-						}
-					}
-				}
-
-				// 插入数据库，封面只写入本地地址
+				// 插入数据库，封面下载成功后再写入本地地址
 				v := &db.Video{
 					BVID:          bvid,
 					Title:         media.Title,
-					Cover:         localCoverPath,
+					CoverURL:      media.Cover,
 					CreatedAt:     time.Unix(int64(media.Ctime), 0),
+					Pubdate:       time.Unix(int64(media.Pubtime), 0),
+					FavTime:       time.Unix(int64(media.FavTime), 0),
 					Duration:      int(media.Duration),
 					PageCount:     int(media.Page),
 					Desc:          media.Intro,
@@ -135,15 +173,30 @@ func (fw *Watcher) checkForNewVideos(_ context.Context) {
 					UploaderUID:   int64(media.Upper.Mid),
 					UploaderFace:  media.Upper.Face,
 					LastCheckedAt: time.Now(),
-					FavlistID:     int64(fw.favlistID),
+					FavlistID:     favlistID,
 					IsDownloaded:  false,
-					IsInvalid:     false,
+					IsInvalid:     invalid,
 					IsRemoved:     false,
 				}
-				_ = fw.db.InsertVideo(v)
+				if err := fw.db.InsertVideo(v); err != nil {
+					fw.logger.Warn("写入视频失败", zap.String("bvid", bvid), zap.Error(err))
+				} else if _, err := fw.assets.FetchCover(ctx, bvid, media.Cover); err != nil {
+					// 失败的封面由资源补齐任务稍后重试
+					fw.logger.Warn("下载封面失败", zap.String("bvid", bvid), zap.Error(err))
+				}
 			} else {
-				// 已存在于数据库，但未下载且不在活跃任务列表中，则重新添加下载任务
-				if !videoInDB.IsDownloaded {
+				fw.syncVideoMetadata(ctx, videoInDB, upstreamMeta{
+					Title:     media.Title,
+					CoverURL:  media.Cover,
+					Desc:      media.Intro,
+					Duration:  int(media.Duration),
+					PageCount: int(media.Page),
+					Invalid:   invalid,
+				})
+
+				// 已存在于数据库，但未下载且不在活跃任务列表中，则重新添加下载任务。
+				// 被清理规则删除的视频不再下载
+				if !videoInDB.IsDownloaded && videoInDB.DeletedAt.IsZero() {
 					if _, exists := activeBVIDs[bvid]; !exists {
 						fw.logger.Info("未下载视频重新加入下载队列", zap.String("bvid", bvid))
 						fw.downloader.AddTask(bvid, videoInDB.Title)
@@ -152,4 +205,21 @@ func (fw *Watcher) checkForNewVideos(_ context.Context) {
 			}
 		}
 	}
+
+	if complete {
+		fw.syncRemoved(states, seen)
+	}
+}
+
+// 标记已移出本收藏夹的视频。视频仍在其他收藏夹中时不会被标记为已移除
+func (fw *Watcher) syncRemoved(states map[string]bool, seen map[string]struct{}) {
+	for bvid, removed := range states {
+		if _, present := seen[bvid]; present || removed {
+			continue
+		}
+		fw.logger.Info("视频已移出收藏夹", zap.String("bvid", bvid), zap.Int("favlist_id", fw.favlistID))
+		if err := fw.db.SetVideoRemoved(int64(fw.favlistID), bvid, true); err != nil {
+			fw.logger.Warn("更新视频移除状态失败", zap.String("bvid", bvid), zap.Error(err))
+		}
+	}
 }
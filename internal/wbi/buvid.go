@@ -0,0 +1,131 @@
+package wbi
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 获取 buvid3/buvid4 的接口
+const spiURL = "https://api.bilibili.com/x/frontend/finger/spi"
+
+// Device 管理 buvid3/buvid4 设备 Cookie。未配置时首次使用前从接口获取，
+// 获取失败时在本地生成 buvid3，之后按 retryInterval 重新尝试获取
+type Device struct {
+	client    *http.Client
+	userAgent string
+	spiURL    string
+	now       func() time.Time
+
+	mu        sync.Mutex
+	buvid3    string
+	buvid4    string
+	fetched   bool // 已从接口获取或由配置提供
+	generated bool // buvid3 为本地生成，获取成功后替换
+	failedAt  time.Time
+	fetching  chan struct{} // 正在获取设备标识时非空，获取结束后关闭
+}
+
+func NewDevice(client *http.Client, userAgent, buvid3, buvid4 string) *Device {
+	return &Device{
+		client:    client,
+		userAgent: userAgent,
+		spiURL:    spiURL,
+		now:       time.Now,
+		buvid3:    buvid3,
+		buvid4:    buvid4,
+		fetched:   buvid3 != "" && buvid4 != "",
+	}
+}
+
+// Cookies 返回设备 Cookie，至少包含 buvid3。请求在锁外发出，同时只有一个获取请求；
+// 获取期间已有 buvid3 的调用直接使用，没有时等待获取结果
+func (d *Device) Cookies(ctx context.Context) []*http.Cookie {
+	d.mu.Lock()
+	for d.fetching != nil && d.buvid3 == "" && ctx.Err() == nil {
+		fetching := d.fetching
+		d.mu.Unlock()
+		select {
+		case <-fetching:
+		case <-ctx.Done():
+		}
+		d.mu.Lock()
+	}
+	if !d.fetched && d.fetching == nil && d.now().Sub(d.failedAt) >= retryInterval {
+		fetching := make(chan struct{})
+		d.fetching = fetching
+		d.mu.Unlock()
+
+		b3, b4, err := d.fetch(ctx)
+
+		d.mu.Lock()
+		d.fetching = nil
+		close(fetching)
+		if err == nil {
+			// 已配置的值优先
+			if d.buvid3 == "" || d.generated {
+				d.buvid3, d.generated = b3, false
+			}
+			if d.buvid4 == "" {
+				d.buvid4 = b4
+			}
+			d.fetched = true
+		} else if ctx.Err() == nil {
+			d.failedAt = d.now()
+		}
+	}
+	defer d.mu.Unlock()
+	if d.buvid3 == "" {
+		d.buvid3, d.generated = generateBuvid3(d.now()), true
+	}
+
+	cookies := []*http.Cookie{{Name: "buvid3", Value: d.buvid3}}
+	if d.buvid4 != "" {
+		cookies = append(cookies, &http.Cookie{Name: "buvid4", Value: d.buvid4})
+	}
+	return cookies
+}
+
+func (d *Device) fetch(ctx context.Context) (string, string, error) {
+	req, err := newRequest(ctx, d.spiURL, d.userAgent)
+	if err != nil {
+		return "", "", err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("获取设备标识失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("获取设备标识失败，状态码: %d", resp.StatusCode)
+	}
+
+	var spi struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Data    struct {
+			B3 string `json:"b_3"`
+			B4 string `json:"b_4"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&spi); err != nil {
+		return "", "", fmt.Errorf("解析设备标识失败: %w", err)
+	}
+	if spi.Code != 0 || spi.Data.B3 == "" {
+		return "", "", fmt.Errorf("获取设备标识失败, 错误码: %d, 错误信息: %s", spi.Code, spi.Message)
+	}
+	return spi.Data.B3, spi.Data.B4, nil
+}
+
+// 按网页端的格式生成 buvid3：大写 UUID + 5 位数字 + "infoc"
+func generateBuvid3(now time.Time) string {
+	var b [16]byte
+	rand.Read(b[:])
+	id := fmt.Sprintf("%X-%X-%X-%X-%X", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+	return strings.ToUpper(id) + fmt.Sprintf("%05d", now.UnixMilli()%100000) + "infoc"
+}
@@ -0,0 +1,70 @@
+package wbi
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/panedioic/bilibili-favlist-syncer/utils"
+	"go.uber.org/zap"
+)
+
+// 签名只用于该域名下的接口
+const apiHost = "api.bilibili.com"
+
+// 获取密钥与设备标识的接口本身不签名
+var unsignedPaths = map[string]bool{
+	"/x/web-interface/nav":   true,
+	"/x/frontend/finger/spi": true,
+}
+
+// Transport 为发往 B 站的请求补充设备 Cookie，并为 api.bilibili.com 的 GET 请求签名。
+// 已带签名的请求会用当前密钥重新签名
+type Transport struct {
+	next   http.RoundTripper
+	signer *Signer
+	device *Device
+	logger utils.Logger
+}
+
+func NewTransport(next http.RoundTripper, signer *Signer, device *Device, logger utils.Logger) *Transport {
+	return &Transport{next: next, signer: signer, device: device, logger: logger}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !isBilibili(req.URL.Hostname()) {
+		return t.next.RoundTrip(req)
+	}
+	ctx := req.Context()
+	req = req.Clone(ctx)
+
+	if t.device != nil {
+		for _, c := range t.device.Cookies(ctx) {
+			if _, err := req.Cookie(c.Name); err != nil {
+				req.AddCookie(c)
+			}
+		}
+	}
+
+	if t.signer != nil && req.Method == http.MethodGet && req.URL.Hostname() == apiHost && !unsignedPaths[req.URL.Path] {
+		signed, err := t.signer.Sign(ctx, req.URL.Query())
+		if err != nil {
+			// 拿不到密钥时仍发出未签名的请求，不需要签名的接口不受影响。
+			// 同一次获取失败只记录一次
+			if !errors.Is(err, errRetryLater) {
+				t.logger.Warn("WBI 签名失败", zap.String("path", req.URL.Path), zap.Error(err))
+			}
+		} else {
+			req.URL.RawQuery = Encode(signed)
+		}
+		// WBI 接口带 Referer 时会校验失败
+		if strings.Contains(req.URL.Path, "/wbi/") {
+			req.Header.Del("Referer")
+		}
+	}
+	return t.next.RoundTrip(req)
+}
+
+func isBilibili(host string) bool {
+	return host == "bilibili.com" || strings.HasSuffix(host, ".bilibili.com")
+}
@@ -0,0 +1,176 @@
+package wbi
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/panedioic/bilibili-favlist-syncer/utils"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// 记录发出的请求，返回空的成功响应
+func recordRequests(got **http.Request) http.RoundTripper {
+	return roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		*got = req
+		return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(`{"code":0}`)), Request: req}, nil
+	})
+}
+
+func newTestDevice(t *testing.T, status int) (*Device, *atomic.Int32) {
+	t.Helper()
+	body, err := os.ReadFile("testdata/spi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(status)
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	d := NewDevice(srv.Client(), "test-agent", "", "")
+	d.spiURL = srv.URL
+	d.now = func() time.Time { return fixtureTime }
+	return d, &hits
+}
+
+func TestTransportSignsAPIRequests(t *testing.T) {
+	signer := NewSigner(http.DefaultClient, "")
+	signer.now = func() time.Time { return fixtureTime }
+	signer.SetKeys(fixtureImgKey, fixtureSubKey)
+	device, _ := newTestDevice(t, http.StatusOK)
+
+	var got *http.Request
+	tr := NewTransport(recordRequests(&got), signer, device, utils.NewLogger("error"))
+
+	req, _ := http.NewRequest(http.MethodGet, "https://api.bilibili.com/x/player/wbi/playurl?foo=114&bar=514&zab=1919810", nil)
+	req.Header.Set("Referer", "https://www.bilibili.com/")
+	if _, err := tr.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	if want := "bar=514&foo=114&w_rid=8f6f2b5b3d485fe1886cec6a0be8c5d4&wts=1702204169&zab=1919810"; got.URL.RawQuery != want {
+		t.Errorf("query = %s, want %s", got.URL.RawQuery, want)
+	}
+	if got.Header.Get("Referer") != "" {
+		t.Error("WBI 接口不应带 Referer")
+	}
+	if c, err := got.Cookie("buvid3"); err != nil || c.Value != "B5A5F0E1-5C5D-3A0C-7D9A-2D7B3C7F2E1A34512infoc" {
+		t.Errorf("buvid3 = %v, %v", c, err)
+	}
+	if _, err := got.Cookie("buvid4"); err != nil {
+		t.Error("缺少 buvid4")
+	}
+	// 原请求不被修改
+	if req.URL.RawQuery != "foo=114&bar=514&zab=1919810" || req.Header.Get("Cookie") != "" {
+		t.Error("原请求被修改")
+	}
+}
+
+func TestTransportSkipsOtherRequests(t *testing.T) {
+	signer := NewSigner(http.DefaultClient, "")
+	signer.SetKeys(fixtureImgKey, fixtureSubKey)
+	device := NewDevice(http.DefaultClient, "", "configured-b3", "configured-b4")
+
+	var got *http.Request
+	tr := NewTransport(recordRequests(&got), signer, device, utils.NewLogger("error"))
+
+	tests := []struct {
+		url     string
+		method  string
+		cookies bool
+	}{
+		{"https://i0.hdslb.com/bfs/archive/cover.jpg?x=1", http.MethodGet, false},
+		{"https://comment.bilibili.com/1.xml?x=1", http.MethodGet, true},
+		{"https://api.bilibili.com/x/web-interface/nav?x=1", http.MethodGet, true},
+		{"https://api.bilibili.com/x/v3/fav/folder/add?x=1", http.MethodPost, true},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, tt.url, nil)
+		if _, err := tr.RoundTrip(req); err != nil {
+			t.Fatal(err)
+		}
+		if got.URL.RawQuery != "x=1" {
+			t.Errorf("%s %s: query = %s", tt.method, tt.url, got.URL.RawQuery)
+		}
+		c, err := got.Cookie("buvid3")
+		if tt.cookies && (err != nil || c.Value != "configured-b3") {
+			t.Errorf("%s: buvid3 = %v, %v", tt.url, c, err)
+		}
+		if !tt.cookies && err == nil {
+			t.Errorf("%s: 不应带 buvid3", tt.url)
+		}
+	}
+}
+
+func TestTransportKeepsExistingCookies(t *testing.T) {
+	device := NewDevice(http.DefaultClient, "", "configured-b3", "configured-b4")
+	var got *http.Request
+	tr := NewTransport(recordRequests(&got), nil, device, utils.NewLogger("error"))
+
+	req, _ := http.NewRequest(http.MethodGet, "https://api.bilibili.com/x/web-interface/card", nil)
+	req.AddCookie(&http.Cookie{Name: "buvid3", Value: "from-request"})
+	if _, err := tr.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	cookies := got.Cookies()
+	var b3 []string
+	for _, c := range cookies {
+		if c.Name == "buvid3" {
+			b3 = append(b3, c.Value)
+		}
+	}
+	if len(b3) != 1 || b3[0] != "from-request" {
+		t.Errorf("buvid3 = %v", b3)
+	}
+}
+
+func TestDeviceFallsBackToGeneratedBuvid(t *testing.T) {
+	d, hits := newTestDevice(t, http.StatusInternalServerError)
+
+	cookies := d.Cookies(context.Background())
+	if len(cookies) != 1 || !strings.HasSuffix(cookies[0].Value, "infoc") || len(cookies[0].Value) != 46 {
+		t.Fatalf("cookies = %v", cookies)
+	}
+	generated := cookies[0].Value
+	// 重试间隔内使用同一个生成的标识
+	if again := d.Cookies(context.Background()); again[0].Value != generated || hits.Load() != 1 {
+		t.Errorf("buvid3 = %s, hits = %d", again[0].Value, hits.Load())
+	}
+}
+
+func TestDeviceConcurrentFetch(t *testing.T) {
+	srv, hits, release := newBlockingServer(t, "testdata/spi.json")
+	d := NewDevice(srv.Client(), "test-agent", "", "")
+	d.spiURL = srv.URL
+	d.now = func() time.Time { return fixtureTime }
+
+	results := make(chan string, 5)
+	for range 5 {
+		go func() { results <- d.Cookies(context.Background())[0].Value }()
+	}
+	waitHits(t, hits, 1)
+	close(release)
+
+	// 等待中的调用都使用接口返回的标识，而不是本地生成
+	for range 5 {
+		if got := <-results; got != "B5A5F0E1-5C5D-3A0C-7D9A-2D7B3C7F2E1A34512infoc" {
+			t.Errorf("buvid3 = %s", got)
+		}
+	}
+	if hits.Load() != 1 {
+		t.Errorf("hits = %d, want 1", hits.Load())
+	}
+}
@@ -0,0 +1,263 @@
+// Package wbi 为 B 站接口请求添加 WBI 签名（w_rid/wts）与 buvid 设备 Cookie，
+// 未签名或缺少设备标识的请求容易被风控拦截（-352）
+package wbi
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 获取 img_key/sub_key 的接口，未登录时 code 为 -101 但仍返回密钥
+const navURL = "https://api.bilibili.com/x/web-interface/nav"
+
+const (
+	keyTTL        = time.Hour   // 密钥每天轮换，缓存超过该时间后重新获取
+	retryInterval = time.Minute // 获取失败后的重试间隔，期间不再请求
+)
+
+// 上次获取密钥失败后尚未到重试时间
+var errRetryLater = errors.New("WBI 密钥暂不可用")
+
+// 由 img_key+sub_key 打乱生成混合密钥的下标表
+var mixinKeyEncTab = []int{
+	46, 47, 18, 2, 53, 8, 23, 32, 15, 50, 10, 31, 58, 3, 45, 35, 27, 43, 5, 49,
+	33, 9, 42, 19, 29, 28, 14, 39, 12, 38, 41, 13, 37, 48, 7, 16, 24, 55, 40,
+	61, 26, 17, 0, 1, 60, 51, 30, 4, 22, 25, 54, 21, 56, 59, 6, 63, 57, 62, 11,
+	36, 20, 34, 44, 52,
+}
+
+// Signer 缓存 WBI 密钥并为查询参数签名
+type Signer struct {
+	client    *http.Client
+	userAgent string
+	navURL    string
+	now       func() time.Time
+
+	mu        sync.Mutex
+	imgKey    string
+	subKey    string
+	fetchedAt time.Time
+	failedAt  time.Time
+	lastErr   error
+	fetching  chan struct{} // 正在获取密钥时非空，获取结束后关闭
+}
+
+func NewSigner(client *http.Client, userAgent string) *Signer {
+	return &Signer{client: client, userAgent: userAgent, navURL: navURL, now: time.Now}
+}
+
+// SetKeys 直接设置密钥，之后 keyTTL 内不再请求
+func (s *Signer) SetKeys(imgKey, subKey string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.imgKey, s.subKey, s.fetchedAt = imgKey, subKey, s.now()
+}
+
+// Invalidate 丢弃缓存的密钥，下次签名时重新获取
+func (s *Signer) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fetchedAt = time.Time{}
+	s.lastErr = nil
+}
+
+// Keys 返回缓存的密钥，过期时重新获取。请求在锁外发出，同时只有一个获取请求；
+// 获取期间有旧密钥的调用直接使用旧密钥，没有密钥的调用等待获取结果
+func (s *Signer) Keys(ctx context.Context) (string, string, error) {
+	s.mu.Lock()
+	for s.fetching != nil && s.imgKey == "" {
+		fetching := s.fetching
+		s.mu.Unlock()
+		select {
+		case <-fetching:
+		case <-ctx.Done():
+			return "", "", ctx.Err()
+		}
+		s.mu.Lock()
+	}
+	now := s.now()
+	if s.imgKey != "" && (now.Sub(s.fetchedAt) < keyTTL || s.fetching != nil) {
+		defer s.mu.Unlock()
+		return s.imgKey, s.subKey, nil
+	}
+	if s.lastErr != nil && now.Sub(s.failedAt) < retryInterval {
+		defer s.mu.Unlock()
+		return s.fallback(fmt.Errorf("%w: %v", errRetryLater, s.lastErr))
+	}
+	fetching := make(chan struct{})
+	s.fetching = fetching
+	s.mu.Unlock()
+
+	imgKey, subKey, err := s.fetch(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fetching = nil
+	close(fetching)
+	if err != nil {
+		// 调用方取消不是接口的问题，不影响其他调用重新获取
+		if ctx.Err() == nil {
+			s.failedAt, s.lastErr = s.now(), err
+		}
+		return s.fallback(err)
+	}
+	s.imgKey, s.subKey, s.fetchedAt, s.lastErr = imgKey, subKey, s.now(), nil
+	return imgKey, subKey, nil
+}
+
+// 获取失败但有旧密钥时继续使用旧密钥
+func (s *Signer) fallback(err error) (string, string, error) {
+	if s.imgKey != "" {
+		return s.imgKey, s.subKey, nil
+	}
+	return "", "", err
+}
+
+func (s *Signer) fetch(ctx context.Context) (string, string, error) {
+	req, err := newRequest(ctx, s.navURL, s.userAgent)
+	if err != nil {
+		return "", "", err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("获取 WBI 密钥失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("获取 WBI 密钥失败，状态码: %d", resp.StatusCode)
+	}
+
+	var nav struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Data    struct {
+			WbiImg struct {
+				ImgURL string `json:"img_url"`
+				SubURL string `json:"sub_url"`
+			} `json:"wbi_img"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&nav); err != nil {
+		return "", "", fmt.Errorf("解析 WBI 密钥失败: %w", err)
+	}
+	imgKey := keyFromURL(nav.Data.WbiImg.ImgURL)
+	subKey := keyFromURL(nav.Data.WbiImg.SubURL)
+	if imgKey == "" || subKey == "" {
+		return "", "", fmt.Errorf("获取 WBI 密钥失败, 错误码: %d, 错误信息: %s", nav.Code, nav.Message)
+	}
+	return imgKey, subKey, nil
+}
+
+func newRequest(ctx context.Context, url, userAgent string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if userAgent != "" {
+		req.Header.Set("User-Agent", userAgent)
+	}
+	req.Header.Set("Referer", "https://www.bilibili.com/")
+	return req, nil
+}
+
+// 密钥为图片地址的文件名（不含扩展名）
+func keyFromURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	name := path.Base(u.Path)
+	if name == "." || name == "/" {
+		return ""
+	}
+	return strings.TrimSuffix(name, path.Ext(name))
+}
+
+// Sign 为查询参数签名，返回带 wts 与 w_rid 的新参数，原有的签名会被替换
+func (s *Signer) Sign(ctx context.Context, query url.Values) (url.Values, error) {
+	imgKey, subKey, err := s.Keys(ctx)
+	if err != nil {
+		return query, err
+	}
+	return Sign(query, MixinKey(imgKey, subKey), s.now()), nil
+}
+
+// MixinKey 按下标表打乱 img_key+sub_key，取前 32 位
+func MixinKey(imgKey, subKey string) string {
+	orig := imgKey + subKey
+	var b strings.Builder
+	for _, i := range mixinKeyEncTab {
+		if i < len(orig) {
+			b.WriteByte(orig[i])
+		}
+	}
+	key := b.String()
+	if len(key) > 32 {
+		key = key[:32]
+	}
+	return key
+}
+
+// Sign 使用混合密钥签名：加入 wts，去掉值中的 !'()* 后按键排序编码，
+// w_rid 为编码结果拼接混合密钥的 md5
+func Sign(query url.Values, mixinKey string, ts time.Time) url.Values {
+	signed := make(url.Values, len(query)+2)
+	for k, vs := range query {
+		if k == "w_rid" || k == "wts" || len(vs) == 0 {
+			continue
+		}
+		signed.Set(k, sanitize(vs[0]))
+	}
+	signed.Set("wts", strconv.FormatInt(ts.Unix(), 10))
+
+	sum := md5.Sum([]byte(Encode(signed) + mixinKey))
+	signed.Set("w_rid", hex.EncodeToString(sum[:]))
+	return signed
+}
+
+// Encode 按键排序编码查询参数，空格编码为 %20，与网页端的 encodeURIComponent 一致
+func Encode(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		for _, v := range query[k] {
+			if b.Len() > 0 {
+				b.WriteByte('&')
+			}
+			b.WriteString(escape(k))
+			b.WriteByte('=')
+			b.WriteString(escape(v))
+		}
+	}
+	return b.String()
+}
+
+func escape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune("!'()*", r) {
+			return -1
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,260 @@
+package wbi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 以下密钥与签名结果取自 nav 接口的录制响应（testdata/nav.json）与公开的签名示例
+const (
+	fixtureImgKey   = "7cd084941338484aae1ad9425b84077c"
+	fixtureSubKey   = "4932caff0ff746eab6f01bf08b70ac45"
+	fixtureMixinKey = "ea1db124af3c7062474693fa704f4ff8"
+)
+
+var fixtureTime = time.Unix(1702204169, 0)
+
+func TestMixinKey(t *testing.T) {
+	if got := MixinKey(fixtureImgKey, fixtureSubKey); got != fixtureMixinKey {
+		t.Fatalf("MixinKey = %q, want %q", got, fixtureMixinKey)
+	}
+}
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		name  string
+		query url.Values
+		want  string
+	}{
+		{
+			name:  "示例参数",
+			query: url.Values{"foo": {"114"}, "bar": {"514"}, "zab": {"1919810"}},
+			want:  "bar=514&foo=114&wts=1702204169&zab=1919810&w_rid=8f6f2b5b3d485fe1886cec6a0be8c5d4",
+		},
+		{
+			name:  "去除特殊字符并将空格编码为%20",
+			query: url.Values{"mid": {"2"}, "keyword": {"中文 test!(x)"}},
+			want:  "keyword=%E4%B8%AD%E6%96%87%20testx&mid=2&wts=1702204169&w_rid=8debc93b8d4aae72399b13b546d599a5",
+		},
+		{
+			name:  "替换已有签名",
+			query: url.Values{"foo": {"114"}, "bar": {"514"}, "zab": {"1919810"}, "wts": {"1"}, "w_rid": {"stale"}},
+			want:  "bar=514&foo=114&wts=1702204169&zab=1919810&w_rid=8f6f2b5b3d485fe1886cec6a0be8c5d4",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signed := Sign(tt.query, fixtureMixinKey, fixtureTime)
+			want, err := url.ParseQuery(tt.want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if Encode(signed) != Encode(want) {
+				t.Errorf("Sign = %s, want %s", Encode(signed), Encode(want))
+			}
+		})
+	}
+}
+
+func TestKeyFromURL(t *testing.T) {
+	tests := map[string]string{
+		"https://i0.hdslb.com/bfs/wbi/7cd084941338484aae1ad9425b84077c.png": fixtureImgKey,
+		"https://i0.hdslb.com/bfs/wbi/4932caff0ff746eab6f01bf08b70ac45":     fixtureSubKey,
+		"": "",
+	}
+	for raw, want := range tests {
+		if got := keyFromURL(raw); got != want {
+			t.Errorf("keyFromURL(%q) = %q, want %q", raw, got, want)
+		}
+	}
+}
+
+// 返回录制的 nav 响应并统计请求次数
+func newNavServer(t *testing.T, status int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	body, err := os.ReadFile("testdata/nav.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+func newTestSigner(srv *httptest.Server, now *time.Time) *Signer {
+	s := NewSigner(srv.Client(), "test-agent")
+	s.navURL = srv.URL
+	s.now = func() time.Time { return *now }
+	return s
+}
+
+func TestSignerFetchesAndCachesKeys(t *testing.T) {
+	srv, hits := newNavServer(t, http.StatusOK)
+	now := fixtureTime
+	s := newTestSigner(srv, &now)
+
+	signed, err := s.Sign(context.Background(), url.Values{"foo": {"114"}, "bar": {"514"}, "zab": {"1919810"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := signed.Get("w_rid"); got != "8f6f2b5b3d485fe1886cec6a0be8c5d4" {
+		t.Errorf("w_rid = %s", got)
+	}
+
+	// 缓存有效期内不再请求
+	now = now.Add(keyTTL - time.Second)
+	if _, _, err := s.Keys(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if hits.Load() != 1 {
+		t.Errorf("hits = %d, want 1", hits.Load())
+	}
+
+	// 过期后重新获取
+	now = now.Add(2 * time.Second)
+	if _, _, err := s.Keys(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if hits.Load() != 2 {
+		t.Errorf("hits = %d, want 2", hits.Load())
+	}
+
+	s.Invalidate()
+	if _, _, err := s.Keys(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if hits.Load() != 3 {
+		t.Errorf("hits = %d, want 3", hits.Load())
+	}
+}
+
+func TestSignerFetchFailure(t *testing.T) {
+	srv, hits := newNavServer(t, http.StatusInternalServerError)
+	now := fixtureTime
+	s := newTestSigner(srv, &now)
+
+	if _, _, err := s.Keys(context.Background()); err == nil {
+		t.Fatal("expected error")
+	}
+	// 重试间隔内不再请求
+	if _, _, err := s.Keys(context.Background()); err == nil {
+		t.Fatal("expected error")
+	}
+	if hits.Load() != 1 {
+		t.Errorf("hits = %d, want 1", hits.Load())
+	}
+
+	// 有旧密钥时获取失败继续使用旧密钥
+	s.SetKeys(fixtureImgKey, fixtureSubKey)
+	now = now.Add(keyTTL + retryInterval)
+	img, sub, err := s.Keys(context.Background())
+	if err != nil || img != fixtureImgKey || sub != fixtureSubKey {
+		t.Errorf("Keys = %q, %q, %v", img, sub, err)
+	}
+	if hits.Load() != 2 {
+		t.Errorf("hits = %d, want 2", hits.Load())
+	}
+}
+
+// 与 newNavServer 相同，但在 release 关闭前不返回响应
+func newBlockingServer(t *testing.T, file string) (*httptest.Server, *atomic.Int32, chan struct{}) {
+	t.Helper()
+	body, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hits atomic.Int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		<-release
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits, release
+}
+
+// 等待服务端收到 n 个请求
+func waitHits(t *testing.T, hits *atomic.Int32, n int32) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for hits.Load() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("hits = %d, want %d", hits.Load(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSignerConcurrentFetch(t *testing.T) {
+	srv, hits, release := newBlockingServer(t, "testdata/nav.json")
+	now := fixtureTime
+	s := newTestSigner(srv, &now)
+
+	results := make(chan error, 5)
+	for range 5 {
+		go func() {
+			img, sub, err := s.Keys(context.Background())
+			if err == nil && (img != fixtureImgKey || sub != fixtureSubKey) {
+				err = fmt.Errorf("Keys = %q, %q", img, sub)
+			}
+			results <- err
+		}()
+	}
+	waitHits(t, hits, 1)
+
+	// 获取期间不持有锁，等待中的调用可以随 ctx 返回
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, _, err := s.Keys(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Keys = %v, want DeadlineExceeded", err)
+	}
+
+	close(release)
+	for range 5 {
+		if err := <-results; err != nil {
+			t.Error(err)
+		}
+	}
+	if hits.Load() != 1 {
+		t.Errorf("hits = %d, want 1", hits.Load())
+	}
+}
+
+func TestSignerUsesStaleKeysWhileRefreshing(t *testing.T) {
+	srv, hits, release := newBlockingServer(t, "testdata/nav.json")
+	now := fixtureTime
+	s := newTestSigner(srv, &now)
+	s.SetKeys("old-img", "old-sub")
+	now = now.Add(keyTTL)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Keys(context.Background())
+	}()
+	waitHits(t, hits, 1)
+
+	if img, sub, err := s.Keys(context.Background()); err != nil || img != "old-img" || sub != "old-sub" {
+		t.Errorf("获取期间 Keys = %q, %q, %v, want 旧密钥", img, sub, err)
+	}
+	close(release)
+	<-done
+	if img, _, _ := s.Keys(context.Background()); img != fixtureImgKey || hits.Load() != 1 {
+		t.Errorf("获取后 Keys = %q, hits = %d", img, hits.Load())
+	}
+}
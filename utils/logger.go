@@ -17,10 +17,12 @@ type Logger interface {
 	Error(msg string, fields ...zap.Field)
 	Sync() error
 	GetLogs() []string
+	SetLevel(level string)
 }
 
 type memoryLogger struct {
 	zap      *zap.Logger
+	level    zap.AtomicLevel
 	logs     []string
 	logsLock sync.Mutex
 }
@@ -30,8 +32,9 @@ func NewLogger(level string) Logger {
 	cfg.Level = zap.NewAtomicLevelAt(parseLevel(level))
 	logger, _ := cfg.Build()
 	return &memoryLogger{
-		zap:  logger,
-		logs: make([]string, 0, 1000),
+		zap:   logger,
+		level: cfg.Level,
+		logs:  make([]string, 0, 1000),
 	}
 }
 
@@ -51,6 +54,11 @@ func (l *memoryLogger) Sync() error {
 	return l.zap.Sync()
 }
 
+// SetLevel 在运行时调整输出级别
+func (l *memoryLogger) SetLevel(level string) {
+	l.level.SetLevel(parseLevel(level))
+}
+
 // 以json字符串形式保存日志，包含level、ts、caller、msg、method、path、client、port等
 func (l *memoryLogger) appendLog(level string, msg string, fields ...zap.Field) {
 	l.logsLock.Lock()